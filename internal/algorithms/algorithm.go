@@ -9,3 +9,13 @@ import (
 type Algorithm interface {
 	Solve(ctx context.Context, problem model.Problem) (*model.Solution, error)
 }
+
+// Inserter adds new requests of the problem to one of its solutions without solving it again
+type Inserter interface {
+	Insert(ctx context.Context, problem model.Problem, solution model.Solution, requests []model.Ref) (*model.Solution, error)
+}
+
+// Remover takes requests of the problem out of one of its solutions without solving it again
+type Remover interface {
+	Remove(ctx context.Context, problem model.Problem, solution model.Solution, requests []model.Ref, reinsert bool) (*model.Solution, error)
+}
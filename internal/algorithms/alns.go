@@ -0,0 +1,567 @@
+package algorithms
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"sort"
+	"time"
+
+	"github.com/edusalguero/roteiro.git/internal/cost"
+	"github.com/edusalguero/roteiro.git/internal/logger"
+	"github.com/edusalguero/roteiro.git/internal/model"
+	"github.com/edusalguero/roteiro.git/internal/routeestimator"
+)
+
+const (
+	alnsDefaultIterations = 1000 // When there is neither time limit nor iterations limit
+	alnsMaxRemoved        = 30   // Max requests removed in every iteration
+	alnsRemovedFraction   = 0.4  // Max fraction of the assigned requests removed in every iteration
+	alnsSegment           = 100  // Iterations between updates of the operator weights
+	alnsReaction          = 0.1  // How fast the weights follow the scores of the last segment
+	alnsNewBestScore      = 33
+	alnsBetterScore       = 9
+	alnsAcceptedScore     = 13
+	alnsStartWorsening    = 0.05  // Worsening of the initial cost accepted with probability 0.5 at the start
+	alnsEndTemperature    = 0.002 // Fraction of the start temperature reached at the end
+	alnsWorstRandomness   = 3
+	alnsShawRandomness    = 6
+	alnsUnassignedCost    = time.Hour // Cost of an unassigned request besides its penalty, as route time
+	alnsMustServeFactor   = 100
+)
+
+// ALNS is an Adaptive Large Neighbourhood Search. Every iteration removes some requests of the current solution and
+// inserts them again, choosing the operators by their past success. Worse solutions are accepted with the
+// probability of the simulated annealing so the search can leave the local optima
+// Based on An Adaptive Large Neighborhood Search Heuristic for the Pickup and Delivery Problem with Time Windows
+// https://doi.org/10.1287/trsc.1050.0135
+type ALNS struct {
+	logger       logger.Logger
+	construction *SequentialConstruction
+	timeLimit    time.Duration // Zero means no limit
+	iterations   int           // Zero means no limit
+}
+
+func NewALNS(l logger.Logger, e routeestimator.Estimator, de cost.Service, timeLimit time.Duration, iterations int) *ALNS {
+	if timeLimit == 0 && iterations == 0 {
+		iterations = alnsDefaultIterations
+	}
+	return &ALNS{
+		logger:       l,
+		construction: NewSequentialConstruction(l, e, de),
+		timeLimit:    timeLimit,
+		iterations:   iterations,
+	}
+}
+
+const ALNSName = "alns"
+
+// The default limits are given by the solver
+func ALNSDefinition(timeLimit time.Duration, iterations int) Definition {
+	return Definition{
+		Name:        ALNSName,
+		Description: "Adaptive Large Neighbourhood Search. Removes and inserts again requests to serve as many as possible",
+		Parameters: []Parameter{
+			{
+				Name:        "time_limit",
+				Type:        ParameterTypeDuration,
+				Description: "Max duration of the search. Zero means no limit",
+				Default:     float64(timeLimit),
+			},
+			{
+				Name:        "iterations",
+				Type:        ParameterTypeInteger,
+				Description: "Max iterations of the search. Zero means no limit, then the search cools down by its time limit and the seed does not give the same solution again",
+				Default:     float64(iterations),
+			},
+		},
+		New: func(l logger.Logger, e routeestimator.Estimator, de cost.Service, params Parameters) Algorithm {
+			return NewALNS(l, e, de, params.Duration("time_limit"), params.Int("iterations"))
+		},
+	}
+}
+
+// alnsSolution is a solution of the search. It is copied before any change
+type alnsSolution struct {
+	routes     []insertionRoute
+	unassigned []model.UnassignedRequest
+	cost       float64
+}
+
+type alnsRemoval func(ctx context.Context, p model.Problem, s *alnsSolution, q int, rnd *rand.Rand) (model.Requests, error)
+
+type alnsInsertion func(
+	ctx context.Context,
+	p model.Problem,
+	routes []insertionRoute,
+	requests model.Requests,
+) ([]model.UnassignedRequest, error)
+
+type alnsOperator struct {
+	weight float64
+	score  float64
+	uses   int
+}
+
+// alnsAssignment is an assigned request that can be removed from its route
+type alnsAssignment struct {
+	route   int
+	request model.Request
+}
+
+func (a *ALNS) Solve(ctx context.Context, p model.Problem) (*model.Solution, error) {
+	algoStart := time.Now()
+	initial, err := a.construction.construct(ctx, p, nil)
+	if err != nil {
+		return nil, err
+	}
+	current := &alnsSolution{
+		routes:     a.construction.insertionRoutes(ctx, p, *initial),
+		unassigned: initial.Unassigned,
+	}
+	if current.cost, err = a.cost(ctx, p, current); err != nil {
+		return nil, err
+	}
+	best := current
+
+	removals := []alnsRemoval{a.randomRemoval, a.worstRemoval, a.shawRemoval}
+	insertions := []alnsInsertion{a.construction.insertRequests, a.regretInsertion}
+	removalStats := newOperators(len(removals))
+	insertionStats := newOperators(len(insertions))
+
+	rnd := rand.New(rand.NewSource(p.Seed))
+	startTemperature := -alnsStartWorsening * current.cost / math.Log(0.5)
+	for it := 0; !a.isDone(ctx, it, algoStart); it++ {
+		if len(current.assignments(p.Constraints)) == 0 && len(current.unassigned) == 0 {
+			break
+		}
+		removal := selectOperator(removalStats, rnd)
+		insertion := selectOperator(insertionStats, rnd)
+
+		candidate := current.copy()
+		removed, err := removals[removal](ctx, p, candidate, removedCount(candidate, p.Constraints, rnd), rnd)
+		if err != nil {
+			return nil, err
+		}
+		requests := append(removed, unassignedRequests(p, candidate.unassigned)...)
+		if candidate.unassigned, err = insertions[insertion](ctx, p, candidate.routes, requests); err != nil {
+			return nil, err
+		}
+		if candidate.cost, err = a.cost(ctx, p, candidate); err != nil {
+			return nil, err
+		}
+
+		score := 0.0
+		temperature := startTemperature * math.Pow(alnsEndTemperature, a.progress(it, algoStart))
+		switch {
+		case candidate.cost < best.cost:
+			a.logger.Debugf("ALNS new best solution at iteration %d: %f", it, candidate.cost)
+			best, score = candidate, alnsNewBestScore
+		case candidate.cost < current.cost:
+			score = alnsBetterScore
+		case rnd.Float64() < math.Exp((current.cost-candidate.cost)/temperature):
+			score = alnsAcceptedScore
+		}
+		if score > 0 {
+			current = candidate
+		}
+
+		removalStats[removal].score += score
+		removalStats[removal].uses++
+		insertionStats[insertion].score += score
+		insertionStats[insertion].uses++
+		if (it+1)%alnsSegment == 0 {
+			updateWeights(removalStats)
+			updateWeights(insertionStats)
+		}
+	}
+
+	return a.construction.newInsertionSolution(ctx, p, best.routes, best.unassigned, algoStart)
+}
+
+// The search is done after its iterations or its time limit, or when the context is done
+func (a *ALNS) isDone(ctx context.Context, it int, start time.Time) bool {
+	if ctx.Err() != nil {
+		return true
+	}
+	return (a.iterations > 0 && it >= a.iterations) || (a.timeLimit > 0 && time.Since(start) >= a.timeLimit)
+}
+
+// The fraction of the search already done, by iterations or by time when there is no limit of iterations. The
+// search of a given seed is the same until it is stopped by time
+func (a *ALNS) progress(it int, start time.Time) float64 {
+	if a.iterations > 0 {
+		return math.Min(float64(it)/float64(a.iterations), 1)
+	}
+	return math.Min(float64(time.Since(start))/float64(a.timeLimit), 1)
+}
+
+// The cost of the solution is the cost of its routes plus the cost of its unassigned requests. With the zero
+// objective the cost of a route is its duration in seconds
+func (a *ALNS) cost(ctx context.Context, p model.Problem, s *alnsSolution) (float64, error) {
+	total := 0.0
+	for _, ir := range s.routes {
+		if len(ir.requests) == 0 {
+			continue
+		}
+		c, err := a.construction.routeCost(ctx, ir.route, ir.asset, p)
+		if err != nil {
+			return 0, err
+		}
+		total += c
+	}
+	for _, u := range s.unassigned {
+		total += unassignedCost(p.Objective, u.Request)
+	}
+	return total, nil
+}
+
+// The most important requests cost more when they are not served. With an objective it is the unassigned cost of
+// its breakdown
+func unassignedCost(o model.Objective, req model.Request) float64 {
+	if !o.IsZero() {
+		return o.UnassignedRequestCost(req)
+	}
+	c := alnsUnassignedCost.Seconds() + req.UnassignedPenalty
+	if req.Priority > 0 {
+		c *= float64(1 + req.Priority)
+	}
+	if req.MustServe {
+		c *= alnsMustServeFactor
+	}
+	return c
+}
+
+func (s *alnsSolution) copy() *alnsSolution {
+	routes := make([]insertionRoute, len(s.routes))
+	for i, ir := range s.routes {
+		ir.requests = append([]model.Request{}, ir.requests...)
+		routes[i] = ir
+	}
+	return &alnsSolution{
+		routes:     routes,
+		unassigned: append([]model.UnassignedRequest{}, s.unassigned...),
+		cost:       s.cost,
+	}
+}
+
+// The assigned requests that can be moved to another position or route
+func (s *alnsSolution) assignments(c model.Constraints) []alnsAssignment {
+	var assignments []alnsAssignment
+	for k, ir := range s.routes {
+		for _, req := range ir.requests {
+			if isMovable(ir.asset, req.RequestID, c) {
+				assignments = append(assignments, alnsAssignment{route: k, request: req})
+			}
+		}
+	}
+	return assignments
+}
+
+func (s *alnsSolution) remove(p model.Problem, assignment alnsAssignment) *model.Request {
+	s.routes[assignment.route] = withoutRequest(s.routes[assignment.route], assignment.request)
+	return findRequest(p.Requests, assignment.request.RequestID)
+}
+
+func unassignedRequests(p model.Problem, unassigned []model.UnassignedRequest) model.Requests {
+	var requests model.Requests
+	for _, u := range unassigned {
+		if req := findRequest(p.Requests, u.RequestID); req != nil {
+			requests = append(requests, req)
+		}
+	}
+	return requests
+}
+
+// A random number of requests, between one and a fraction of the assigned ones
+func removedCount(s *alnsSolution, c model.Constraints, rnd *rand.Rand) int {
+	n := len(s.assignments(c))
+	if n == 0 {
+		return 0
+	}
+	limit := int(alnsRemovedFraction * float64(n))
+	if limit > alnsMaxRemoved {
+		limit = alnsMaxRemoved
+	}
+	if limit < 1 {
+		limit = 1
+	}
+	return 1 + rnd.Intn(limit)
+}
+
+func (a *ALNS) randomRemoval(
+	_ context.Context,
+	p model.Problem,
+	s *alnsSolution,
+	q int,
+	rnd *rand.Rand,
+) (model.Requests, error) {
+	assignments := s.assignments(p.Constraints)
+	rnd.Shuffle(len(assignments), func(i, j int) {
+		assignments[i], assignments[j] = assignments[j], assignments[i]
+	})
+
+	var removed model.Requests
+	for _, assignment := range assignments[:minInt(q, len(assignments))] {
+		removed = append(removed, s.remove(p, assignment))
+	}
+	return removed, nil
+}
+
+// Worst removal takes out the requests that save the most cost of their routes, with some randomness
+func (a *ALNS) worstRemoval(
+	ctx context.Context,
+	p model.Problem,
+	s *alnsSolution,
+	q int,
+	rnd *rand.Rand,
+) (model.Requests, error) {
+	assignments := s.assignments(p.Constraints)
+	costs := make(map[int]float64)
+	savings := make([]float64, len(assignments))
+	for i, assignment := range assignments {
+		ir := s.routes[assignment.route]
+		if _, ok := costs[assignment.route]; !ok {
+			c, err := a.construction.routeCost(ctx, ir.route, ir.asset, p)
+			if err != nil {
+				return nil, err
+			}
+			costs[assignment.route] = c
+		}
+		c, err := a.construction.routeCost(ctx, removeFromRoute(ir.route, assignment.request), ir.asset, p)
+		if err != nil {
+			return nil, err
+		}
+		savings[i] = costs[assignment.route] - c
+	}
+	sort.Sort(byDescendingSaving{assignments, savings})
+
+	return removeRandomized(p, s, assignments, q, alnsWorstRandomness, rnd), nil
+}
+
+type byDescendingSaving struct {
+	assignments []alnsAssignment
+	savings     []float64
+}
+
+func (b byDescendingSaving) Len() int           { return len(b.assignments) }
+func (b byDescendingSaving) Less(i, j int) bool { return b.savings[i] > b.savings[j] }
+func (b byDescendingSaving) Swap(i, j int) {
+	b.assignments[i], b.assignments[j] = b.assignments[j], b.assignments[i]
+	b.savings[i], b.savings[j] = b.savings[j], b.savings[i]
+}
+
+// Shaw removal takes out a random request and the requests most related to it: close pick ups and drop offs and
+// similar pick up times, so they can be exchanged when inserted again
+func (a *ALNS) shawRemoval(
+	ctx context.Context,
+	p model.Problem,
+	s *alnsSolution,
+	q int,
+	rnd *rand.Rand,
+) (model.Requests, error) {
+	assignments := s.assignments(p.Constraints)
+	if len(assignments) == 0 {
+		return nil, nil
+	}
+	seed := assignments[rnd.Intn(len(assignments))].request
+	relatedness := make(map[model.Ref]float64, len(assignments))
+	for _, assignment := range assignments {
+		r, err := a.relatedness(ctx, seed, assignment.request)
+		if err != nil {
+			return nil, err
+		}
+		relatedness[assignment.request.RequestID] = r
+	}
+	sort.SliceStable(assignments, func(i, j int) bool {
+		return relatedness[assignments[i].request.RequestID] < relatedness[assignments[j].request.RequestID]
+	})
+
+	return removeRandomized(p, s, assignments, q, alnsShawRandomness, rnd), nil
+}
+
+// The lower, the more related the requests are
+func (a *ALNS) relatedness(ctx context.Context, r1, r2 model.Request) (float64, error) {
+	pickUps, err := a.construction.costEstimator.GetCost(ctx, r1.PickUp, r2.PickUp)
+	if err != nil {
+		return 0, err
+	}
+	dropOffs, err := a.construction.costEstimator.GetCost(ctx, r1.DropOff, r2.DropOff)
+	if err != nil {
+		return 0, err
+	}
+	related := pickUps.Duration.Seconds() + dropOffs.Duration.Seconds()
+	if !r1.PickUpTimeWindow.Earliest.IsZero() && !r2.PickUpTimeWindow.Earliest.IsZero() {
+		related += math.Abs(r1.PickUpTimeWindow.Earliest.Sub(r2.PickUpTimeWindow.Earliest).Seconds())
+	}
+	return related, nil
+}
+
+// The first requests of the sorted assignments are the most likely to be removed
+func removeRandomized(
+	p model.Problem,
+	s *alnsSolution,
+	assignments []alnsAssignment,
+	q int,
+	randomness float64,
+	rnd *rand.Rand,
+) model.Requests {
+	var removed model.Requests
+	for len(removed) < q && len(assignments) > 0 {
+		i := int(math.Pow(rnd.Float64(), randomness) * float64(len(assignments)))
+		removed = append(removed, s.remove(p, assignments[i]))
+		assignments = append(assignments[:i], assignments[i+1:]...)
+	}
+	return removed
+}
+
+type regretOption struct {
+	route model.Route
+	delta float64
+}
+
+// Regret insertion inserts first the request that loses the most when it is not inserted in its best route but in
+// the second one. The most important requests are inserted before anyway. The requests of the same vehicle group
+// are scored and inserted together
+func (a *ALNS) regretInsertion(
+	ctx context.Context,
+	p model.Problem,
+	routes []insertionRoute,
+	requests model.Requests,
+) ([]model.UnassignedRequest, error) {
+	units := insertionUnits(requests, p.Constraints)
+	options := make([][]regretOption, len(units))
+	evaluate := func(i, k int) error {
+		if !isGroupPending(p, routes, units[i]) {
+			options[i][k] = regretOption{}
+			return nil
+		}
+		group := groupRoute(routes, units[i][0].RequestID, p.Constraints)
+		r, delta, err := a.construction.routeInsertion(ctx, p, routes, k, group, units[i])
+		options[i][k] = regretOption{route: r, delta: delta}
+		return err
+	}
+	for i := range units {
+		options[i] = make([]regretOption, len(routes))
+		for k := range routes {
+			if err := evaluate(i, k); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	pending := make(map[int]bool, len(units))
+	for i := range units {
+		pending[i] = true
+	}
+	for len(pending) > 0 {
+		best, bestRoute := -1, -1
+		var bestRegret float64
+		for i := range units {
+			if !pending[i] {
+				continue
+			}
+			first, regret := regret(options[i])
+			if first < 0 {
+				continue
+			}
+			if best >= 0 {
+				before, decided := isMoreImportant(units[i][0], units[best][0])
+				if decided && !before || !decided && regret <= bestRegret {
+					continue
+				}
+			}
+			best, bestRoute, bestRegret = i, first, regret
+		}
+		if best < 0 {
+			break
+		}
+
+		a.construction.addUnit(&routes[bestRoute], options[best][bestRoute].route, units[best])
+		delete(pending, best)
+		for i := range pending {
+			if err := evaluate(i, bestRoute); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	unassigned := make([]model.UnassignedRequest, 0, len(pending))
+	for i := range units {
+		if !pending[i] {
+			continue
+		}
+		notInserted, err := a.construction.unitUnassigned(ctx, p, routes, units[i])
+		if err != nil {
+			return nil, err
+		}
+		unassigned = append(unassigned, notInserted...)
+	}
+	return unassigned, nil
+}
+
+// The route with the cheapest insertion and the difference with the second cheapest. The regret is infinite when
+// there is only one route. It returns -1 when there is none
+func regret(options []regretOption) (int, float64) {
+	first, second := -1, -1
+	for k, o := range options {
+		if o.route == nil {
+			continue
+		}
+		switch {
+		case first < 0 || o.delta < options[first].delta:
+			first, second = k, first
+		case second < 0 || o.delta < options[second].delta:
+			second = k
+		}
+	}
+	if first < 0 {
+		return -1, 0
+	}
+	if second < 0 {
+		return first, math.Inf(1)
+	}
+	return first, options[second].delta - options[first].delta
+}
+
+func newOperators(n int) []alnsOperator {
+	operators := make([]alnsOperator, n)
+	for i := range operators {
+		operators[i].weight = 1
+	}
+	return operators
+}
+
+// Roulette wheel selection by the weights of the operators
+func selectOperator(operators []alnsOperator, rnd *rand.Rand) int {
+	total := 0.0
+	for _, o := range operators {
+		total += o.weight
+	}
+	r := rnd.Float64() * total
+	for i, o := range operators {
+		r -= o.weight
+		if r < 0 {
+			return i
+		}
+	}
+	return len(operators) - 1
+}
+
+// The weights follow the average score of the operators in the last segment
+func updateWeights(operators []alnsOperator) {
+	for i := range operators {
+		o := &operators[i]
+		if o.uses > 0 {
+			o.weight = (1-alnsReaction)*o.weight + alnsReaction*o.score/float64(o.uses)
+		}
+		o.score, o.uses = 0, 0
+	}
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
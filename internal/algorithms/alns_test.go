@@ -0,0 +1,215 @@
+package algorithms
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/edusalguero/roteiro.git/internal/distanceestimator"
+	"github.com/edusalguero/roteiro.git/internal/logger"
+	"github.com/edusalguero/roteiro.git/internal/model"
+	"github.com/edusalguero/roteiro.git/internal/routeestimator"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestALNS_Solve(t *testing.T) {
+	e := distanceestimator.NewHaversineDistanceEstimator(80)
+	construction := NewSequentialConstruction(logger.NewNopLogger(), routeestimator.NewEstimator(e), e)
+	algo := NewALNS(logger.NewNopLogger(), routeestimator.NewEstimator(e), e, time.Minute, 100)
+
+	p := model.Problem{
+		Fleet: []model.Asset{
+			{AssetID: "Miño Asset", Location: minoLoc, Capacity: model.NewCapacity(1)},
+			{AssetID: "As Pontes Asset", Location: aspontesLoc, Capacity: model.NewCapacity(1)},
+		},
+		Requests: []model.Request{
+			{
+				RequestID:        "As Pontes - Sada",
+				PickUp:           aspontesLoc,
+				DropOff:          sadaLoc,
+				Load:             model.NewLoad(1),
+				PickUpTimeWindow: model.TimeWindow{Latest: departure.Add(25 * time.Minute)},
+			},
+			{
+				RequestID:        "Miño - Sada",
+				PickUp:           minoLoc,
+				DropOff:          sadaLoc,
+				Load:             model.NewLoad(1),
+				PickUpTimeWindow: model.TimeWindow{Latest: departure.Add(5 * time.Minute)},
+			},
+		},
+		Constraints: model.Constraints{
+			MaxJourneyTimeFactor: 1.5,
+		},
+		Departure: departure,
+	}
+
+	// The Miño asset takes the farthest request first, so nobody else can serve the other one on time
+	initial, err := construction.Solve(context.Background(), p)
+	assert.NoError(t, err)
+	assert.Equal(t, []Route{{minoLoc, aspontesLoc, sadaLoc}, {aspontesLoc}}, getTestRoutes(t, initial.Routes))
+	assert.Len(t, initial.Unassigned, 1)
+
+	got, err := algo.Solve(context.Background(), p)
+	assert.NoError(t, err)
+	assert.Equal(t, []Route{{minoLoc, sadaLoc}, {aspontesLoc, sadaLoc}}, getTestRoutes(t, got.Routes))
+	assert.Equal(t, 2, got.Metrics.NumRequests)
+	assert.Empty(t, got.Unassigned)
+}
+
+func TestALNS_Solve_Cancelled(t *testing.T) {
+	e := distanceestimator.NewHaversineDistanceEstimator(80)
+	algo := NewALNS(logger.NewNopLogger(), routeestimator.NewEstimator(e), e, time.Hour, 0)
+
+	p := model.Problem{
+		Fleet: []model.Asset{
+			{AssetID: "Miño Asset", Location: minoLoc, Capacity: model.NewCapacity(1)},
+			{AssetID: "As Pontes Asset", Location: aspontesLoc, Capacity: model.NewCapacity(1)},
+		},
+		Requests: []model.Request{
+			{RequestID: "As Pontes - Sada", PickUp: aspontesLoc, DropOff: sadaLoc, Load: model.NewLoad(1)},
+			{RequestID: "Miño - Sada", PickUp: minoLoc, DropOff: sadaLoc, Load: model.NewLoad(1)},
+		},
+		Constraints: model.Constraints{
+			MaxJourneyTimeFactor: 1.5,
+		},
+		Departure: departure,
+	}
+
+	// The search of an hour stops with the context, returning the best solution so far
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	got, err := algo.Solve(ctx, p)
+	assert.NoError(t, err)
+	assert.True(t, got.Metrics.Partial)
+	assert.Less(t, int64(got.Metrics.SolvedTime), int64(time.Second))
+	assert.Equal(t, 2, got.Metrics.NumRequests)
+
+	t.Run("Must serve requests stopped before trying them", func(t *testing.T) {
+		p.Requests[0].MustServe = true
+		p.Requests[1].MustServe = true
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		got, err := algo.Solve(ctx, p)
+		assert.NoError(t, err)
+		assert.True(t, got.Metrics.Partial)
+		assert.Len(t, got.Unassigned, 2)
+		for _, u := range got.Unassigned {
+			assert.Contains(t, u.Reasons, model.UnassignedReasonStopped)
+		}
+	})
+}
+
+func TestALNS_regretInsertion(t *testing.T) {
+	e := distanceestimator.NewHaversineDistanceEstimator(80)
+	algo := NewALNS(logger.NewNopLogger(), routeestimator.NewEstimator(e), e, 0, 0)
+	assert.Equal(t, alnsDefaultIterations, algo.iterations)
+
+	p := model.Problem{
+		Fleet: []model.Asset{
+			{AssetID: "Miño Asset", Location: minoLoc, Capacity: model.NewCapacity(1)},
+			{AssetID: "As Pontes Asset", Location: aspontesLoc, Capacity: model.NewCapacity(1)},
+		},
+		Requests: []model.Request{
+			{
+				RequestID:        "As Pontes - Sada",
+				PickUp:           aspontesLoc,
+				DropOff:          sadaLoc,
+				Load:             model.NewLoad(1),
+				PickUpTimeWindow: model.TimeWindow{Latest: departure.Add(25 * time.Minute)},
+			},
+			{
+				RequestID:        "Miño - Sada",
+				PickUp:           minoLoc,
+				DropOff:          sadaLoc,
+				Load:             model.NewLoad(1),
+				PickUpTimeWindow: model.TimeWindow{Latest: departure.Add(5 * time.Minute)},
+			},
+			{
+				RequestID:        "Vilalba - Sada",
+				PickUp:           vilalbaLoc,
+				DropOff:          sadaLoc,
+				Load:             model.NewLoad(1),
+				PickUpTimeWindow: model.TimeWindow{Latest: departure.Add(5 * time.Minute)},
+			},
+		},
+		Constraints: model.Constraints{
+			MaxJourneyTimeFactor: 1.5,
+		},
+		Departure: departure,
+	}
+	routes := algo.construction.insertionRoutes(context.Background(), p, model.Solution{})
+	requests := model.Requests{&p.Requests[0], &p.Requests[1], &p.Requests[2]}
+
+	// The Miño request can only be served by the Miño asset, so it goes first. Nobody can serve the Vilalba one on time
+	unassigned, err := algo.regretInsertion(context.Background(), p, routes, requests)
+	assert.NoError(t, err)
+	assert.Equal(t, []model.Ref{"Miño - Sada"}, requestRefs(routes[0].requests))
+	assert.Equal(t, []model.Ref{"As Pontes - Sada"}, requestRefs(routes[1].requests))
+	assert.Len(t, unassigned, 1)
+	assert.Equal(t, model.Ref("Vilalba - Sada"), unassigned[0].RequestID)
+	assert.Contains(t, unassigned[0].Reasons, model.UnassignedReasonTimeWindow)
+}
+
+func TestALNS_Solve_GroupThatOnlyPartlyFits(t *testing.T) {
+	e := distanceestimator.NewHaversineDistanceEstimator(80)
+	algo := NewALNS(logger.NewNopLogger(), routeestimator.NewEstimator(e), e, 0, 100)
+
+	newRequest := func(id model.Ref, load int) model.Request {
+		return model.Request{RequestID: id, PickUp: aspontesLoc, DropOff: sadaLoc, Load: model.NewLoad(load)}
+	}
+	p := model.Problem{
+		Fleet: []model.Asset{
+			{AssetID: "Miño Asset", Location: minoLoc, Capacity: model.NewCapacity(4)},
+			{AssetID: "As Pontes Asset", Location: aspontesLoc, Capacity: model.NewCapacity(4)},
+		},
+		Requests: []model.Request{
+			newRequest("A", 1),
+			newRequest("B", 1),
+			newRequest("Group 1", 2),
+			newRequest("Group 2", 2),
+			newRequest("Group 3", 2),
+		},
+		Constraints: model.Constraints{
+			MaxJourneyTimeFactor: 1.5,
+			IncompatibleRequests: []model.RequestPair{{"A", "B"}},
+			SameVehicleGroups:    []model.RequestGroup{{"Group 1", "Group 2", "Group 3"}},
+		},
+		Departure: departure,
+	}
+
+	// Both repairs would serve some members of the group, but the group needs more than an asset has
+	got, err := algo.Solve(context.Background(), p)
+	assert.NoError(t, err)
+	var assigned []model.Ref
+	for _, r := range got.Routes {
+		assigned = append(assigned, requestRefs(r.Requests)...)
+	}
+	assert.ElementsMatch(t, []model.Ref{"A", "B"}, assigned)
+	var unassigned []model.Ref
+	for _, u := range got.Unassigned {
+		unassigned = append(unassigned, u.RequestID)
+	}
+	assert.ElementsMatch(t, []model.Ref{"Group 1", "Group 2", "Group 3"}, unassigned)
+
+	t.Run("Regret insertion of the group", func(t *testing.T) {
+		routes := algo.construction.insertionRoutes(context.Background(), p, model.Solution{})
+		requests := model.Requests{&p.Requests[2], &p.Requests[3], &p.Requests[4]}
+		unassigned, err := algo.regretInsertion(context.Background(), p, routes, requests)
+		assert.NoError(t, err)
+		assert.Empty(t, routes[0].requests)
+		assert.Empty(t, routes[1].requests)
+		assert.Len(t, unassigned, 3)
+		for _, u := range unassigned {
+			assert.Contains(t, u.Reasons, model.UnassignedReasonGroup)
+		}
+	})
+}
+
+func requestRefs(requests []model.Request) []model.Ref {
+	var refs []model.Ref
+	for _, req := range requests {
+		refs = append(refs, req.RequestID)
+	}
+	return refs
+}
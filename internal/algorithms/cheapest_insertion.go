@@ -0,0 +1,546 @@
+package algorithms
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/edusalguero/roteiro.git/internal/model"
+)
+
+// insertionRoute is a route of the solution being modified
+type insertionRoute struct {
+	asset    model.Asset
+	route    model.Route
+	requests []model.Request
+	solution *model.SolutionRoute // Nil when the route is new
+	changed  bool
+}
+
+// Insert adds the requests to the solution of the problem, every one where it increases the least the duration of
+// its route without violating any constraint. The planned stops keep their order and the assets without route start
+// a new one. The routes that do not change are kept as they are
+func (a *SequentialConstruction) Insert(
+	ctx context.Context,
+	p model.Problem,
+	s model.Solution,
+	refs []model.Ref,
+) (*model.Solution, error) {
+	algoStart := time.Now()
+	routes := a.insertionRoutes(ctx, p, s)
+
+	var requests model.Requests
+	for _, ref := range refs {
+		if req := findRequest(p.Requests, ref); req != nil {
+			requests = append(requests, req)
+		}
+	}
+	unassigned, err := a.insertRequests(ctx, p, routes, requests)
+	if err != nil {
+		return nil, err
+	}
+
+	unassigned = append(append([]model.UnassignedRequest{}, s.Unassigned...), unassigned...)
+	return a.newInsertionSolution(ctx, p, routes, unassigned, algoStart)
+}
+
+// Every request is inserted in the route where it increases the least the duration, most important requests first.
+// The requests of the same vehicle group are inserted together in one route or none of them.
+// It returns the requests that can not be inserted
+func (a *SequentialConstruction) insertRequests(
+	ctx context.Context,
+	p model.Problem,
+	routes []insertionRoute,
+	requests model.Requests,
+) ([]model.UnassignedRequest, error) {
+	unassigned := make([]model.UnassignedRequest, 0)
+	for _, members := range insertionUnits(requests, p.Constraints) {
+		best := -1
+		var bestRoute model.Route
+		var bestDelta float64
+		if isGroupPending(p, routes, members) {
+			group := groupRoute(routes, members[0].RequestID, p.Constraints)
+			for k := range routes {
+				r, delta, err := a.routeInsertion(ctx, p, routes, k, group, members)
+				if err != nil {
+					return nil, err
+				}
+				if r != nil && (best < 0 || delta < bestDelta) {
+					best, bestRoute, bestDelta = k, r, delta
+				}
+			}
+		}
+
+		if best < 0 {
+			notInserted, err := a.unitUnassigned(ctx, p, routes, members)
+			if err != nil {
+				return nil, err
+			}
+			unassigned = append(unassigned, notInserted...)
+			continue
+		}
+		a.addUnit(&routes[best], bestRoute, members)
+	}
+	return unassigned, nil
+}
+
+// The requests are sorted by importance and the ones of the same vehicle group are put together, after the most
+// important of them
+func insertionUnits(requests model.Requests, c model.Constraints) []model.Requests {
+	sorted := append(model.Requests{}, requests...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		before, _ := isMoreImportant(sorted[i], sorted[j])
+		return before
+	})
+
+	var units []model.Requests
+	for i := range sorted {
+		unit := insertionUnit(sorted, i, c)
+		if unit == nil {
+			continue
+		}
+		var members model.Requests
+		for _, u := range unit {
+			members = append(members, sorted[u])
+		}
+		units = append(units, members)
+	}
+	return units
+}
+
+// The requests of a vehicle group can only be inserted when the rest of the group is already in a route or is
+// inserted with them
+func isGroupPending(p model.Problem, routes []insertionRoute, members model.Requests) bool {
+	for _, ref := range p.Constraints.GroupOf(members[0].RequestID) {
+		if findRequest(p.Requests, ref) != nil && !isUnitMember(members, ref) && !isInRoute(routes, ref) {
+			return false
+		}
+	}
+	return true
+}
+
+func isUnitMember(members model.Requests, ref model.Ref) bool {
+	for _, req := range members {
+		if req.RequestID == ref {
+			return true
+		}
+	}
+	return false
+}
+
+func isInRoute(routes []insertionRoute, ref model.Ref) bool {
+	for _, ir := range routes {
+		for _, req := range ir.requests {
+			if req.RequestID == ref {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// The cheapest insertion of the requests in the route k, one after the other. It returns nil when any of them has
+// no feasible one, can not be served by the asset or belongs to a vehicle group of another route
+func (a *SequentialConstruction) routeInsertion(
+	ctx context.Context,
+	p model.Problem,
+	routes []insertionRoute,
+	k int,
+	group int,
+	members model.Requests,
+) (model.Route, float64, error) {
+	if len(routeIncompatibilities(p, routes, k, group, members)) > 0 {
+		return nil, 0, nil
+	}
+	ir := routes[k]
+	total := 0.0
+	for _, req := range members {
+		r, delta, err := a.cheapestInsertion(ctx, &ir, req, p)
+		if err != nil || r == nil {
+			return nil, 0, err
+		}
+		ir.route = r
+		total += delta
+	}
+	return ir.route, total, nil
+}
+
+// The requests are added to the route with the stops of their insertion
+func (a *SequentialConstruction) addUnit(ir *insertionRoute, r model.Route, members model.Requests) {
+	for _, req := range members {
+		a.logger.Debugf("###  Inserting request %s in the route of %s", req.RequestID, ir.asset.AssetID)
+		ir.requests = append(ir.requests, withoutServiceTimes(*req))
+	}
+	ir.route = r
+	ir.changed = true
+}
+
+// The requests that can not be inserted with the constraints they violate alone. The requests of a vehicle group
+// are not inserted because of the rest of the group too
+func (a *SequentialConstruction) unitUnassigned(
+	ctx context.Context,
+	p model.Problem,
+	routes []insertionRoute,
+	members model.Requests,
+) ([]model.UnassignedRequest, error) {
+	unassigned := make([]model.UnassignedRequest, 0, len(members))
+	for _, req := range members {
+		reasons, err := a.unassignedReasons(ctx, p, routes, req)
+		if err != nil {
+			return nil, err
+		}
+		if len(p.Constraints.GroupOf(req.RequestID)) > 1 {
+			reasons = addReasons(reasons, model.UnassignedReasonGroup)
+		}
+		unassigned = append(unassigned, model.UnassignedRequest{Request: withoutServiceTimes(*req), Reasons: reasons})
+	}
+	return unassigned, nil
+}
+
+// The constraints the request violates in every route. The cheapest insertion does not look for them, they are
+// only needed when the request is not inserted
+func (a *SequentialConstruction) unassignedReasons(
+	ctx context.Context,
+	p model.Problem,
+	routes []insertionRoute,
+	req *model.Request,
+) ([]model.UnassignedReason, error) {
+	group := groupRoute(routes, req.RequestID, p.Constraints)
+	var reasons []model.UnassignedReason
+	for k := range routes {
+		own := routeIncompatibilities(p, routes, k, group, model.Requests{req})[req.RequestID]
+		if len(own) == 0 {
+			var err error
+			if own, err = a.insertionViolations(ctx, &routes[k], req, p); err != nil {
+				return nil, err
+			}
+		}
+		reasons = addReasons(reasons, own...)
+	}
+	return reasons, nil
+}
+
+// The requests can not be served by the asset of the route k, or they belong to a vehicle group of another route
+func routeIncompatibilities(
+	p model.Problem,
+	routes []insertionRoute,
+	k int,
+	group int,
+	members model.Requests,
+) map[model.Ref][]model.UnassignedReason {
+	if group >= 0 && group != k {
+		found := make(map[model.Ref][]model.UnassignedReason, len(members))
+		for _, req := range members {
+			found[req.RequestID] = []model.UnassignedReason{model.UnassignedReasonGroup}
+		}
+		return found
+	}
+	ir := &routes[k]
+	return incompatibilities(ir.asset, members, ir.requests, p.Constraints)
+}
+
+func (a *SequentialConstruction) newInsertionSolution(
+	ctx context.Context,
+	p model.Problem,
+	routes []insertionRoute,
+	unassigned []model.UnassignedRequest,
+	algoStart time.Time,
+) (*model.Solution, error) {
+	solutionRoutes, err := a.insertionSolutionRoutes(ctx, routes, p)
+	if err != nil {
+		return nil, err
+	}
+
+	var totalDistance float64
+	var totalDuration time.Duration
+	insertedRequests := 0
+	for _, sr := range solutionRoutes {
+		totalDistance += sr.Metrics.Distance
+		totalDuration += sr.Metrics.Duration
+		insertedRequests += len(sr.Requests)
+	}
+	sol := model.NewSolution(
+		model.NewSolutionMetrics(
+			len(solutionRoutes), insertedRequests, len(unassigned), totalDistance, totalDuration, time.Since(algoStart)),
+		solutionRoutes, unassigned)
+	sol.Metrics.UnassignedPenalty = unassignedPenalty(unassigned)
+	sol.Metrics.Cost = routesCost(solutionRoutes)
+	sol.Metrics.Objective = p.Objective.Breakdown(*sol)
+	sol.Metrics.Value = solutionValue(p, *sol)
+	// The improvement of the solution was stopped
+	sol.Metrics.Partial = ctx.Err() != nil
+	sol.Metrics.Seed = p.Seed
+
+	a.logger.Debugf("Solution: %v", sol)
+	if err := checkMustServe(unassigned); err != nil {
+		return nil, err
+	}
+	return sol, nil
+}
+
+// The routes of the solution are rebuilt from their waypoints without breaks. The assets without route get an
+// empty one
+func (a *SequentialConstruction) insertionRoutes(ctx context.Context, p model.Problem, s model.Solution) []insertionRoute {
+	var routes []insertionRoute
+	used := make(map[model.AssetID]bool)
+	for i := range s.Routes {
+		sr := &s.Routes[i]
+		asset := fleetAsset(p.Fleet, sr.Asset)
+		used[asset.AssetID] = true
+		routes = append(routes, insertionRoute{
+			asset:    asset,
+			route:    a.routeFromSolution(ctx, *sr, asset, p),
+			requests: append([]model.Request{}, sr.Requests...),
+			solution: sr,
+		})
+	}
+	for _, asset := range p.Fleet {
+		if !used[asset.AssetID] {
+			routes = append(routes, insertionRoute{asset: asset, route: newAssetRoute(asset, p)})
+		}
+	}
+	return routes
+}
+
+// The asset of the problem takes precedence over the copy of the solution
+func fleetAsset(fleet []model.Asset, asset model.Asset) model.Asset {
+	for _, a := range fleet {
+		if a.AssetID == asset.AssetID {
+			return a
+		}
+	}
+	return asset
+}
+
+func (a *SequentialConstruction) routeFromSolution(
+	ctx context.Context,
+	sr model.SolutionRoute,
+	asset model.Asset,
+	p model.Problem,
+) model.Route {
+	r := newAssetRoute(asset, p)
+	stops := make(map[model.Ref][2]*model.Stop)
+	for _, w := range sr.Waypoints {
+		for _, activity := range w.Activities {
+			if activity.ActivityType != model.ActivityTypePickUp && activity.ActivityType != model.ActivityTypeDropOff {
+				continue
+			}
+			if _, ok := stops[activity.Ref]; !ok {
+				req := findRequest(p.Requests, activity.Ref)
+				if req == nil {
+					continue
+				}
+				pickUp, dropOff := a.newCommittedStops(ctx, asset, req, p)
+				stops[activity.Ref] = [2]*model.Stop{pickUp, dropOff}
+			}
+			stop := stops[activity.Ref][0]
+			if activity.ActivityType == model.ActivityTypeDropOff {
+				stop = stops[activity.Ref][1]
+			}
+			if stop != nil {
+				r = insertBeforeEnd(r, stop)
+			}
+		}
+	}
+	return r
+}
+
+// The requests of the same vehicle group must be inserted in the route that already has any of them.
+// It returns -1 when there is none
+func groupRoute(routes []insertionRoute, ref model.Ref, c model.Constraints) int {
+	group := c.GroupOf(ref)
+	for k, ir := range routes {
+		for _, req := range ir.requests {
+			for _, member := range group {
+				if req.RequestID == member {
+					return k
+				}
+			}
+		}
+	}
+	return -1
+}
+
+// Every position of the pick up and drop off after the locked stops is evaluated. It returns the feasible route
+// with the smallest increase of cost, or nil when there is none.
+// The state of the route discards in constant time the positions that violate the time windows or the capacity,
+// and, without objective, the ones that can not finish the route earlier than the best so far. Only the rest of
+// the positions are planned and checked
+func (a *SequentialConstruction) cheapestInsertion(
+	ctx context.Context,
+	ir *insertionRoute,
+	req *model.Request,
+	p model.Problem,
+) (model.Route, float64, error) {
+	base, err := a.routeCost(ctx, ir.route, ir.asset, p)
+	if err != nil {
+		return nil, 0, err
+	}
+	state, err := a.newRouteState(ctx, ir.route, ir.asset.Capacity)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	first, last := insertionPositions(ir.route)
+	pickUp, dropOff := a.newRequestStops(ctx, ir.asset, req, p)
+	rr, err := state.withRequest(ctx, a, pickUp, dropOff, ir.asset.Capacity)
+	if err != nil {
+		return nil, 0, err
+	}
+	var best model.Route
+	var bestDelta float64
+	for i := first; i <= last; i++ {
+		check := rr.withPickUp(i)
+		for j := i; j <= last; j++ {
+			// The stops before the drop off are late or full for the next positions too
+			if j > i && !check.next() {
+				break
+			}
+			t := check.withDropOff()
+			// The breaks only delay the end of the route, the cost without them is a lower bound
+			if !t.isFeasible() || best != nil && p.Objective.IsZero() && (t.end-state.start()).Seconds()-base >= bestDelta {
+				continue
+			}
+
+			candidate := insertStops(ir.route, i, pickUp, j, dropOff)
+			c, violations, err := a.insertionCost(ctx, candidate, ir.asset, p)
+			if err != nil {
+				return nil, 0, err
+			}
+			if violations != nil {
+				continue
+			}
+			delta := c - base
+			if best == nil || delta < bestDelta {
+				best, bestDelta = candidate, delta
+			}
+		}
+	}
+	return best, bestDelta, nil
+}
+
+// The constraints violated by every position of the pick up and drop off after the locked stops. The positions are
+// planned and checked only when their timing does not decide them
+func (a *SequentialConstruction) insertionViolations(
+	ctx context.Context,
+	ir *insertionRoute,
+	req *model.Request,
+	p model.Problem,
+) ([]model.UnassignedReason, error) {
+	state, err := a.newRouteState(ctx, ir.route, ir.asset.Capacity)
+	if err != nil {
+		return nil, err
+	}
+
+	first, last := insertionPositions(ir.route)
+	pickUp, dropOff := a.newRequestStops(ctx, ir.asset, req, p)
+	rr, err := state.withRequest(ctx, a, pickUp, dropOff, ir.asset.Capacity)
+	if err != nil {
+		return nil, err
+	}
+	decided := state.decidesViolations(ir.asset, dropOff)
+	var reasons []model.UnassignedReason
+	for i := first; i <= last; i++ {
+		check := rr.withPickUp(i)
+		for j := i; j <= last; j++ {
+			if j > i {
+				check.next()
+			}
+			var violations []model.UnassignedReason
+			if decided {
+				violations = state.violations(check.withDropOff(), ir.asset, p.Departure)
+			} else if _, violations, err = a.insertionCost(ctx, insertStops(ir.route, i, pickUp, j, dropOff), ir.asset, p); err != nil {
+				return nil, err
+			}
+			reasons = addReasons(reasons, violations...)
+		}
+	}
+	return reasons, nil
+}
+
+// The stops are inserted after the locked ones and before the end of the route
+func insertionPositions(r model.Route) (int, int) {
+	first := 1
+	for first < len(r) && r[first].Locked {
+		first++
+	}
+	last := len(r)
+	if r[last-1].IsAssetArrival() {
+		last--
+	}
+	return first, last
+}
+
+// The cost of the route planned with its breaks. It returns the violated constraints when it is not feasible,
+// not nil even when there are none but the order of the stops
+func (a *SequentialConstruction) insertionCost(
+	ctx context.Context,
+	r model.Route,
+	asset model.Asset,
+	p model.Problem,
+) (float64, []model.UnassignedReason, error) {
+	planned, placed, err := a.withBreaks(ctx, r, asset, p.Departure)
+	if err != nil {
+		return 0, nil, err
+	}
+	feasible, violations := a.isFeasibleRoute(ctx, planned, asset, p.Departure)
+	if !placed {
+		feasible = false
+		violations = addReasons(violations, model.UnassignedReasonBreak)
+	}
+	if !feasible {
+		return 0, append([]model.UnassignedReason{}, violations...), nil
+	}
+	// The route is scheduled by the feasibility check
+	c, err := a.scheduledCost(ctx, planned, p.Objective)
+	return c, nil, err
+}
+
+// The pick up is inserted before the stop i of the route and the drop off before the stop j, being j >= i
+func insertStops(r model.Route, i int, pickUp *model.Stop, j int, dropOff *model.Stop) model.Route {
+	route := make(model.Route, 0, len(r)+2)
+	route = append(route, r[:i]...)
+	route = append(route, pickUp)
+	route = append(route, r[i:j]...)
+	route = append(route, dropOff)
+	return append(route, r[j:]...)
+}
+
+// The changed routes are planned and scheduled again. The routes without requests are discarded
+func (a *SequentialConstruction) insertionSolutionRoutes(
+	ctx context.Context,
+	routes []insertionRoute,
+	p model.Problem,
+) ([]model.SolutionRoute, error) {
+	var solutionRoutes []model.SolutionRoute
+	for _, ir := range routes {
+		if !ir.changed {
+			if ir.solution != nil {
+				solutionRoutes = append(solutionRoutes, *ir.solution)
+			}
+			continue
+		}
+		if len(ir.requests) == 0 {
+			continue
+		}
+
+		r, _, err := a.withBreaks(ctx, ir.route, ir.asset, p.Departure)
+		if err != nil {
+			return nil, err
+		}
+		re, err := a.routeEstimator.GetRouteEstimation(ctx, r.GetPoints())
+		if err != nil {
+			return nil, err
+		}
+		if err := a.scheduleRoute(ctx, r); err != nil {
+			return nil, err
+		}
+		solutionRoutes = append(solutionRoutes, model.SolutionRoute{
+			Asset:     ir.asset,
+			Requests:  ir.requests,
+			Waypoints: buildRouteWaypoints(r, ir.asset, p.Departure),
+			Metrics:   newRouteMetrics(r, re, ir.asset, p.Departure),
+		})
+	}
+	return solutionRoutes, nil
+}
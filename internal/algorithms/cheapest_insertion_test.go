@@ -0,0 +1,106 @@
+package algorithms
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/edusalguero/roteiro.git/internal/distanceestimator"
+	"github.com/edusalguero/roteiro.git/internal/logger"
+	"github.com/edusalguero/roteiro.git/internal/model"
+	"github.com/edusalguero/roteiro.git/internal/routeestimator"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSequentialConstruction_Insert(t *testing.T) {
+	e := distanceestimator.NewHaversineDistanceEstimator(80)
+	algo := NewSequentialConstruction(logger.NewNopLogger(), routeestimator.NewEstimator(e), e)
+
+	minoAsset := model.Asset{
+		AssetID:  "Miño Asset",
+		Location: minoLoc,
+		Capacity: model.NewCapacity(2),
+	}
+	aspontesAsset := model.Asset{
+		AssetID:  "As Pontes Asset",
+		Location: aspontesLoc,
+		Capacity: model.NewCapacity(1),
+	}
+	planned := model.Request{
+		RequestID: "Miño - Sada",
+		PickUp:    minoLoc,
+		DropOff:   sadaLoc,
+		Load:      model.NewLoad(1),
+	}
+	inserted := model.Request{
+		RequestID: "As Pontes - Sada",
+		PickUp:    aspontesLoc,
+		DropOff:   sadaLoc,
+		Load:      model.NewLoad(1),
+	}
+	newProblem := func(factor float64, fleet ...model.Asset) model.Problem {
+		return model.Problem{
+			Fleet:    fleet,
+			Requests: []model.Request{planned},
+			Constraints: model.Constraints{
+				MaxJourneyTimeFactor: factor,
+			},
+			Departure: departure,
+		}
+	}
+
+	tests := []struct {
+		name    string
+		problem model.Problem
+		routes  []Route
+	}{
+		{
+			"New route for an idle asset",
+			newProblem(1.5, minoAsset, aspontesAsset),
+			[]Route{
+				{minoLoc, sadaLoc},
+				{aspontesLoc, sadaLoc},
+			},
+		},
+		{
+			"Cheapest position of an existing route",
+			newProblem(15, minoAsset),
+			[]Route{
+				{minoLoc, aspontesLoc, sadaLoc},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := tt.problem
+			s, err := algo.Solve(context.Background(), p)
+			assert.NoError(t, err)
+			assert.Equal(t, []Route{{minoLoc, sadaLoc}}, getTestRoutes(t, s.Routes))
+
+			p.Requests = append(p.Requests, inserted)
+			got, err := algo.Insert(context.Background(), p, *s, []model.Ref{inserted.RequestID})
+			assert.NoError(t, err)
+			assert.Equal(t, tt.routes, getTestRoutes(t, got.Routes))
+			assert.Equal(t, s.Routes[0].Waypoints[0], got.Routes[0].Waypoints[0])
+			assert.Equal(t, 2, got.Metrics.NumRequests)
+			assert.Equal(t, len(tt.routes), got.Metrics.NumAssets)
+			assert.Empty(t, got.Unassigned)
+		})
+	}
+
+	t.Run("Unassigned when it does not fit", func(t *testing.T) {
+		p := newProblem(1.5, minoAsset)
+		s, err := algo.Solve(context.Background(), p)
+		assert.NoError(t, err)
+
+		tooSoon := inserted
+		tooSoon.PickUpTimeWindow = model.TimeWindow{Latest: departure.Add(10 * time.Minute)}
+		p.Requests = append(p.Requests, tooSoon)
+		got, err := algo.Insert(context.Background(), p, *s, []model.Ref{tooSoon.RequestID})
+		assert.NoError(t, err)
+		assert.Equal(t, s.Routes, got.Routes)
+		assert.Len(t, got.Unassigned, 1)
+		assert.Equal(t, inserted.RequestID, got.Unassigned[0].RequestID)
+		assert.Contains(t, got.Unassigned[0].Reasons, model.UnassignedReasonTimeWindow)
+	})
+}
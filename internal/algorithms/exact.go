@@ -0,0 +1,517 @@
+package algorithms
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/edusalguero/roteiro.git/internal/cost"
+	"github.com/edusalguero/roteiro.git/internal/logger"
+	"github.com/edusalguero/roteiro.git/internal/model"
+	"github.com/edusalguero/roteiro.git/internal/point"
+	"github.com/edusalguero/roteiro.git/internal/routeestimator"
+)
+
+const (
+	exactTolerance    = 1e-6 // Values closer than this are equal, so the rounding errors do not explore equal solutions
+	exactMaxDominance = 64   // Max requests of the problems whose partial solutions are compared
+)
+
+// Exact is a branch and bound that finds the solution of the minimum value, the one the search algorithms minimize.
+// The routes are built one asset after another appending stops to their end, after the locked stops. The drop offs
+// of the onboard and committed requests that are not locked are appended among the new stops. The search
+// starts from the solution of the construction and prunes the partial solutions whose lower bound is not better
+// than the best solution found, or that are dominated by another one with the same requests, finishing earlier and
+// cheaper. The partial solutions are only compared in problems of up to exactMaxDominance requests. It is meant for
+// small problems: when the time limit is reached the best solution found is returned with the lower bound of the
+// partial solutions left to explore. When the committed stops of an asset can not be served on time, they keep the
+// order of the construction and there is no lower bound
+type Exact struct {
+	logger       logger.Logger
+	construction *SequentialConstruction
+	timeLimit    time.Duration // Zero means no limit
+}
+
+func NewExact(l logger.Logger, e routeestimator.Estimator, de cost.Service, timeLimit time.Duration) *Exact {
+	return &Exact{logger: l, construction: NewSequentialConstruction(l, e, de), timeLimit: timeLimit}
+}
+
+const ExactName = "exact"
+
+// The default time limit is given by the solver
+func ExactDefinition(timeLimit time.Duration) Definition {
+	return Definition{
+		Name:        ExactName,
+		Description: fmt.Sprintf("Branch and bound. Proves the optimal solution of small problems, up to about 12 requests. The partial solutions are only compared for dominance up to %d requests", exactMaxDominance),
+		Parameters: []Parameter{
+			{
+				Name:        "time_limit",
+				Type:        ParameterTypeDuration,
+				Description: "Max duration of the search. The best solution found is returned with a lower bound when it is reached. Zero means no limit",
+				Default:     float64(timeLimit),
+			},
+		},
+		New: func(l logger.Logger, e routeestimator.Estimator, de cost.Service, params Parameters) Algorithm {
+			return NewExact(l, e, de, params.Duration("time_limit"))
+		},
+	}
+}
+
+// exactSearch is the state of the search: the closed routes and the assignment of the requests
+type exactSearch struct {
+	p            model.Problem
+	requests     model.Requests // Requests to assign. The committed requests are not
+	index        map[model.Ref]int
+	committed    map[model.Ref]model.AssetID
+	bounds       [][2]float64 // Min cost every request adds to a route without and with end location
+	insertions   [][2]float64 // Min cost every request adds besides the rest, they add up
+	assigned     []int        // Asset of every request. -1 while it is not assigned
+	routes       []insertionRoute
+	deadline     time.Time // Zero means no limit
+	best         float64
+	bestRoutes   []insertionRoute
+	bestAssigned []int // Nil while the best solution is the one of the construction
+	openBound    float64
+	fixed        bool // The committed stops of some asset keep the order of the construction, there is no lower bound
+	dominance    bool // The partial solutions are compared
+	rideTimes    bool // The ride times have limits or costs, so the onboard requests must be dropped off to compare
+	seen         map[exactState][]exactLabel
+}
+
+// exactState are the partial solutions that can be completed the same way
+type exactState struct {
+	asset    int
+	assigned uint64
+	route    uint64
+	onboard  uint64
+	last     int // Pick up 2i or drop off 2i+1 of the request i. -1 for the locked stops, -2-j for the committed drop off j
+}
+
+// exactLabel is a partial solution of a state
+type exactLabel struct {
+	cost  float64
+	ready time.Duration
+}
+
+// exactRoute is the route of the asset being built
+type exactRoute struct {
+	insertionRoute
+	stops    [][2]*model.Stop // Pick up and drop off of every request for the asset. Nil when it can not serve it
+	onboard  []int            // Requests picked up whose drop off is pending
+	dropOffs []*model.Stop    // Drop offs of the committed requests that are not locked
+	pending  []int            // Committed drop offs not appended yet
+	last     int              // Last stop appended, as in exactState
+	ready    time.Duration    // Departure of the last stop appended
+	placed   bool             // The breaks are placed
+	cost     float64
+}
+
+func (a *Exact) Solve(ctx context.Context, p model.Problem) (*model.Solution, error) {
+	algoStart := time.Now()
+	initial, err := a.construction.construct(ctx, p, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &exactSearch{
+		p:          p,
+		index:      make(map[model.Ref]int),
+		best:       initial.Metrics.Value,
+		bestRoutes: a.construction.insertionRoutes(ctx, p, *initial),
+		openBound:  math.Inf(1),
+		rideTimes:  p.Objective.RideTimeCost > 0,
+		seen:       make(map[exactState][]exactLabel),
+	}
+	if a.timeLimit > 0 {
+		s.deadline = algoStart.Add(a.timeLimit)
+	}
+	s.committed = committedRequests(p.Fleet)
+	for i := range p.Requests {
+		if _, ok := s.committed[p.Requests[i].RequestID]; ok {
+			continue
+		}
+		s.index[p.Requests[i].RequestID] = len(s.requests)
+		s.requests = append(s.requests, &p.Requests[i])
+		s.assigned = append(s.assigned, -1)
+		if p.Requests[i].MaxRideTime > 0 || p.Requests[i].MaxDetourFactor > 0 {
+			s.rideTimes = true
+		}
+	}
+	s.dominance = len(s.requests) <= exactMaxDominance
+	if s.bounds, s.insertions, err = a.requestBounds(ctx, p, s.requests); err != nil {
+		return nil, err
+	}
+
+	if err := a.openRoute(ctx, s, 0, 0); err != nil {
+		return nil, err
+	}
+
+	unassigned := initial.Unassigned
+	if s.bestAssigned != nil {
+		if unassigned, err = a.unassigned(ctx, s); err != nil {
+			return nil, err
+		}
+	}
+	sol, err := a.construction.newInsertionSolution(ctx, p, s.bestRoutes, unassigned, algoStart)
+	if err != nil {
+		return nil, err
+	}
+	if s.fixed {
+		a.logger.Debugf("Exact solution value %f without lower bound", sol.Metrics.Value)
+		return sol, nil
+	}
+	bound := math.Min(s.openBound, sol.Metrics.Value)
+	sol.Metrics.LowerBound = &bound
+	a.logger.Debugf("Exact solution value %f, lower bound %f", sol.Metrics.Value, bound)
+	return sol, nil
+}
+
+// The min cost every request adds to the solution. Leaving it unassigned costs its unassigned cost. Serving it costs
+// at least its service times and the ride time. Without end location the route also drives the direct distance.
+// The min cost it adds besides the rest of the requests is also returned. The services of different requests do not
+// overlap, and without end location the route also drives to its stops from the nearest places. Those legs are not
+// shared by the requests either, so the costs of the requests add up
+func (a *Exact) requestBounds(ctx context.Context, p model.Problem, requests model.Requests) ([][2]float64, [][2]float64, error) {
+	bounds := make([][2]float64, len(requests))
+	insertions := make([][2]float64, len(requests))
+	for i, req := range requests {
+		direct, err := a.construction.costEstimator.GetCost(ctx, req.PickUp, req.DropOff)
+		if err != nil {
+			return nil, nil, err
+		}
+		toPickUp, err := a.nearestLeg(ctx, p, req.PickUp, req.RequestID)
+		if err != nil {
+			return nil, nil, err
+		}
+		toDropOff, err := a.nearestLeg(ctx, p, req.DropOff, req.RequestID)
+		if err != nil {
+			return nil, nil, err
+		}
+		toDropOff.Distance = math.Min(toDropOff.Distance, direct.Distance)
+		if direct.Duration < toDropOff.Duration {
+			toDropOff.Duration = direct.Duration
+		}
+
+		service := req.PickUpDuration.For(req.Load) + req.DropOffDuration.For(req.Load)
+		open := model.RouteUsage{Distance: direct.Distance, Duration: service + direct.Duration, RideTime: direct.Duration}
+		closed := model.RouteUsage{Duration: service, RideTime: direct.Duration}
+		reached := model.RouteUsage{
+			Distance: toPickUp.Distance + toDropOff.Distance,
+			Duration: service + toPickUp.Duration + toDropOff.Duration,
+			RideTime: direct.Duration,
+		}
+		unassigned := unassignedCost(p.Objective, *req)
+		bounds[i] = [2]float64{
+			math.Min(unassigned, usageCost(p.Objective, open)),
+			math.Min(unassigned, usageCost(p.Objective, closed)),
+		}
+		insertions[i] = [2]float64{
+			math.Min(unassigned, usageCost(p.Objective, reached)),
+			math.Min(unassigned, usageCost(p.Objective, closed)),
+		}
+	}
+	return bounds, insertions, nil
+}
+
+// The shortest distance and duration to the point from the locations of the assets and the stops of the other
+// requests, the places a route reaches the stops of the request from
+func (a *Exact) nearestLeg(ctx context.Context, p model.Problem, to point.Point, ref model.Ref) (cost.Cost, error) {
+	var from []point.Point
+	for _, asset := range p.Fleet {
+		from = append(from, asset.Location)
+	}
+	for _, req := range p.Requests {
+		if req.RequestID != ref {
+			from = append(from, req.PickUp, req.DropOff)
+		}
+	}
+
+	nearest := cost.Cost{Distance: math.Inf(1), Duration: maxDuration}
+	for _, f := range from {
+		c, err := a.construction.costEstimator.GetCost(ctx, f, to)
+		if err != nil {
+			return cost.Cost{}, err
+		}
+		nearest.Distance = math.Min(nearest.Distance, c.Distance)
+		if c.Duration < nearest.Duration {
+			nearest.Duration = c.Duration
+		}
+	}
+	return nearest, nil
+}
+
+// The cost of the usage besides the cost of the asset. The duration in seconds with the zero objective
+func usageCost(o model.Objective, u model.RouteUsage) float64 {
+	if o.IsZero() {
+		return u.Duration.Seconds()
+	}
+	return o.RouteCost(u).Total - o.VehicleCost
+}
+
+// The route of the asset k starts with its locked stops. After the last asset the solution is complete
+func (a *Exact) openRoute(ctx context.Context, s *exactSearch, k int, closed float64) error {
+	if k == len(s.p.Fleet) {
+		s.complete(closed)
+		return nil
+	}
+
+	asset := s.p.Fleet[k]
+	r, committed, dropOffs := a.construction.addLockedStops(ctx, newAssetRoute(asset, s.p), asset, s.p)
+	if len(dropOffs) > 0 {
+		feasible, planned, err := a.committedRoute(ctx, s, asset)
+		if err != nil {
+			return err
+		}
+		if !feasible {
+			r, dropOffs, s.fixed = planned, nil, true
+		}
+	}
+	er := &exactRoute{
+		insertionRoute: insertionRoute{asset: asset, route: r, changed: true},
+		stops:          make([][2]*model.Stop, len(s.requests)),
+		dropOffs:       dropOffs,
+		last:           -1,
+	}
+	for j := range dropOffs {
+		er.pending = append(er.pending, j)
+	}
+	for _, req := range committed {
+		er.requests = append(er.requests, withoutServiceTimes(*req))
+	}
+	for i, req := range s.requests {
+		if len(assetIncompatibilities(asset, req)) > 0 {
+			continue
+		}
+		pickUp, dropOff := a.construction.newRequestStops(ctx, asset, req, s.p)
+		er.stops[i] = [2]*model.Stop{pickUp, dropOff}
+	}
+	return a.evaluate(ctx, s, k, closed, er, false)
+}
+
+// The committed stops in the order of the construction, and whether they can be served on time in it. When they can
+// not the search keeps that order
+func (a *Exact) committedRoute(ctx context.Context, s *exactSearch, asset model.Asset) (bool, model.Route, error) {
+	r, _, err := a.construction.addCommittedStops(ctx, newAssetRoute(asset, s.p), asset, s.p)
+	if err != nil {
+		return false, nil, err
+	}
+	planned, placed, err := a.construction.withBreaks(ctx, r, asset, s.p.Departure)
+	if err != nil {
+		return false, nil, err
+	}
+	feasible, _ := a.construction.isFeasibleRoute(ctx, planned, asset, s.p.Departure)
+	return feasible && placed, r, nil
+}
+
+// The partial route is scheduled and priced. The infeasible partial routes are pruned, unless they are the locked
+// or fixed committed stops of the asset
+func (a *Exact) evaluate(ctx context.Context, s *exactSearch, k int, closed float64, er *exactRoute, prune bool) error {
+	planned, placed, err := a.construction.withBreaks(ctx, er.route, er.asset, s.p.Departure)
+	if err != nil {
+		return err
+	}
+	if feasible, _ := a.construction.isFeasibleRoute(ctx, planned, er.asset, s.p.Departure); !feasible && prune {
+		return nil
+	}
+	er.placed = placed
+	er.ready = planned[len(planned)-1].GetDepartureTime()
+	if planned[len(planned)-1].IsAssetArrival() {
+		er.ready = planned[len(planned)-2].GetDepartureTime()
+	}
+	er.cost = 0
+	if len(er.requests) > 0 {
+		if er.cost, err = a.construction.scheduledCost(ctx, planned, s.p.Objective); err != nil {
+			return err
+		}
+	}
+	return a.branch(ctx, s, k, closed, er)
+}
+
+// The route is extended with a committed drop off, the drop off of an onboard request or the pick up of a pending
+// one, or it is closed
+func (a *Exact) branch(ctx context.Context, s *exactSearch, k int, closed float64, er *exactRoute) error {
+	lb := closed + er.cost + s.pendingBound(er)
+	if lb >= s.best-exactTolerance {
+		return nil
+	}
+	if ctx.Err() != nil || !s.deadline.IsZero() && time.Now().After(s.deadline) {
+		s.openBound = math.Min(s.openBound, lb)
+		return nil
+	}
+	if s.isDominated(k, closed, er) {
+		return nil
+	}
+
+	for n, j := range er.pending {
+		child := er.with(er.dropOffs[j])
+		child.last = -2 - j
+		child.pending = append(append([]int{}, er.pending[:n]...), er.pending[n+1:]...)
+		if err := a.evaluate(ctx, s, k, closed, child, true); err != nil {
+			return err
+		}
+	}
+
+	for j, i := range er.onboard {
+		child := er.with(er.stops[i][1])
+		child.last = 2*i + 1
+		child.onboard = append(append([]int{}, er.onboard[:j]...), er.onboard[j+1:]...)
+		if err := a.evaluate(ctx, s, k, closed, child, true); err != nil {
+			return err
+		}
+	}
+
+	for i, req := range s.requests {
+		if s.assigned[i] >= 0 || er.stops[i][0] == nil || !s.canJoin(k, i, er) {
+			continue
+		}
+		child := er.with(er.stops[i][0])
+		child.last = 2 * i
+		child.onboard = append(append([]int{}, er.onboard...), i)
+		child.requests = append(append([]model.Request{}, er.requests...), withoutServiceTimes(*req))
+		s.assigned[i] = k
+		err := a.evaluate(ctx, s, k, closed, child, true)
+		s.assigned[i] = -1
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(er.onboard) > 0 || len(er.pending) > 0 || !er.placed || !s.isGroupComplete(k) {
+		return nil
+	}
+	s.routes = append(s.routes, er.insertionRoute)
+	err := a.openRoute(ctx, s, k+1, closed+er.cost)
+	s.routes = s.routes[:len(s.routes)-1]
+	return err
+}
+
+func (er *exactRoute) with(stop *model.Stop) *exactRoute {
+	child := *er
+	child.route = insertBeforeEnd(er.route, stop)
+	return &child
+}
+
+// Every pending request adds at least its bound to the solution, so the most expensive one is a lower bound.
+// The sum of the min costs they add besides the rest is a lower bound too
+func (s *exactSearch) pendingBound(er *exactRoute) float64 {
+	side := 0
+	if er.asset.EndLocation != nil {
+		side = 1
+	}
+	bound, insertions := 0.0, 0.0
+	for i := range s.requests {
+		if s.assigned[i] < 0 {
+			bound = math.Max(bound, s.bounds[i][side])
+			insertions += s.insertions[i][side]
+		}
+	}
+	return math.Max(bound, insertions)
+}
+
+// A partial solution is dominated by a seen one of the same state when it is not cheaper and it is not ready
+// earlier. The waiting costs of the difference of time are added, as the earlier one can wait more. The routes with
+// breaks or max distance, the routes with committed drop offs pending, and the routes with onboard requests when the
+// ride times matter, are not compared
+func (s *exactSearch) isDominated(k int, closed float64, er *exactRoute) bool {
+	if !s.dominance || len(er.asset.Breaks) > 0 || er.asset.MaxDistance > 0 || len(er.pending) > 0 ||
+		len(er.onboard) > 0 && s.rideTimes {
+		return false
+	}
+	state := exactState{asset: k, last: er.last}
+	for i, k2 := range s.assigned {
+		if k2 >= 0 {
+			state.assigned |= 1 << uint(i)
+		}
+		if k2 == k {
+			state.route |= 1 << uint(i)
+		}
+	}
+	for _, i := range er.onboard {
+		state.onboard |= 1 << uint(i)
+	}
+
+	label := exactLabel{cost: closed + er.cost, ready: er.ready}
+	labels := s.seen[state]
+	for _, l := range labels {
+		wait := 0.0
+		if label.ready < l.ready {
+			wait = s.p.Objective.WaitingCost * (l.ready - label.ready).Minutes()
+		}
+		if l.ready <= label.ready && l.cost <= label.cost+exactTolerance-wait {
+			return true
+		}
+	}
+	s.seen[state] = append(labels, label)
+	return false
+}
+
+// The request can not share the route with an incompatible one nor be apart from the assigned or committed requests
+// of its group
+func (s *exactSearch) canJoin(k, i int, er *exactRoute) bool {
+	req := s.requests[i]
+	if len(incompatibilities(er.asset, []*model.Request{req}, er.requests, s.p.Constraints)) > 0 {
+		return false
+	}
+	if assetID, ok := groupAsset(s.committed, req.RequestID, s.p.Constraints); ok && assetID != er.asset.AssetID {
+		return false
+	}
+	for _, ref := range s.p.Constraints.GroupOf(req.RequestID) {
+		if j, ok := s.index[ref]; ok && s.assigned[j] >= 0 && s.assigned[j] != k {
+			return false
+		}
+	}
+	return true
+}
+
+// The groups of the requests of the route k are assigned to it
+func (s *exactSearch) isGroupComplete(k int) bool {
+	for i, req := range s.requests {
+		if s.assigned[i] != k {
+			continue
+		}
+		for _, ref := range s.p.Constraints.GroupOf(req.RequestID) {
+			if j, ok := s.index[ref]; ok && s.assigned[j] != k {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// The value of the complete solution is the cost of its routes and its unassigned requests
+func (s *exactSearch) complete(closed float64) {
+	value := closed
+	for i, req := range s.requests {
+		if s.assigned[i] < 0 {
+			value += unassignedCost(s.p.Objective, *req)
+		}
+	}
+	if value >= s.best-exactTolerance {
+		return
+	}
+
+	s.best = value
+	s.bestRoutes = make([]insertionRoute, len(s.routes))
+	for k, ir := range s.routes {
+		ir.route = append(model.Route{}, ir.route...)
+		s.bestRoutes[k] = ir
+	}
+	s.bestAssigned = append([]int{}, s.assigned...)
+}
+
+// The unassigned requests of the best solution with the constraints they violate in every route
+func (a *Exact) unassigned(ctx context.Context, s *exactSearch) ([]model.UnassignedRequest, error) {
+	var unassigned []model.UnassignedRequest
+	for i, req := range s.requests {
+		if s.bestAssigned[i] >= 0 {
+			continue
+		}
+		reasons, err := a.construction.unassignedReasons(ctx, s.p, s.bestRoutes, req)
+		if err != nil {
+			return nil, err
+		}
+		unassigned = append(unassigned, model.UnassignedRequest{Request: withoutServiceTimes(*req), Reasons: reasons})
+	}
+	return unassigned, nil
+}
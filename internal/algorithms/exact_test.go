@@ -0,0 +1,236 @@
+package algorithms
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/edusalguero/roteiro.git/internal/distanceestimator"
+	"github.com/edusalguero/roteiro.git/internal/logger"
+	"github.com/edusalguero/roteiro.git/internal/model"
+	"github.com/edusalguero/roteiro.git/internal/point"
+	"github.com/edusalguero/roteiro.git/internal/routeestimator"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExact_Solve(t *testing.T) {
+	e := distanceestimator.NewHaversineDistanceEstimator(80)
+	algo := NewExact(logger.NewNopLogger(), routeestimator.NewEstimator(e), e, time.Minute)
+
+	p := model.Problem{
+		Fleet: []model.Asset{
+			{AssetID: "Miño Asset", Location: minoLoc, Capacity: model.NewCapacity(1)},
+			{AssetID: "As Pontes Asset", Location: aspontesLoc, Capacity: model.NewCapacity(1)},
+		},
+		Requests: []model.Request{
+			{
+				RequestID:        "As Pontes - Sada",
+				PickUp:           aspontesLoc,
+				DropOff:          sadaLoc,
+				Load:             model.NewLoad(1),
+				PickUpTimeWindow: model.TimeWindow{Latest: departure.Add(25 * time.Minute)},
+			},
+			{
+				RequestID:        "Miño - Sada",
+				PickUp:           minoLoc,
+				DropOff:          sadaLoc,
+				Load:             model.NewLoad(1),
+				PickUpTimeWindow: model.TimeWindow{Latest: departure.Add(5 * time.Minute)},
+			},
+		},
+		Constraints: model.Constraints{
+			MaxJourneyTimeFactor: 1.5,
+		},
+		Departure: departure,
+	}
+
+	got, err := algo.Solve(context.Background(), p)
+	assert.NoError(t, err)
+	assert.Equal(t, []Route{{minoLoc, sadaLoc}, {aspontesLoc, sadaLoc}}, getTestRoutes(t, got.Routes))
+	assert.Empty(t, got.Unassigned)
+	assert.NotNil(t, got.Metrics.LowerBound)
+	assert.Equal(t, got.Metrics.Value, *got.Metrics.LowerBound)
+	gap, ok := got.Metrics.OptimalityGap()
+	assert.True(t, ok)
+	assert.Zero(t, gap)
+}
+
+func TestExact_Solve_NotWorseThanHeuristics(t *testing.T) {
+	e := distanceestimator.NewHaversineDistanceEstimator(80)
+	exact := NewExact(logger.NewNopLogger(), routeestimator.NewEstimator(e), e, time.Minute)
+	heuristics := map[string]Algorithm{
+		SequentialConstructionName: NewSequentialConstruction(logger.NewNopLogger(), routeestimator.NewEstimator(e), e),
+		LocalSearchName:            NewLocalSearch(logger.NewNopLogger(), routeestimator.NewEstimator(e), e, time.Second),
+		ALNSName:                   NewALNS(logger.NewNopLogger(), routeestimator.NewEstimator(e), e, time.Minute, 100),
+	}
+
+	p := model.Problem{
+		Fleet: []model.Asset{
+			{AssetID: "Miño Asset", Location: minoLoc, Capacity: model.NewCapacity(2)},
+			{AssetID: "As Pontes Asset", Location: aspontesLoc, Capacity: model.NewCapacity(2)},
+		},
+		Requests: []model.Request{
+			{RequestID: "Miño - Sada", PickUp: minoLoc, DropOff: sadaLoc, Load: model.NewLoad(1)},
+			{RequestID: "As Pontes - Sada", PickUp: aspontesLoc, DropOff: sadaLoc, Load: model.NewLoad(1)},
+			{RequestID: "Vilalba - Pontedeume", PickUp: vilalbaLoc, DropOff: pontedeumeLoc, Load: model.NewLoad(1)},
+			{RequestID: "Sada - Miño", PickUp: sadaLoc, DropOff: minoLoc, Load: model.NewLoad(2)},
+		},
+		Constraints: model.Constraints{
+			MaxJourneyTimeFactor: 2,
+		},
+		Departure: departure,
+	}
+
+	got, err := exact.Solve(context.Background(), p)
+	assert.NoError(t, err)
+	assert.Equal(t, got.Metrics.Value, *got.Metrics.LowerBound)
+	for name, algo := range heuristics {
+		s, err := algo.Solve(context.Background(), p)
+		assert.NoError(t, err)
+		assert.LessOrEqualf(t, got.Metrics.Value, s.Metrics.Value+exactTolerance, "%s is better than the exact solution", name)
+	}
+}
+
+func TestExact_Solve_TimeLimit(t *testing.T) {
+	e := distanceestimator.NewHaversineDistanceEstimator(80)
+	algo := NewExact(logger.NewNopLogger(), routeestimator.NewEstimator(e), e, time.Nanosecond)
+
+	p := model.Problem{
+		Fleet: []model.Asset{
+			{AssetID: "Miño Asset", Location: minoLoc, Capacity: model.NewCapacity(2)},
+		},
+		Requests: []model.Request{
+			{RequestID: "Miño - Sada", PickUp: minoLoc, DropOff: sadaLoc, Load: model.NewLoad(1)},
+			{RequestID: "As Pontes - Sada", PickUp: aspontesLoc, DropOff: sadaLoc, Load: model.NewLoad(1)},
+		},
+		Constraints: model.Constraints{
+			MaxJourneyTimeFactor: 2,
+		},
+		Departure: departure,
+	}
+
+	// The search stops at once with the solution of the construction
+	got, err := algo.Solve(context.Background(), p)
+	assert.NoError(t, err)
+	assert.NotNil(t, got.Metrics.LowerBound)
+	assert.Less(t, *got.Metrics.LowerBound, got.Metrics.Value)
+	gap, ok := got.Metrics.OptimalityGap()
+	assert.True(t, ok)
+	assert.Greater(t, gap, 0.0)
+	assert.LessOrEqual(t, gap, 1.0)
+}
+
+func TestExact_Solve_TimeLimitBound(t *testing.T) {
+	e := distanceestimator.NewHaversineDistanceEstimator(80)
+	algo := NewExact(logger.NewNopLogger(), routeestimator.NewEstimator(e), e, time.Nanosecond)
+
+	p := model.Problem{
+		Fleet: []model.Asset{
+			{AssetID: "Vilalba Asset", Location: vilalbaLoc, Capacity: model.NewCapacity(2)},
+		},
+		Requests: []model.Request{
+			{RequestID: "Miño - Sada", PickUp: minoLoc, DropOff: sadaLoc, Load: model.NewLoad(1)},
+			{RequestID: "As Pontes - Pontevedra", PickUp: aspontesLoc, DropOff: pontevedraLoc, Load: model.NewLoad(1)},
+		},
+		Constraints: model.Constraints{
+			MaxJourneyTimeFactor: 2,
+		},
+		Departure: departure,
+	}
+	duration := func(from, to point.Point) time.Duration {
+		c, err := e.GetCost(context.Background(), from, to)
+		assert.NoError(t, err)
+		return c.Duration
+	}
+
+	// The search stops at once. The stops of Miño - Sada are reached from As Pontes and Miño, and leaving As Pontes -
+	// Pontevedra unassigned costs less than reaching its stops
+	got, err := algo.Solve(context.Background(), p)
+	assert.NoError(t, err)
+	reached := duration(aspontesLoc, minoLoc) + duration(minoLoc, sadaLoc) + alnsUnassignedCost
+	assert.InDelta(t, reached.Seconds(), *got.Metrics.LowerBound, 1e-6)
+	assert.Less(t, *got.Metrics.LowerBound, got.Metrics.Value)
+}
+
+func TestExact_Solve_GroupWithOnboardRequest(t *testing.T) {
+	e := distanceestimator.NewHaversineDistanceEstimator(80)
+	algo := NewExact(logger.NewNopLogger(), routeestimator.NewEstimator(e), e, time.Minute)
+
+	p := model.Problem{
+		Fleet: []model.Asset{
+			{AssetID: "small", Location: aspontesLoc, Capacity: model.NewCapacity(1), OnboardRequests: []model.Ref{"a"}},
+			{AssetID: "big", Location: aspontesLoc, Capacity: model.NewCapacity(4)},
+		},
+		Requests: []model.Request{
+			{RequestID: "a", PickUp: aspontesLoc, DropOff: sadaLoc, Load: model.NewLoad(1)},
+			{RequestID: "b", PickUp: aspontesLoc, DropOff: sadaLoc, Load: model.NewLoad(1)},
+		},
+		Constraints: model.Constraints{
+			MaxJourneyTimeFactor: 1.5,
+			SameVehicleGroups:    []model.RequestGroup{{"a", "b"}},
+		},
+		Departure: departure,
+	}
+
+	got, err := algo.Solve(context.Background(), p)
+	assert.NoError(t, err)
+	for _, r := range got.Routes {
+		for _, req := range r.Requests {
+			assert.NotEqual(t, model.Ref("b"), req.RequestID, "b is served by %s", r.Asset.AssetID)
+		}
+	}
+	assert.Len(t, got.Unassigned, 1)
+	assert.Equal(t, model.Ref("b"), got.Unassigned[0].RequestID)
+}
+
+func TestExact_Solve_OnboardRequests(t *testing.T) {
+	e := distanceestimator.NewHaversineDistanceEstimator(80)
+	algo := NewExact(logger.NewNopLogger(), routeestimator.NewEstimator(e), e, time.Minute)
+
+	p := model.Problem{
+		Fleet: []model.Asset{
+			{
+				AssetID:         "Miño Asset",
+				Location:        minoLoc,
+				Capacity:        model.NewCapacity(3),
+				OnboardRequests: []model.Ref{"As Pontes - Pontedeume", "As Pontes - Miño"},
+			},
+		},
+		Requests: []model.Request{
+			{RequestID: "As Pontes - Pontedeume", PickUp: aspontesLoc, DropOff: pontedeumeLoc, Load: model.NewLoad(1)},
+			{RequestID: "As Pontes - Miño", PickUp: aspontesLoc, DropOff: minoLoc, Load: model.NewLoad(1)},
+			{RequestID: "Miño - As Pontes", PickUp: minoLoc, DropOff: aspontesLoc, Load: model.NewLoad(1)},
+			{
+				RequestID:        "Miño - Vilalba",
+				PickUp:           minoLoc,
+				DropOff:          vilalbaLoc,
+				Load:             model.NewLoad(1),
+				PickUpTimeWindow: model.TimeWindow{Latest: departure.Add(39 * time.Minute)},
+			},
+		},
+		Constraints: model.Constraints{
+			MaxJourneyTimeFactor: 2,
+		},
+		Departure: departure,
+	}
+
+	// The construction drops off the onboard request at Pontedeume before coming back for the new ones
+	got, err := algo.Solve(context.Background(), p)
+	assert.NoError(t, err)
+	assert.Equal(t, []Route{{minoLoc, pontedeumeLoc, aspontesLoc, vilalbaLoc}}, getTestRoutes(t, got.Routes))
+	assert.Empty(t, got.Unassigned)
+	assert.NotNil(t, got.Metrics.LowerBound)
+	assert.InDelta(t, got.Metrics.Value, *got.Metrics.LowerBound, 1e-6)
+
+	t.Run("Onboard request that can not be dropped off on time", func(t *testing.T) {
+		late := p
+		late.Requests = append([]model.Request{}, p.Requests...)
+		late.Requests[0].DropOffTimeWindow = model.TimeWindow{Latest: departure.Add(time.Minute)}
+
+		got, err := algo.Solve(context.Background(), late)
+		assert.NoError(t, err)
+		assert.Nil(t, got.Metrics.LowerBound)
+		_, ok := got.Metrics.OptimalityGap()
+		assert.False(t, ok)
+	})
+}
@@ -0,0 +1,450 @@
+package algorithms
+
+import (
+	"context"
+	"time"
+
+	"github.com/edusalguero/roteiro.git/internal/cost"
+	"github.com/edusalguero/roteiro.git/internal/logger"
+	"github.com/edusalguero/roteiro.git/internal/model"
+	"github.com/edusalguero/roteiro.git/internal/routeestimator"
+)
+
+// LocalSearch improves the initial solution of the sequential construction moving requests between routes with the
+// pair relocate, pair exchange and 2-opt* operators, until there is no improvement or the time budget runs out.
+// Using fewer assets is better than a shorter total duration
+type LocalSearch struct {
+	logger       logger.Logger
+	construction *SequentialConstruction
+	budget       time.Duration
+}
+
+func NewLocalSearch(l logger.Logger, e routeestimator.Estimator, de cost.Service, budget time.Duration) *LocalSearch {
+	return &LocalSearch{logger: l, construction: NewSequentialConstruction(l, e, de), budget: budget}
+}
+
+const LocalSearchName = "local_search"
+
+// The default time budget is given by the solver
+func LocalSearchDefinition(budget time.Duration) Definition {
+	return Definition{
+		Name:        LocalSearchName,
+		Description: "Improves the sequential construction moving requests between routes to use fewer assets and less time",
+		Parameters: []Parameter{
+			{
+				Name:        "time_budget",
+				Type:        ParameterTypeDuration,
+				Description: "Max duration of the improvement phase",
+				Default:     float64(budget),
+			},
+		},
+		New: func(l logger.Logger, e routeestimator.Estimator, de cost.Service, params Parameters) Algorithm {
+			return NewLocalSearch(l, e, de, params.Duration("time_budget"))
+		},
+	}
+}
+
+func (a *LocalSearch) Solve(ctx context.Context, p model.Problem) (*model.Solution, error) {
+	algoStart := time.Now()
+	s, err := a.construction.Solve(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+
+	improved, err := a.Improve(ctx, p, *s, algoStart.Add(a.budget))
+	if err != nil {
+		return nil, err
+	}
+	improved.Metrics.SolvedTime = time.Since(algoStart)
+	return improved, nil
+}
+
+// Improve applies the first improving move of the operators, one after another, until none of them improves the
+// solution, the deadline is reached or the context is done. The unassigned requests are kept as they are
+func (a *LocalSearch) Improve(ctx context.Context, p model.Problem, s model.Solution, deadline time.Time) (*model.Solution, error) {
+	algoStart := time.Now()
+	routes := a.construction.insertionRoutes(ctx, p, s)
+	operators := []func(context.Context, model.Problem, []insertionRoute, time.Time) (bool, error){
+		a.relocate,
+		a.exchange,
+		a.twoOptStar,
+	}
+
+	for improved := true; improved && !isStopped(ctx, deadline); {
+		improved = false
+		for _, operator := range operators {
+			ok, err := operator(ctx, p, routes, deadline)
+			if err != nil {
+				return nil, err
+			}
+			improved = improved || ok
+		}
+	}
+
+	return a.construction.newInsertionSolution(ctx, p, routes, s.Unassigned, algoStart)
+}
+
+// The search stops at the deadline or when the context is done
+func isStopped(ctx context.Context, deadline time.Time) bool {
+	return ctx.Err() != nil || time.Now().After(deadline)
+}
+
+// Pair relocate moves the pick up and drop off of a request to the cheapest position of another route
+func (a *LocalSearch) relocate(ctx context.Context, p model.Problem, routes []insertionRoute, deadline time.Time) (bool, error) {
+	for from := range routes {
+		for _, req := range routes[from].requests {
+			if !isMovable(routes[from].asset, req.RequestID, p.Constraints) {
+				continue
+			}
+			source := withoutRequest(routes[from], req)
+			for to := range routes {
+				if isStopped(ctx, deadline) {
+					return false, nil
+				}
+				if to == from {
+					continue
+				}
+				target, ok, err := a.withRequest(ctx, p, routes[to], req)
+				if err != nil {
+					return false, err
+				}
+				if !ok {
+					continue
+				}
+
+				better, err := a.isImprovement(ctx, p, []insertionRoute{routes[from], routes[to]}, []insertionRoute{source, target})
+				if err != nil {
+					return false, err
+				}
+				if better {
+					a.logger.Debugf("Relocate %s from %s to %s", req.RequestID, routes[from].asset.AssetID, routes[to].asset.AssetID)
+					routes[from], routes[to] = source, target
+					return true, nil
+				}
+			}
+		}
+	}
+	return false, nil
+}
+
+// Pair exchange swaps two requests of different routes, every one to the cheapest position of the other route
+func (a *LocalSearch) exchange(ctx context.Context, p model.Problem, routes []insertionRoute, deadline time.Time) (bool, error) {
+	for r1 := range routes {
+		for r2 := r1 + 1; r2 < len(routes); r2++ {
+			for _, req1 := range routes[r1].requests {
+				if !isMovable(routes[r1].asset, req1.RequestID, p.Constraints) {
+					continue
+				}
+				for _, req2 := range routes[r2].requests {
+					if isStopped(ctx, deadline) {
+						return false, nil
+					}
+					if !isMovable(routes[r2].asset, req2.RequestID, p.Constraints) {
+						continue
+					}
+
+					first, ok, err := a.withRequest(ctx, p, withoutRequest(routes[r1], req1), req2)
+					if err != nil {
+						return false, err
+					}
+					if !ok {
+						continue
+					}
+					second, ok, err := a.withRequest(ctx, p, withoutRequest(routes[r2], req2), req1)
+					if err != nil {
+						return false, err
+					}
+					if !ok {
+						continue
+					}
+
+					better, err := a.isImprovement(ctx, p, []insertionRoute{routes[r1], routes[r2]}, []insertionRoute{first, second})
+					if err != nil {
+						return false, err
+					}
+					if better {
+						a.logger.Debugf("Exchange %s of %s and %s of %s",
+							req1.RequestID, routes[r1].asset.AssetID, req2.RequestID, routes[r2].asset.AssetID)
+						routes[r1], routes[r2] = first, second
+						return true, nil
+					}
+				}
+			}
+		}
+	}
+	return false, nil
+}
+
+// 2-opt* for pick up and delivery swaps the tails of two routes. The routes are only cut where the asset has no
+// request on board, so the pick up and the drop off of every request stay in the same route
+func (a *LocalSearch) twoOptStar(ctx context.Context, p model.Problem, routes []insertionRoute, deadline time.Time) (bool, error) {
+	for r1 := range routes {
+		for r2 := r1 + 1; r2 < len(routes); r2++ {
+			for _, i := range cutPositions(routes[r1], p.Constraints) {
+				for _, j := range cutPositions(routes[r2], p.Constraints) {
+					if isStopped(ctx, deadline) {
+						return false, nil
+					}
+					first, second, ok, err := a.swapTails(ctx, p, routes[r1], i, routes[r2], j)
+					if err != nil {
+						return false, err
+					}
+					if !ok {
+						continue
+					}
+
+					better, err := a.isImprovement(ctx, p, []insertionRoute{routes[r1], routes[r2]}, []insertionRoute{first, second})
+					if err != nil {
+						return false, err
+					}
+					if better {
+						a.logger.Debugf("2-opt* of %s and %s", routes[r1].asset.AssetID, routes[r2].asset.AssetID)
+						routes[r1], routes[r2] = first, second
+						return true, nil
+					}
+				}
+			}
+		}
+	}
+	return false, nil
+}
+
+// The committed requests stay with their asset and the requests of a same vehicle group are not split
+func isMovable(asset model.Asset, ref model.Ref, c model.Constraints) bool {
+	if asset.IsOnboard(ref) || len(c.GroupOf(ref)) > 1 {
+		return false
+	}
+	for _, ls := range asset.LockedStops {
+		if ls.RequestID == ref {
+			return false
+		}
+	}
+	return true
+}
+
+func withoutRequest(ir insertionRoute, req model.Request) insertionRoute {
+	var requests []model.Request
+	for _, r := range ir.requests {
+		if r.RequestID != req.RequestID {
+			requests = append(requests, r)
+		}
+	}
+	ir.route = removeFromRoute(ir.route, req)
+	ir.requests = requests
+	ir.changed = true
+	return ir
+}
+
+// The request is inserted in the cheapest feasible position of the route. It returns false when there is none
+func (a *LocalSearch) withRequest(
+	ctx context.Context,
+	p model.Problem,
+	ir insertionRoute,
+	req model.Request,
+) (insertionRoute, bool, error) {
+	if found := incompatibilities(ir.asset, []*model.Request{&req}, ir.requests, p.Constraints); len(found) > 0 {
+		return ir, false, nil
+	}
+	r, _, err := a.construction.cheapestInsertion(ctx, &ir, &req, p)
+	if err != nil || r == nil {
+		return ir, false, err
+	}
+	ir.route = r
+	ir.requests = append(append([]model.Request{}, ir.requests...), req)
+	ir.changed = true
+	return ir, true, nil
+}
+
+// The positions after the committed stops where the asset has no request on board
+func cutPositions(ir insertionRoute, c model.Constraints) []int {
+	last := len(ir.route)
+	if ir.route[last-1].IsAssetArrival() {
+		last--
+	}
+
+	first := 1
+	for i := 1; i < last; i++ {
+		if !isMovable(ir.asset, ir.route[i].Ref, c) {
+			first = i + 1
+		}
+	}
+
+	var positions []int
+	onBoard := make(map[model.Ref]bool)
+	for i := 1; i <= last; i++ {
+		if i >= first && len(onBoard) == 0 {
+			positions = append(positions, i)
+		}
+		if i == last {
+			break
+		}
+		stop := ir.route[i]
+		switch stop.Activity {
+		case model.ActivityTypePickUp:
+			onBoard[stop.Ref] = true
+		case model.ActivityTypeDropOff:
+			delete(onBoard, stop.Ref)
+		}
+	}
+	return positions
+}
+
+// The stops of the first route from i are exchanged with the stops of the second route from j.
+// Every asset keeps its end location. It returns false when the new routes are not valid
+func (a *LocalSearch) swapTails(
+	ctx context.Context,
+	p model.Problem,
+	ir1 insertionRoute,
+	i int,
+	ir2 insertionRoute,
+	j int,
+) (insertionRoute, insertionRoute, bool, error) {
+	tail1, moved1 := a.tail(ctx, p, ir1, i, ir2.asset)
+	tail2, moved2 := a.tail(ctx, p, ir2, j, ir1.asset)
+	if len(moved1) == 0 && len(moved2) == 0 {
+		return ir1, ir2, false, nil
+	}
+
+	first, ok := withTail(ir1, i, tail2, moved1, moved2, p.Constraints)
+	if !ok {
+		return ir1, ir2, false, nil
+	}
+	second, ok := withTail(ir2, j, tail1, moved2, moved1, p.Constraints)
+	if !ok {
+		return ir1, ir2, false, nil
+	}
+
+	for _, ir := range []insertionRoute{first, second} {
+		feasible, err := a.isFeasible(ctx, p, ir)
+		if err != nil || !feasible {
+			return ir1, ir2, false, err
+		}
+	}
+	return first, second, true, nil
+}
+
+// The stops of the route from i, built for the other asset, and their requests
+func (a *LocalSearch) tail(
+	ctx context.Context,
+	p model.Problem,
+	ir insertionRoute,
+	i int,
+	asset model.Asset,
+) (model.Route, []model.Request) {
+	last := len(ir.route)
+	if ir.route[last-1].IsAssetArrival() {
+		last--
+	}
+
+	var tail model.Route
+	var moved []model.Request
+	stops := make(map[model.Ref][2]*model.Stop)
+	for _, stop := range ir.route[i:last] {
+		if _, ok := stops[stop.Ref]; !ok {
+			req := findRequest(p.Requests, stop.Ref)
+			if req == nil {
+				continue
+			}
+			pickUp, dropOff := a.construction.newRequestStops(ctx, asset, req, p)
+			stops[stop.Ref] = [2]*model.Stop{pickUp, dropOff}
+			moved = append(moved, withoutServiceTimes(*req))
+		}
+		if stop.Activity == model.ActivityTypePickUp {
+			tail = append(tail, stops[stop.Ref][0])
+		} else {
+			tail = append(tail, stops[stop.Ref][1])
+		}
+	}
+	return tail, moved
+}
+
+// The stops of the route from i are replaced with the tail. It returns false when the requests of the tail
+// can not be served by the asset
+func withTail(
+	ir insertionRoute,
+	i int,
+	tail model.Route,
+	removed []model.Request,
+	added []model.Request,
+	c model.Constraints,
+) (insertionRoute, bool) {
+	var kept []model.Request
+	for _, req := range ir.requests {
+		if !containsRequest(removed, req.RequestID) {
+			kept = append(kept, req)
+		}
+	}
+	for k := range added {
+		if found := incompatibilities(ir.asset, []*model.Request{&added[k]}, kept, c); len(found) > 0 {
+			return ir, false
+		}
+	}
+
+	route := make(model.Route, 0, i+len(tail)+1)
+	route = append(route, ir.route[:i]...)
+	route = append(route, tail...)
+	if end := ir.route[len(ir.route)-1]; end.IsAssetArrival() {
+		route = append(route, end)
+	}
+
+	ir.route = route
+	ir.requests = append(kept, added...)
+	ir.changed = true
+	return ir, true
+}
+
+func containsRequest(requests []model.Request, ref model.Ref) bool {
+	for _, req := range requests {
+		if req.RequestID == ref {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *LocalSearch) isFeasible(ctx context.Context, p model.Problem, ir insertionRoute) (bool, error) {
+	if len(ir.requests) == 0 {
+		return true, nil
+	}
+	planned, placed, err := a.construction.withBreaks(ctx, ir.route, ir.asset, p.Departure)
+	if err != nil {
+		return false, err
+	}
+	feasible, _ := a.construction.isFeasibleRoute(ctx, planned, ir.asset, p.Departure)
+	return feasible && placed, nil
+}
+
+// The new routes are better when they use fewer assets, or the same assets with a shorter total duration.
+// With an objective they are better when they cost less
+func (a *LocalSearch) isImprovement(ctx context.Context, p model.Problem, current, candidate []insertionRoute) (bool, error) {
+	currentAssets, currentCost, err := a.objective(ctx, p, current)
+	if err != nil {
+		return false, err
+	}
+	candidateAssets, candidateCost, err := a.objective(ctx, p, candidate)
+	if err != nil {
+		return false, err
+	}
+	if p.Objective.IsZero() && candidateAssets != currentAssets {
+		return candidateAssets < currentAssets, nil
+	}
+	return candidateCost < currentCost, nil
+}
+
+// The used assets and the total cost of the routes. The routes without requests are not used
+func (a *LocalSearch) objective(ctx context.Context, p model.Problem, routes []insertionRoute) (int, float64, error) {
+	assets := 0
+	total := 0.0
+	for _, ir := range routes {
+		if len(ir.requests) == 0 {
+			continue
+		}
+		c, err := a.construction.routeCost(ctx, ir.route, ir.asset, p)
+		if err != nil {
+			return 0, 0, err
+		}
+		assets++
+		total += c
+	}
+	return assets, total, nil
+}
@@ -0,0 +1,98 @@
+package algorithms
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/edusalguero/roteiro.git/internal/distanceestimator"
+	"github.com/edusalguero/roteiro.git/internal/logger"
+	"github.com/edusalguero/roteiro.git/internal/model"
+	"github.com/edusalguero/roteiro.git/internal/routeestimator"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLocalSearch_Improve(t *testing.T) {
+	e := distanceestimator.NewHaversineDistanceEstimator(80)
+	algo := NewLocalSearch(logger.NewNopLogger(), routeestimator.NewEstimator(e), e, time.Second)
+
+	minoAsset := model.Asset{
+		AssetID:  "Miño Asset",
+		Location: minoLoc,
+		Capacity: model.NewCapacity(1),
+	}
+	aspontesAsset := model.Asset{
+		AssetID:  "As Pontes Asset",
+		Location: aspontesLoc,
+		Capacity: model.NewCapacity(1),
+	}
+	minoReq := model.Request{
+		RequestID: "Miño - Sada",
+		PickUp:    minoLoc,
+		DropOff:   sadaLoc,
+		Load:      model.NewLoad(1),
+	}
+	aspontesReq := model.Request{
+		RequestID: "As Pontes - Sada",
+		PickUp:    aspontesLoc,
+		DropOff:   sadaLoc,
+		Load:      model.NewLoad(1),
+	}
+	p := model.Problem{
+		Fleet:    []model.Asset{minoAsset, aspontesAsset},
+		Requests: []model.Request{minoReq, aspontesReq},
+		Constraints: model.Constraints{
+			MaxJourneyTimeFactor: 1.5,
+		},
+		Departure: departure,
+	}
+
+	// Every request is pinned to the farthest asset
+	pinned := p
+	pinned.Requests = []model.Request{minoReq, aspontesReq}
+	pinned.Requests[0].AssetID = aspontesAsset.AssetID
+	pinned.Requests[1].AssetID = minoAsset.AssetID
+	s, err := algo.construction.Solve(context.Background(), pinned)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, s.Metrics.NumAssets)
+
+	got, err := algo.Improve(context.Background(), p, *s, time.Now().Add(time.Second))
+	assert.NoError(t, err)
+	assert.Equal(t, []Route{{aspontesLoc, sadaLoc, minoLoc, sadaLoc}}, getTestRoutes(t, got.Routes))
+	assert.Equal(t, aspontesAsset.AssetID, got.Routes[0].Asset.AssetID)
+	assert.Equal(t, 1, got.Metrics.NumAssets)
+	assert.Equal(t, 2, got.Metrics.NumRequests)
+	assert.Empty(t, got.Unassigned)
+}
+
+func TestLocalSearch_Solve(t *testing.T) {
+	e := distanceestimator.NewHaversineDistanceEstimator(80)
+	construction := NewSequentialConstruction(logger.NewNopLogger(), routeestimator.NewEstimator(e), e)
+	algo := NewLocalSearch(logger.NewNopLogger(), routeestimator.NewEstimator(e), e, time.Second)
+
+	p := model.Problem{
+		Fleet: []model.Asset{
+			{AssetID: "Miño Asset", Location: minoLoc, Capacity: model.NewCapacity(2)},
+			{AssetID: "As Pontes Asset", Location: aspontesLoc, Capacity: model.NewCapacity(2)},
+		},
+		Requests: []model.Request{
+			{RequestID: "Miño - Sada", PickUp: minoLoc, DropOff: sadaLoc, Load: model.NewLoad(1)},
+			{RequestID: "As Pontes - Sada", PickUp: aspontesLoc, DropOff: sadaLoc, Load: model.NewLoad(1)},
+			{RequestID: "Sada - Miño", PickUp: sadaLoc, DropOff: minoLoc, Load: model.NewLoad(1)},
+		},
+		Constraints: model.Constraints{
+			MaxJourneyTimeFactor: 2,
+		},
+		Departure: departure,
+	}
+	initial, err := construction.Solve(context.Background(), p)
+	assert.NoError(t, err)
+	got, err := algo.Solve(context.Background(), p)
+	assert.NoError(t, err)
+
+	assert.Equal(t, initial.Metrics.NumRequests, got.Metrics.NumRequests)
+	assert.LessOrEqual(t, got.Metrics.NumAssets, initial.Metrics.NumAssets)
+	if got.Metrics.NumAssets == initial.Metrics.NumAssets {
+		assert.LessOrEqual(t, int64(got.Metrics.Duration), int64(initial.Metrics.Duration))
+	}
+}
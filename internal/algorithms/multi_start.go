@@ -0,0 +1,155 @@
+package algorithms
+
+import (
+	"context"
+	"math/rand"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/edusalguero/roteiro.git/internal/cost"
+	"github.com/edusalguero/roteiro.git/internal/logger"
+	"github.com/edusalguero/roteiro.git/internal/model"
+	"github.com/edusalguero/roteiro.git/internal/routeestimator"
+)
+
+const (
+	multiStartDefaultStarts = 32  // When the starts are not given
+	multiStartNoise         = 0.3 // Max relative change of the distances sorting the requests
+)
+
+// MultiStart runs the sequential construction many times at the same time, every one opening the assets and trying
+// the requests in a different order, and keeps the solution of the minimum value. The first start is the plain
+// construction, so the solution is never worse than its one. The orders are given by the seed of the problem and
+// the number of the start, the solution is the same whatever the number of workers is
+type MultiStart struct {
+	logger       logger.Logger
+	construction *SequentialConstruction
+	starts       int
+	workers      int // Constructions running at the same time
+}
+
+// Zero workers means one per CPU
+func NewMultiStart(l logger.Logger, e routeestimator.Estimator, de cost.Service, starts, workers int) *MultiStart {
+	if starts <= 0 {
+		starts = multiStartDefaultStarts
+	}
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	return &MultiStart{
+		logger:       l,
+		construction: NewSequentialConstruction(l, e, de),
+		starts:       starts,
+		workers:      workers,
+	}
+}
+
+const MultiStartName = "multi_start"
+
+// The default starts and the workers are given by the solver
+func MultiStartDefinition(starts, workers int) Definition {
+	return Definition{
+		Name:        MultiStartName,
+		Description: "Sequential construction started many times in parallel with different orders of the assets and requests",
+		Parameters: []Parameter{
+			{
+				Name:        "starts",
+				Type:        ParameterTypeInteger,
+				Description: "Number of constructions. Zero means the default number",
+				Default:     float64(starts),
+			},
+		},
+		New: func(l logger.Logger, e routeestimator.Estimator, de cost.Service, params Parameters) Algorithm {
+			return NewMultiStart(l, e, de, params.Int("starts"), workers)
+		},
+	}
+}
+
+// multiStartResult is the solution of a start
+type multiStartResult struct {
+	solution *model.Solution
+	err      error
+}
+
+func (a *MultiStart) Solve(ctx context.Context, p model.Problem) (*model.Solution, error) {
+	algoStart := time.Now()
+	results := make([]multiStartResult, a.starts)
+	starts := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < minInt(a.workers, a.starts); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for start := range starts {
+				order := newConstructionOrder(p.Seed, start)
+				results[start].solution, results[start].err = a.construction.construct(ctx, withOwnRequests(p), order)
+			}
+		}()
+	}
+	// The starts left when the context is done are not run
+	for start := 0; start < a.starts && (start == 0 || ctx.Err() == nil); start++ {
+		starts <- start
+	}
+	close(starts)
+	wg.Wait()
+
+	// The results are checked in the order of the starts, the ties are won by the first one
+	var best *model.Solution
+	for start, r := range results {
+		if r.err != nil {
+			return nil, r.err
+		}
+		if r.solution == nil {
+			continue
+		}
+		if best == nil || r.solution.Metrics.Value < best.Metrics.Value {
+			a.logger.Debugf("Multi-start new best solution at start %d: %f", start, r.solution.Metrics.Value)
+			best = r.solution
+		}
+	}
+	best.Metrics.SolvedTime = time.Since(algoStart)
+	best.Metrics.Partial = best.Metrics.Partial || ctx.Err() != nil
+	if err := checkMustServe(best.Unassigned); err != nil {
+		return nil, err
+	}
+	return best, nil
+}
+
+// The construction updates the service times of the requests, every start has its own copy
+func withOwnRequests(p model.Problem) model.Problem {
+	p.Requests = append([]model.Request{}, p.Requests...)
+	return p
+}
+
+// constructionOrder perturbs the order of the sequential construction: the assets are shuffled before sorting them
+// by their opening order, so the ties are broken at random, and the distances sorting the requests are changed by
+// a random factor. Nil means the plain order
+type constructionOrder struct {
+	rnd *rand.Rand
+}
+
+// The first start has the plain order
+func newConstructionOrder(seed int64, start int) *constructionOrder {
+	if start == 0 {
+		return nil
+	}
+	return &constructionOrder{rnd: rand.New(rand.NewSource(seed + int64(start)))}
+}
+
+func (o *constructionOrder) shuffle(assets []model.Asset) []model.Asset {
+	if o == nil {
+		return assets
+	}
+	o.rnd.Shuffle(len(assets), func(i, j int) {
+		assets[i], assets[j] = assets[j], assets[i]
+	})
+	return assets
+}
+
+func (o *constructionOrder) perturb(distance float64) float64 {
+	if o == nil {
+		return distance
+	}
+	return distance * (1 + multiStartNoise*(2*o.rnd.Float64()-1))
+}
@@ -0,0 +1,110 @@
+package algorithms
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/edusalguero/roteiro.git/internal/distanceestimator"
+	"github.com/edusalguero/roteiro.git/internal/logger"
+	"github.com/edusalguero/roteiro.git/internal/model"
+	"github.com/edusalguero/roteiro.git/internal/routeestimator"
+	"github.com/stretchr/testify/assert"
+)
+
+func multiStartTestProblem() model.Problem {
+	return model.Problem{
+		Fleet: []model.Asset{
+			{AssetID: "Miño Asset", Location: minoLoc, Capacity: model.NewCapacity(1)},
+			{AssetID: "As Pontes Asset", Location: aspontesLoc, Capacity: model.NewCapacity(1)},
+		},
+		Requests: []model.Request{
+			{
+				RequestID:        "As Pontes - Sada",
+				PickUp:           aspontesLoc,
+				DropOff:          sadaLoc,
+				Load:             model.NewLoad(1),
+				PickUpTimeWindow: model.TimeWindow{Latest: departure.Add(25 * time.Minute)},
+			},
+			{
+				RequestID:        "Miño - Sada",
+				PickUp:           minoLoc,
+				DropOff:          sadaLoc,
+				Load:             model.NewLoad(1),
+				PickUpTimeWindow: model.TimeWindow{Latest: departure.Add(5 * time.Minute)},
+			},
+		},
+		Constraints: model.Constraints{
+			MaxJourneyTimeFactor: 1.5,
+		},
+		Departure: departure,
+		Seed:      42,
+	}
+}
+
+func TestMultiStart_Solve(t *testing.T) {
+	e := distanceestimator.NewHaversineDistanceEstimator(80)
+	construction := NewSequentialConstruction(logger.NewNopLogger(), routeestimator.NewEstimator(e), e)
+	algo := NewMultiStart(logger.NewNopLogger(), routeestimator.NewEstimator(e), e, 8, 4)
+	p := multiStartTestProblem()
+
+	// The Miño asset opened first takes the farthest request, so nobody else can serve the other one on time
+	initial, err := construction.Solve(context.Background(), p)
+	assert.NoError(t, err)
+	assert.Len(t, initial.Unassigned, 1)
+
+	// Other starts open the As Pontes asset first
+	got, err := algo.Solve(context.Background(), p)
+	assert.NoError(t, err)
+	assert.Equal(t, []Route{{aspontesLoc, sadaLoc}, {minoLoc, sadaLoc}}, getTestRoutes(t, got.Routes))
+	assert.Empty(t, got.Unassigned)
+	assert.Less(t, got.Metrics.Value, initial.Metrics.Value)
+	assert.False(t, got.Metrics.Partial)
+}
+
+func TestMultiStart_Solve_SameSolutionWhateverTheWorkers(t *testing.T) {
+	e := distanceestimator.NewHaversineDistanceEstimator(80)
+	p := model.Problem{
+		Fleet: []model.Asset{
+			{AssetID: "Miño Asset", Location: minoLoc, Capacity: model.NewCapacity(2)},
+			{AssetID: "As Pontes Asset", Location: aspontesLoc, Capacity: model.NewCapacity(2)},
+		},
+		Requests: []model.Request{
+			{RequestID: "Miño - Sada", PickUp: minoLoc, DropOff: sadaLoc, Load: model.NewLoad(1)},
+			{RequestID: "As Pontes - Sada", PickUp: aspontesLoc, DropOff: sadaLoc, Load: model.NewLoad(1)},
+			{RequestID: "Vilalba - Pontedeume", PickUp: vilalbaLoc, DropOff: pontedeumeLoc, Load: model.NewLoad(1)},
+			{RequestID: "Sada - Miño", PickUp: sadaLoc, DropOff: minoLoc, Load: model.NewLoad(2)},
+		},
+		Constraints: model.Constraints{
+			MaxJourneyTimeFactor: 2,
+		},
+		Departure: departure,
+		Seed:      7,
+	}
+
+	var solutions []*model.Solution
+	for _, workers := range []int{1, 3, 16} {
+		algo := NewMultiStart(logger.NewNopLogger(), routeestimator.NewEstimator(e), e, 16, workers)
+		s, err := algo.Solve(context.Background(), p)
+		assert.NoError(t, err)
+		s.Metrics.SolvedTime = 0
+		solutions = append(solutions, s)
+	}
+	assert.Equal(t, solutions[0], solutions[1])
+	assert.Equal(t, solutions[0], solutions[2])
+}
+
+func TestMultiStart_Solve_Cancelled(t *testing.T) {
+	e := distanceestimator.NewHaversineDistanceEstimator(80)
+	algo := NewMultiStart(logger.NewNopLogger(), routeestimator.NewEstimator(e), e, 1000, 2)
+	p := multiStartTestProblem()
+	for i := range p.Requests {
+		p.Requests[i].PickUpTimeWindow = model.TimeWindow{}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	got, err := algo.Solve(ctx, p)
+	assert.NoError(t, err)
+	assert.True(t, got.Metrics.Partial)
+}
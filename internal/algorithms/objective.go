@@ -0,0 +1,81 @@
+package algorithms
+
+import (
+	"context"
+
+	"github.com/edusalguero/roteiro.git/internal/model"
+)
+
+// The violations of the constraints cost more than any objective, so the search goes towards feasible routes
+const violationCost = 1e6
+
+// The cost of the route with its breaks. It is the duration of the route in seconds with the zero objective
+func (a *SequentialConstruction) routeCost(ctx context.Context, r model.Route, asset model.Asset, p model.Problem) (float64, error) {
+	planned, _, err := a.withBreaks(ctx, r, asset, p.Departure)
+	if err != nil {
+		return 0, err
+	}
+	if err := a.scheduleRoute(ctx, planned); err != nil {
+		return 0, err
+	}
+	return a.scheduledCost(ctx, planned, p.Objective)
+}
+
+// The route must be scheduled. The routes without requests cost nothing with an objective
+func (a *SequentialConstruction) scheduledCost(ctx context.Context, r model.Route, o model.Objective) (float64, error) {
+	duration := r[len(r)-1].GetDepartureTime() - r[0].ArrivalTime
+	if o.IsZero() {
+		return duration.Seconds(), nil
+	}
+	if !isUsed(r) {
+		return 0, nil
+	}
+
+	e, err := a.routeEstimator.GetRouteEstimation(ctx, r.GetPoints())
+	if err != nil {
+		return 0, err
+	}
+	u := model.RouteUsage{Distance: e.TotalDistance, Duration: duration}
+	for i, stop := range r {
+		u.Waiting += stop.ServiceTime - stop.ArrivalTime
+		if stop.Activity != model.ActivityTypeDropOff {
+			continue
+		}
+		// The riders on board at the start ride from the departure of the asset
+		pickedUp := r[0].GetDepartureTime()
+		for j := i - 1; j > 0; j-- {
+			if r[j].Ref == stop.Ref && r[j].Activity == model.ActivityTypePickUp {
+				pickedUp = r[j].GetDepartureTime()
+				break
+			}
+		}
+		u.RideTime += stop.ServiceTime - pickedUp
+	}
+	return o.RouteCost(u).Total, nil
+}
+
+// A route is used when it picks up or drops off any request
+func isUsed(r model.Route) bool {
+	for _, stop := range r {
+		if stop.Activity == model.ActivityTypePickUp || stop.Activity == model.ActivityTypeDropOff {
+			return true
+		}
+	}
+	return false
+}
+
+// The value of the solution is the cost the search algorithms minimize: the total of the objective, or with the
+// zero objective the duration of its routes in seconds plus the cost of its unassigned requests
+func solutionValue(p model.Problem, s model.Solution) float64 {
+	if !p.Objective.IsZero() {
+		return p.Objective.Breakdown(s).Total
+	}
+	value := 0.0
+	for _, sr := range s.Routes {
+		value += sr.Metrics.Duration.Seconds()
+	}
+	for _, u := range s.Unassigned {
+		value += unassignedCost(p.Objective, u.Request)
+	}
+	return value
+}
@@ -0,0 +1,150 @@
+package algorithms
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/edusalguero/roteiro.git/internal/distanceestimator"
+	"github.com/edusalguero/roteiro.git/internal/logger"
+	"github.com/edusalguero/roteiro.git/internal/model"
+	"github.com/edusalguero/roteiro.git/internal/routeestimator"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSequentialConstruction_SolveWithObjective(t *testing.T) {
+	e := distanceestimator.NewHaversineDistanceEstimator(80)
+	algo := NewSequentialConstruction(logger.NewNopLogger(), routeestimator.NewEstimator(e), e)
+
+	objective := model.Objective{
+		VehicleCost:    100,
+		DistanceCost:   0.5,
+		DurationCost:   20,
+		RideTimeCost:   0.2,
+		UnassignedCost: 50,
+	}
+	p := model.Problem{
+		Fleet: []model.Asset{
+			{AssetID: "Miño Asset", Location: minoLoc, Capacity: model.NewCapacity(2)},
+		},
+		Requests: []model.Request{
+			{RequestID: "Miño - Sada", PickUp: minoLoc, DropOff: sadaLoc, Load: model.NewLoad(1)},
+			{RequestID: "Too big", PickUp: minoLoc, DropOff: sadaLoc, Load: model.NewLoad(3), UnassignedPenalty: 10},
+		},
+		Constraints: model.Constraints{
+			MaxJourneyTimeFactor: 1.5,
+		},
+		Departure: departure,
+		Objective: objective,
+	}
+
+	s, err := algo.Solve(context.Background(), p)
+	assert.NoError(t, err)
+	assert.Len(t, s.Routes, 1)
+	assert.Len(t, s.Unassigned, 1)
+
+	u := s.Routes[0].Usage()
+	assert.Equal(t, u.Duration, u.RideTime)
+	got := s.Metrics.Objective
+	assert.Equal(t, 100.0, got.Vehicles)
+	assert.InDelta(t, 0.5*s.Metrics.Distance/1000, got.Distance, 1e-9)
+	assert.InDelta(t, 20*s.Metrics.Duration.Hours(), got.Duration, 1e-9)
+	assert.InDelta(t, 0.2*u.RideTime.Minutes(), got.RideTime, 1e-9)
+	assert.Equal(t, 0.0, got.Waiting)
+	assert.Equal(t, 60.0, got.Unassigned)
+	assert.InDelta(t, got.Vehicles+got.Distance+got.Duration+got.RideTime+got.Unassigned, got.Total, 1e-9)
+}
+
+func TestSequentialConstruction_SolveWithDifferentObjectives(t *testing.T) {
+	e := distanceestimator.NewHaversineDistanceEstimator(80)
+	algo := NewSequentialConstruction(logger.NewNopLogger(), routeestimator.NewEstimator(e), e)
+
+	newProblem := func(o model.Objective) model.Problem {
+		return model.Problem{
+			Fleet: []model.Asset{
+				{AssetID: "Miño Asset", Location: minoLoc, Capacity: model.NewCapacity(2)},
+			},
+			Requests: []model.Request{
+				{RequestID: "As Pontes - Miño", PickUp: aspontesLoc, DropOff: minoLoc, Load: model.NewLoad(1)},
+				{RequestID: "As Pontes - Pontedeume", PickUp: aspontesLoc, DropOff: pontedeumeLoc, Load: model.NewLoad(1)},
+			},
+			Constraints: model.Constraints{
+				MaxJourneyTimeFactor: 3,
+			},
+			Departure: departure,
+			Objective: o,
+		}
+	}
+
+	t.Run("Shared ride for the shortest route", func(t *testing.T) {
+		s, err := algo.Solve(context.Background(), newProblem(model.Objective{DurationCost: 1}))
+		assert.NoError(t, err)
+		assert.Equal(t, []Route{{minoLoc, aspontesLoc, pontedeumeLoc, minoLoc}}, getTestRoutes(t, s.Routes))
+	})
+
+	t.Run("One rider at a time for the shortest rides", func(t *testing.T) {
+		s, err := algo.Solve(context.Background(), newProblem(model.Objective{RideTimeCost: 1}))
+		assert.NoError(t, err)
+		assert.Equal(t, []Route{{minoLoc, aspontesLoc, minoLoc, aspontesLoc, pontedeumeLoc}}, getTestRoutes(t, s.Routes))
+	})
+}
+
+func TestSequentialConstruction_SolveWithoutObjective(t *testing.T) {
+	e := distanceestimator.NewHaversineDistanceEstimator(80)
+	algo := NewSequentialConstruction(logger.NewNopLogger(), routeestimator.NewEstimator(e), e)
+
+	p := model.Problem{
+		Fleet: []model.Asset{
+			{AssetID: "Miño Asset", Location: minoLoc, Capacity: model.NewCapacity(1)},
+		},
+		Requests: []model.Request{
+			{RequestID: "Miño - Sada", PickUp: minoLoc, DropOff: sadaLoc, Load: model.NewLoad(1)},
+			{RequestID: "Too big", PickUp: minoLoc, DropOff: sadaLoc, Load: model.NewLoad(3)},
+		},
+		Constraints: model.Constraints{
+			MaxJourneyTimeFactor: 1.5,
+		},
+		Departure: departure,
+	}
+
+	// The value is the one of the algorithms, without breakdown
+	s, err := algo.Solve(context.Background(), p)
+	assert.NoError(t, err)
+	assert.Equal(t, []Route{{minoLoc, sadaLoc}}, getTestRoutes(t, s.Routes))
+	assert.Len(t, s.Unassigned, 1)
+	assert.Equal(t, model.ObjectiveBreakdown{}, s.Metrics.Objective)
+	assert.InDelta(t, s.Metrics.Duration.Seconds()+alnsUnassignedCost.Seconds(), s.Metrics.Value, 1e-9)
+}
+
+func TestSolve_ObjectiveWithoutUnassignedCost(t *testing.T) {
+	e := distanceestimator.NewHaversineDistanceEstimator(80)
+	re := routeestimator.NewEstimator(e)
+
+	p := model.Problem{
+		Fleet: []model.Asset{
+			{AssetID: "Miño Asset", Location: minoLoc, Capacity: model.NewCapacity(1)},
+		},
+		Requests: []model.Request{
+			{RequestID: "Miño - Sada", PickUp: minoLoc, DropOff: sadaLoc, Load: model.NewLoad(1)},
+		},
+		Constraints: model.Constraints{
+			MaxJourneyTimeFactor: 1.5,
+		},
+		Departure: departure,
+		Objective: model.Objective{VehicleCost: 100, DistanceCost: 0.5},
+		Seed:      1,
+	}
+
+	// Leaving the request unassigned is not cheaper than serving it
+	for name, algo := range map[string]Algorithm{
+		"ALNS":  NewALNS(logger.NewNopLogger(), re, e, 0, 50),
+		"Exact": NewExact(logger.NewNopLogger(), re, e, time.Minute),
+	} {
+		t.Run(name, func(t *testing.T) {
+			s, err := algo.Solve(context.Background(), p)
+			assert.NoError(t, err)
+			assert.Equal(t, []Route{{minoLoc, sadaLoc}}, getTestRoutes(t, s.Routes))
+			assert.Empty(t, s.Unassigned)
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package algorithms
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/edusalguero/roteiro.git/internal/cost"
+	"github.com/edusalguero/roteiro.git/internal/logger"
+	"github.com/edusalguero/roteiro.git/internal/routeestimator"
+)
+
+var ErrUnknownAlgorithm = fmt.Errorf("unknown algorithm")
+var ErrInvalidParameter = fmt.Errorf("invalid algorithm parameter")
+
+// Parameters are the values of the tunable parameters of an algorithm by name. Durations are in nanoseconds
+type Parameters map[string]float64
+
+func (p Parameters) Duration(name string) time.Duration {
+	return time.Duration(p[name])
+}
+
+func (p Parameters) Int(name string) int {
+	return int(p[name])
+}
+
+type ParameterType string
+
+const (
+	ParameterTypeDuration ParameterType = "duration"
+	ParameterTypeInteger  ParameterType = "integer"
+)
+
+// Parameter is a tunable parameter of an algorithm. Its values can not be negative
+type Parameter struct {
+	Name        string
+	Type        ParameterType
+	Description string
+	Default     float64
+}
+
+// Factory builds the algorithm with the estimators of the problem and the value of every parameter
+type Factory func(l logger.Logger, e routeestimator.Estimator, de cost.Service, params Parameters) Algorithm
+
+// Definition describes an algorithm a problem can be solved with
+type Definition struct {
+	Name        string
+	Description string
+	Parameters  []Parameter
+	New         Factory
+}
+
+// Validate checks the parameters are known and their values valid
+func (d Definition) Validate(params Parameters) error {
+	for name, value := range params {
+		p, ok := d.parameter(name)
+		if !ok {
+			return fmt.Errorf("%w: %s is not a parameter of %s", ErrInvalidParameter, name, d.Name)
+		}
+		if value < 0 || value != math.Trunc(value) {
+			return fmt.Errorf("%w: %s must be a non negative %s", ErrInvalidParameter, name, p.Type)
+		}
+	}
+	return nil
+}
+
+func (d Definition) parameter(name string) (Parameter, bool) {
+	for _, p := range d.Parameters {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return Parameter{}, false
+}
+
+// The values of the parameters, the default ones for the missing parameters
+func (d Definition) withDefaults(params Parameters) Parameters {
+	values := make(Parameters, len(d.Parameters))
+	for _, p := range d.Parameters {
+		values[p.Name] = p.Default
+		if v, ok := params[p.Name]; ok {
+			values[p.Name] = v
+		}
+	}
+	return values
+}
+
+// Registry holds the algorithms a problem can be solved with, by name
+type Registry struct {
+	definitions []Definition
+	defaultName string
+}
+
+// NewRegistry registers the definitions. The first one is the default algorithm when the default name is unknown
+func NewRegistry(defaultName string, definitions ...Definition) *Registry {
+	r := &Registry{definitions: definitions, defaultName: defaultName}
+	if _, err := r.Get(defaultName); err != nil && len(definitions) > 0 {
+		r.defaultName = definitions[0].Name
+	}
+	return r
+}
+
+func (r *Registry) Definitions() []Definition {
+	return r.definitions
+}
+
+func (r *Registry) DefaultName() string {
+	return r.defaultName
+}
+
+// Get returns the definition of the algorithm. An empty name is the default algorithm
+func (r *Registry) Get(name string) (Definition, error) {
+	if name == "" {
+		name = r.defaultName
+	}
+	for _, d := range r.definitions {
+		if d.Name == name {
+			return d, nil
+		}
+	}
+	return Definition{}, ErrUnknownAlgorithm
+}
+
+// New builds the algorithm with the given parameters and the defaults of the missing ones
+func (r *Registry) New(
+	name string,
+	params Parameters,
+	l logger.Logger,
+	e routeestimator.Estimator,
+	de cost.Service,
+) (Algorithm, error) {
+	d, err := r.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	if err := d.Validate(params); err != nil {
+		return nil, err
+	}
+	return d.New(l, e, de, d.withDefaults(params)), nil
+}
@@ -0,0 +1,43 @@
+package algorithms
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/edusalguero/roteiro.git/internal/distanceestimator"
+	"github.com/edusalguero/roteiro.git/internal/logger"
+	"github.com/edusalguero/roteiro.git/internal/routeestimator"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistry(t *testing.T) {
+	e := distanceestimator.NewHaversineDistanceEstimator(80)
+	r := NewRegistry("simplex", SequentialConstructionDefinition(), ALNSDefinition(time.Minute, 100))
+
+	t.Run("First algorithm by default", func(t *testing.T) {
+		assert.Equal(t, SequentialConstructionName, r.DefaultName())
+		d, err := r.Get("")
+		assert.NoError(t, err)
+		assert.Equal(t, SequentialConstructionName, d.Name)
+	})
+
+	t.Run("Defaults of the missing parameters", func(t *testing.T) {
+		algo, err := r.New(ALNSName, Parameters{"iterations": 10}, logger.NewNopLogger(), routeestimator.NewEstimator(e), e)
+		assert.NoError(t, err)
+		assert.Equal(t, time.Minute, algo.(*ALNS).timeLimit)
+		assert.Equal(t, 10, algo.(*ALNS).iterations)
+	})
+
+	t.Run("Unknown algorithm", func(t *testing.T) {
+		_, err := r.New("simplex", nil, logger.NewNopLogger(), routeestimator.NewEstimator(e), e)
+		assert.True(t, errors.Is(err, ErrUnknownAlgorithm))
+	})
+
+	t.Run("Invalid parameters", func(t *testing.T) {
+		d, _ := r.Get(ALNSName)
+		assert.True(t, errors.Is(d.Validate(Parameters{"temperature": 1}), ErrInvalidParameter))
+		assert.True(t, errors.Is(d.Validate(Parameters{"iterations": -1}), ErrInvalidParameter))
+		assert.True(t, errors.Is(d.Validate(Parameters{"iterations": 1.5}), ErrInvalidParameter))
+	})
+}
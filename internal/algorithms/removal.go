@@ -0,0 +1,60 @@
+package algorithms
+
+import (
+	"context"
+	"time"
+
+	"github.com/edusalguero/roteiro.git/internal/model"
+)
+
+// Remove takes the requests out of the solution of the problem. The rest of the stops keep their order.
+// When reinsert is set, the unassigned requests are inserted where it increases the least the duration of a route
+// without violating any constraint
+func (a *SequentialConstruction) Remove(
+	ctx context.Context,
+	p model.Problem,
+	s model.Solution,
+	refs []model.Ref,
+	reinsert bool,
+) (*model.Solution, error) {
+	algoStart := time.Now()
+	routes := a.insertionRoutes(ctx, p, s)
+
+	removed := make(map[model.Ref]bool, len(refs))
+	for _, ref := range refs {
+		removed[ref] = true
+	}
+	for k := range routes {
+		ir := &routes[k]
+		var requests []model.Request
+		for _, req := range ir.requests {
+			if !removed[req.RequestID] {
+				requests = append(requests, req)
+				continue
+			}
+			a.logger.Debugf("###  Removing request %s from the route of %s", req.RequestID, ir.asset.AssetID)
+			ir.route = removeFromRoute(ir.route, req)
+			ir.changed = true
+		}
+		ir.requests = requests
+	}
+
+	unassigned := make([]model.UnassignedRequest, 0)
+	var pending model.Requests
+	for _, u := range s.Unassigned {
+		if removed[u.RequestID] {
+			continue
+		}
+		if req := findRequest(p.Requests, u.RequestID); reinsert && req != nil {
+			pending = append(pending, req)
+			continue
+		}
+		unassigned = append(unassigned, u)
+	}
+
+	notInserted, err := a.insertRequests(ctx, p, routes, pending)
+	if err != nil {
+		return nil, err
+	}
+	return a.newInsertionSolution(ctx, p, routes, append(unassigned, notInserted...), algoStart)
+}
@@ -0,0 +1,111 @@
+package algorithms
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/edusalguero/roteiro.git/internal/distanceestimator"
+	"github.com/edusalguero/roteiro.git/internal/logger"
+	"github.com/edusalguero/roteiro.git/internal/model"
+	"github.com/edusalguero/roteiro.git/internal/routeestimator"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSequentialConstruction_Remove(t *testing.T) {
+	e := distanceestimator.NewHaversineDistanceEstimator(80)
+	algo := NewSequentialConstruction(logger.NewNopLogger(), routeestimator.NewEstimator(e), e)
+
+	cancelled := model.Request{
+		RequestID:        "As Pontes - Sada",
+		PickUp:           aspontesLoc,
+		DropOff:          sadaLoc,
+		Load:             model.NewLoad(1),
+		PickUpTimeWindow: model.TimeWindow{Latest: departure.Add(25 * time.Minute)},
+	}
+	waiting := model.Request{
+		RequestID: "Miño - Sada",
+		PickUp:    minoLoc,
+		DropOff:   sadaLoc,
+		Load:      model.NewLoad(1),
+	}
+	p := model.Problem{
+		Fleet: []model.Asset{
+			{
+				AssetID:  "Miño Asset",
+				Location: minoLoc,
+				Capacity: model.NewCapacity(1),
+			},
+		},
+		Requests: []model.Request{cancelled, waiting},
+		Constraints: model.Constraints{
+			MaxJourneyTimeFactor: 1.5,
+		},
+		Departure: departure,
+	}
+	s, err := algo.Solve(context.Background(), p)
+	assert.NoError(t, err)
+	assert.Equal(t, []Route{{minoLoc, aspontesLoc, sadaLoc}}, getTestRoutes(t, s.Routes))
+	assert.Len(t, s.Unassigned, 1)
+
+	t.Run("Reinsert the unassigned requests", func(t *testing.T) {
+		got, err := algo.Remove(context.Background(), p, *s, []model.Ref{cancelled.RequestID}, true)
+		assert.NoError(t, err)
+		assert.Equal(t, []Route{{minoLoc, sadaLoc}}, getTestRoutes(t, got.Routes))
+		assert.Equal(t, []model.Request{waiting}, got.Routes[0].Requests)
+		assert.Equal(t, 1, got.Metrics.NumRequests)
+		assert.Empty(t, got.Unassigned)
+	})
+
+	t.Run("Keep the unassigned requests", func(t *testing.T) {
+		got, err := algo.Remove(context.Background(), p, *s, []model.Ref{cancelled.RequestID}, false)
+		assert.NoError(t, err)
+		assert.Empty(t, got.Routes)
+		assert.Equal(t, 0, got.Metrics.NumRequests)
+		assert.Equal(t, s.Unassigned, got.Unassigned)
+	})
+}
+
+func TestSequentialConstruction_Remove_GroupThatOnlyPartlyFits(t *testing.T) {
+	e := distanceestimator.NewHaversineDistanceEstimator(80)
+	algo := NewSequentialConstruction(logger.NewNopLogger(), routeestimator.NewEstimator(e), e)
+
+	newRequest := func(id model.Ref, load int) model.Request {
+		return model.Request{RequestID: id, PickUp: aspontesLoc, DropOff: sadaLoc, Load: model.NewLoad(load)}
+	}
+	p := model.Problem{
+		Fleet: []model.Asset{
+			{AssetID: "Miño Asset", Location: minoLoc, Capacity: model.NewCapacity(4)},
+			{AssetID: "As Pontes Asset", Location: aspontesLoc, Capacity: model.NewCapacity(4)},
+		},
+		Requests: []model.Request{
+			newRequest("A", 1),
+			newRequest("B", 1),
+			newRequest("Group 1", 2),
+			newRequest("Group 2", 2),
+			newRequest("Group 3", 2),
+		},
+		Constraints: model.Constraints{
+			MaxJourneyTimeFactor: 1.5,
+			IncompatibleRequests: []model.RequestPair{{"A", "B"}},
+			SameVehicleGroups:    []model.RequestGroup{{"Group 1", "Group 2", "Group 3"}},
+		},
+		Departure: departure,
+	}
+	s, err := algo.Solve(context.Background(), p)
+	assert.NoError(t, err)
+	assert.Len(t, s.Unassigned, 3)
+
+	// Every member fits alone in the freed capacity, but the group needs more than an asset has
+	got, err := algo.Remove(context.Background(), p, *s, []model.Ref{"B"}, true)
+	assert.NoError(t, err)
+	for _, r := range got.Routes {
+		assert.Equal(t, []model.Ref{"A"}, requestRefs(r.Requests))
+	}
+	var unassigned []model.Ref
+	for _, u := range got.Unassigned {
+		unassigned = append(unassigned, u.RequestID)
+		assert.Contains(t, u.Reasons, model.UnassignedReasonGroup)
+	}
+	assert.Equal(t, []model.Ref{"Group 1", "Group 2", "Group 3"}, unassigned)
+}
@@ -0,0 +1,554 @@
+package algorithms
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/edusalguero/roteiro.git/internal/model"
+	"github.com/edusalguero/roteiro.git/internal/point"
+	"github.com/edusalguero/roteiro.git/internal/routeestimator"
+)
+
+// noArrival is the latest arrival at a stop that can not be served on time whatever the arrival is
+const noArrival = time.Duration(math.MinInt64)
+
+// routeState is the schedule of a route without breaks kept by position, so the insertion of the stops of a request
+// is checked without scheduling the whole route again. The times are offsets from the departure, as the ones of
+// the scheduled routes
+type routeState struct {
+	route     model.Route
+	legs      []time.Duration // Driving time from the stop to the next one
+	distances []float64       // Distance from the stop to the next one
+	departure []time.Duration // Departure from the stop
+	loads     []model.Load    // Load on board after the stop
+	fits      []bool          // The load after the stop fits in the asset
+	late      []int           // Stops served after their time window up to this one
+	full      []int           // Stops after which the load does not fit in the asset up to this one
+	latest    []time.Duration // Latest arrival at the stop without time window violations up to the end
+	requests  int
+	used      bool
+	order     int // Drop offs before the pick ups of their requests
+	distance  float64
+	driving   time.Duration
+	services  time.Duration // Sum of the service durations of the stops
+	// The departure from the last stop is max(arrival + endShift, endMin) being arrival the one at the stop
+	endShift []time.Duration
+	endMin   []time.Duration
+}
+
+// newRouteState schedules the route in O(n): the times forward, the latest arrivals and the end of the route
+// backwards
+func (a *SequentialConstruction) newRouteState(
+	ctx context.Context,
+	r model.Route,
+	capacity model.Capacity,
+) (*routeState, error) {
+	e, err := a.routeEstimator.GetRouteEstimation(ctx, r.GetPoints())
+	if err != nil {
+		return nil, err
+	}
+	n := len(r)
+	s := &routeState{
+		route:     r,
+		legs:      make([]time.Duration, n),
+		distances: make([]float64, n),
+		departure: make([]time.Duration, n),
+		loads:     make([]model.Load, n),
+		fits:      make([]bool, n),
+		late:      make([]int, n),
+		full:      make([]int, n),
+		latest:    make([]time.Duration, n),
+		endShift:  make([]time.Duration, n),
+		endMin:    make([]time.Duration, n),
+		requests:  countRequests(r),
+		used:      isUsed(r),
+		distance:  e.TotalDistance,
+		driving:   e.TotalDuration,
+	}
+	for i, leg := range e.Legs {
+		s.legs[i] = leg.Duration
+		s.distances[i] = leg.Distance
+	}
+
+	// Same schedule as scheduleRoute
+	load := model.Load{}
+	late, full := 0, 0
+	for i, stop := range r {
+		load = load.Add(stop.Load)
+		s.loads[i] = load
+		s.fits[i] = capacity.Fits(load)
+		if !s.fits[i] {
+			full++
+		}
+		s.full[i] = full
+		s.services += stop.ServiceDuration
+		if i == 0 {
+			s.departure[i] = maxDurationOf(0, stop.GetMinServiceTime()) + stop.ServiceDuration
+			continue
+		}
+		departure, onTime := serve(stop, s.departure[i-1]+s.legs[i-1])
+		s.departure[i] = departure
+		if !onTime {
+			late++
+		}
+		s.late[i] = late
+	}
+
+	latest := maxDuration
+	var endShift, endMin time.Duration
+	pickUps := make(map[model.Ref]int)
+	for i := n - 1; i >= 0; i-- {
+		stop := r[i]
+		switch stop.Activity {
+		case model.ActivityTypePickUp:
+			pickUps[stop.Ref]++
+		case model.ActivityTypeDropOff:
+			s.order += pickUps[stop.Ref]
+		}
+
+		// The stop is left at max(arrival, min) + duration and the next one is reached after the leg
+		next := stop.ServiceDuration + s.legs[i]
+		if latest != noArrival {
+			latest -= next
+			if stop.GetMaxServiceTime() < latest {
+				latest = stop.GetMaxServiceTime()
+			}
+			if stop.GetMinServiceTime() > latest {
+				latest = noArrival
+			}
+		}
+		s.latest[i] = latest
+
+		if i == n-1 {
+			endShift, endMin = stop.ServiceDuration, stop.GetMinServiceTime()+stop.ServiceDuration
+		} else {
+			endShift += next
+			endMin = maxDurationOf(endMin, stop.GetMinServiceTime()+endShift)
+		}
+		s.endShift[i], s.endMin[i] = endShift, endMin
+	}
+	return s, nil
+}
+
+// The stops are left with the schedule of the route, the same scheduleRoute sets
+func (s *routeState) schedule() {
+	for i, stop := range s.route {
+		stop.ArrivalTime = 0
+		if i > 0 {
+			stop.ArrivalTime = s.departure[i-1] + s.legs[i-1]
+		}
+		stop.ServiceTime = stop.ArrivalTime
+		if stop.ServiceTime < stop.GetMinServiceTime() {
+			stop.ServiceTime = stop.GetMinServiceTime()
+			if stop.IsAssetDeparture() {
+				stop.ArrivalTime = stop.ServiceTime
+			}
+		}
+	}
+}
+
+// Stops served after their time window from the stop i to the end
+func (s *routeState) lateFrom(i int) int {
+	if i == 0 {
+		return s.late[len(s.route)-1]
+	}
+	return s.late[len(s.route)-1] - s.late[i-1]
+}
+
+// Stops after which the load does not fit in the asset from the stop i to the end
+func (s *routeState) fullFrom(i int) int {
+	if i == 0 {
+		return s.full[len(s.route)-1]
+	}
+	return s.full[len(s.route)-1] - s.full[i-1]
+}
+
+// The departure from the last stop
+func (s *routeState) finish() time.Duration {
+	return s.departure[len(s.route)-1]
+}
+
+// The arrival at the first stop, the start of the route as measured by the cost of the routes
+func (s *routeState) start() time.Duration {
+	if !s.route[0].IsAssetDeparture() {
+		return 0
+	}
+	return s.departure[0] - s.route[0].ServiceDuration
+}
+
+// The departure from the last stop when the stop i is reached at the arrival
+func (s *routeState) end(i int, arrival time.Duration) time.Duration {
+	return maxDurationOf(arrival+s.endShift[i], s.endMin[i])
+}
+
+// routeRequest is a request to insert in the route, with the legs between its stops and the ones of the route and
+// the stops after which its load fits in the asset
+type routeRequest struct {
+	state       *routeState
+	pickUp      *model.Stop
+	dropOff     *model.Stop
+	toPickUp    []time.Duration // From the stop to the pick up
+	fromPickUp  []time.Duration // From the pick up to the stop
+	toDropOff   []time.Duration // From the stop to the drop off
+	fromDropOff []time.Duration // From the drop off to the stop
+	direct      time.Duration   // From the pick up to the drop off
+	fits        []bool          // The load after the stop fits in the asset with the one of the request
+}
+
+// The legs are estimated once per stop of the route, so every insertion of the request is checked in constant time
+func (s *routeState) withRequest(
+	ctx context.Context,
+	a *SequentialConstruction,
+	pickUp, dropOff *model.Stop,
+	capacity model.Capacity,
+) (*routeRequest, error) {
+	n := len(s.route)
+	rr := &routeRequest{
+		state:       s,
+		pickUp:      pickUp,
+		dropOff:     dropOff,
+		toPickUp:    make([]time.Duration, n),
+		fromPickUp:  make([]time.Duration, n),
+		toDropOff:   make([]time.Duration, n),
+		fromDropOff: make([]time.Duration, n),
+		fits:        make([]bool, n),
+	}
+	var err error
+	if rr.direct, err = a.drivingTime(ctx, pickUp.Point, dropOff.Point); err != nil {
+		return nil, err
+	}
+	for k, stop := range s.route {
+		legs := []struct {
+			leg      *time.Duration
+			from, to point.Point
+		}{
+			{&rr.toPickUp[k], stop.Point, pickUp.Point},
+			{&rr.fromPickUp[k], pickUp.Point, stop.Point},
+			{&rr.toDropOff[k], stop.Point, dropOff.Point},
+			{&rr.fromDropOff[k], dropOff.Point, stop.Point},
+		}
+		for _, l := range legs {
+			if *l.leg, err = a.drivingTime(ctx, l.from, l.to); err != nil {
+				return nil, err
+			}
+		}
+		rr.fits[k] = fitsWith(capacity, s.loads[k], pickUp.Load)
+	}
+	return rr, nil
+}
+
+// routeInsertionCheck follows the schedule of a route with the stops of a request inserted, the pick up before the
+// stop i and the drop off before the stop j. The drop off unloads what the pick up loads, so the load after the drop
+// off is the one of the route. The violations before the drop off only grow as it moves forward
+type routeInsertionCheck struct {
+	request   *routeRequest
+	i         int
+	j         int
+	departure time.Duration // Departure from the stop before the drop off
+	late      bool          // Any stop before the drop off is served after its time window
+	full      bool          // The load does not fit in the asset after any stop before the drop off
+}
+
+// routeInsertionTiming is the end of the route with the stops of the request inserted and its violations
+type routeInsertionTiming struct {
+	end  time.Duration
+	late bool
+	full bool
+}
+
+func (t routeInsertionTiming) isFeasible() bool {
+	return !t.late && !t.full
+}
+
+// The violations of the route with the stops of the request inserted are decided by its timing when there are
+// no breaks to place, no limit of distance and no limits of ride time
+func (s *routeState) decidesViolations(asset model.Asset, dropOff *model.Stop) bool {
+	if len(asset.Breaks) > 0 || asset.MaxDistance > 0 || dropOff.MaxRideTime > 0 {
+		return false
+	}
+	for _, stop := range s.route {
+		if stop.MaxRideTime > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// The violated constraints in the same order as the feasibility check of the planned route
+func (s *routeState) violations(t routeInsertionTiming, asset model.Asset, departure time.Time) []model.UnassignedReason {
+	var violations []model.UnassignedReason
+	if t.late {
+		violations = append(violations, model.UnassignedReasonTimeWindow)
+	}
+	if t.full {
+		violations = append(violations, model.UnassignedReasonCapacity)
+	}
+	if t.end > latestServiceTime(asset.Shift, departure) {
+		violations = append(violations, model.UnassignedReasonShift)
+	}
+	if asset.MaxDuration > 0 && t.end-s.start() > asset.MaxDuration {
+		violations = append(violations, model.UnassignedReasonMaxDuration)
+	}
+	if asset.MaxRequests > 0 && s.requests+1 > asset.MaxRequests {
+		violations = append(violations, model.UnassignedReasonMaxRequests)
+	}
+	return violations
+}
+
+// The shift and route limits of the asset the route violates
+func (s *routeState) limitsViolations(asset model.Asset, departure time.Time) []model.UnassignedReason {
+	var violations []model.UnassignedReason
+	if s.finish() > latestServiceTime(asset.Shift, departure) {
+		violations = append(violations, model.UnassignedReasonShift)
+	}
+	if asset.MaxDuration > 0 && s.finish()-s.start() > asset.MaxDuration {
+		violations = append(violations, model.UnassignedReasonMaxDuration)
+	}
+	if asset.MaxDistance > 0 && s.distance > asset.MaxDistance {
+		violations = append(violations, model.UnassignedReasonMaxDistance)
+	}
+	if asset.MaxRequests > 0 && s.requests > asset.MaxRequests {
+		violations = append(violations, model.UnassignedReasonMaxRequests)
+	}
+	return violations
+}
+
+// The pick up is inserted before the stop i and the drop off right after it
+func (rr *routeRequest) withPickUp(i int) *routeInsertionCheck {
+	s := rr.state
+	departure, onTime := serve(rr.pickUp, s.departure[i-1]+rr.toPickUp[i-1])
+	return &routeInsertionCheck{
+		request:   rr,
+		i:         i,
+		j:         i,
+		departure: departure,
+		late:      s.late[i-1] > 0 || !onTime,
+		full:      s.full[i-1] > 0 || !rr.fits[i-1],
+	}
+}
+
+// The drop off is moved one stop forward, after the stop j of the route. It returns false when any stop before the
+// drop off is late or full
+func (c *routeInsertionCheck) next() bool {
+	rr := c.request
+	leg := rr.state.legs[c.j-1]
+	if c.j == c.i {
+		leg = rr.fromPickUp[c.j]
+	}
+	departure, onTime := serve(rr.state.route[c.j], c.departure+leg)
+	c.departure = departure
+	c.late = c.late || !onTime
+	c.full = c.full || !rr.fits[c.j]
+	c.j++
+	return !c.late && !c.full
+}
+
+// The drop off is inserted before the stop j
+func (c *routeInsertionCheck) withDropOff() routeInsertionTiming {
+	rr := c.request
+	s := rr.state
+	leg := rr.toDropOff[c.j-1]
+	if c.j == c.i {
+		leg = rr.direct
+	}
+	departure, onTime := serve(rr.dropOff, c.departure+leg)
+	t := routeInsertionTiming{
+		end:  departure,
+		late: c.late || !onTime,
+		full: c.full || !s.fits[c.j-1],
+	}
+	if c.j == len(s.route) {
+		return t
+	}
+	arrival := departure + rr.fromDropOff[c.j]
+	t.end = s.end(c.j, arrival)
+	t.late = t.late || arrival > s.latest[c.j]
+	t.full = t.full || s.fullFrom(c.j) > 0
+	return t
+}
+
+// The lower bound of the climbing cost of the route with the stop i moved before the stop j, j < i. The stops before
+// j keep their schedule, the moved ones are followed one by one and the ones after i until they are served as in the
+// route. Only the ride times are left out. The loads are not checked when the timing already reaches the limit
+func (s *routeState) moveBound(
+	ctx context.Context,
+	a *SequentialConstruction,
+	i, j int,
+	capacity model.Capacity,
+	o model.Objective,
+	limit float64,
+) (float64, error) {
+	r := s.route
+	toMoved, err := a.leg(ctx, r[j-1].Point, r[i].Point)
+	if err != nil {
+		return 0, err
+	}
+	fromMoved, err := a.leg(ctx, r[i].Point, r[j].Point)
+	if err != nil {
+		return 0, err
+	}
+	driving := s.driving - s.legs[j-1] - s.legs[i-1] + toMoved.Duration + fromMoved.Duration
+	distance := s.distance - s.distances[j-1] - s.distances[i-1] + toMoved.Distance + fromMoved.Distance
+
+	late, order := s.late[j-1], s.order
+	departure, onTime := serve(r[i], s.departure[j-1]+toMoved.Duration)
+	if !onTime {
+		late++
+	}
+	leg := fromMoved.Duration
+	for k := j; k < i; k++ {
+		if k > j {
+			leg = s.legs[k-1]
+		}
+		if departure, onTime = serve(r[k], departure+leg); !onTime {
+			late++
+		}
+		// The moved stop goes before the other stop of its request
+		switch {
+		case r[k].Ref != r[i].Ref:
+		case r[i].Activity == model.ActivityTypePickUp && r[k].Activity == model.ActivityTypeDropOff:
+			order--
+		case r[i].Activity == model.ActivityTypeDropOff && r[k].Activity == model.ActivityTypePickUp:
+			order++
+		}
+	}
+
+	end := departure
+	if i < len(r)-1 {
+		toNext, err := a.leg(ctx, r[i-1].Point, r[i+1].Point)
+		if err != nil {
+			return 0, err
+		}
+		driving += toNext.Duration - s.legs[i]
+		distance += toNext.Distance - s.distances[i]
+		arrival := departure + toNext.Duration
+		end = s.end(i+1, arrival)
+		late += s.lateWhenReached(i+1, arrival)
+	}
+
+	timing := 0.0
+	duration := end - s.start()
+	switch {
+	case o.IsZero():
+		timing = duration.Seconds()
+	case s.used:
+		// The distances are added in another order than the ones of the route, the tolerance keeps the rounding
+		// from raising the bound
+		u := model.RouteUsage{Distance: distance, Duration: duration, Waiting: duration - s.services - driving}
+		timing = o.RouteCost(u).Total - exactTolerance
+	}
+	if bound := timing + violationCost*float64(late+order); bound >= limit {
+		return bound, nil
+	}
+
+	// The loads of the stops the moved one goes before change by its load
+	full := s.full[j-1] + s.fullFrom(i+1)
+	if !fitsWith(capacity, s.loads[j-1], r[i].Load) {
+		full++
+	}
+	for k := j; k < i; k++ {
+		if !fitsWith(capacity, s.loads[k], r[i].Load) {
+			full++
+		}
+	}
+	return timing + violationCost*float64(late+order+full), nil
+}
+
+// The stop is inserted after the stop i, i < n-1. It returns the stops served after their time window and the
+// departure from the last stop
+func (s *routeState) withStop(
+	ctx context.Context,
+	a *SequentialConstruction,
+	i int,
+	stop *model.Stop,
+) (int, time.Duration, error) {
+	r := s.route
+	to, err := a.drivingTime(ctx, r[i].Point, stop.Point)
+	if err != nil {
+		return 0, 0, err
+	}
+	leg, err := a.drivingTime(ctx, stop.Point, r[i+1].Point)
+	if err != nil {
+		return 0, 0, err
+	}
+	late := s.late[i]
+	departure, onTime := serve(stop, s.departure[i]+to)
+	if !onTime {
+		late++
+	}
+	arrival := departure + leg
+	return late + s.lateWhenReached(i+1, arrival), s.end(i+1, arrival), nil
+}
+
+// The stops from the stop i to the end served after their time window when the stop i is reached at the arrival.
+// The stops are followed until they are served as in the route
+func (s *routeState) lateWhenReached(i int, arrival time.Duration) int {
+	if arrival <= s.latest[i] {
+		return 0
+	}
+	late := 0
+	for k := i; k < len(s.route); k++ {
+		departure, onTime := serve(s.route[k], arrival)
+		if !onTime {
+			late++
+		}
+		if departure == s.departure[k] {
+			return late + s.lateFrom(k+1)
+		}
+		arrival = departure + s.legs[k]
+	}
+	return late
+}
+
+// The driving time from the start of the route to every stop
+func (s *routeState) cumulativeDriving() []time.Duration {
+	driving := make([]time.Duration, len(s.route))
+	for i := 1; i < len(driving); i++ {
+		driving[i] = driving[i-1] + s.legs[i-1]
+	}
+	return driving
+}
+
+// The stop is served after the arrival when its time window opens. It returns the departure and false when the
+// time window is already closed
+func serve(stop *model.Stop, arrival time.Duration) (time.Duration, bool) {
+	service := maxDurationOf(arrival, stop.GetMinServiceTime())
+	return service + stop.ServiceDuration, service <= stop.GetMaxServiceTime()
+}
+
+// The legs are estimated as the ones of the routes
+func (a *SequentialConstruction) drivingTime(ctx context.Context, from, to point.Point) (time.Duration, error) {
+	l, err := a.leg(ctx, from, to)
+	return l.Duration, err
+}
+
+func (a *SequentialConstruction) leg(ctx context.Context, from, to point.Point) (routeestimator.Leg, error) {
+	e, err := a.routeEstimator.GetRouteEstimation(ctx, []point.Point{from, to})
+	if err != nil {
+		return routeestimator.Leg{}, err
+	}
+	return e.Legs[0], nil
+}
+
+// Same check as Fits without building the sum of the loads
+func fitsWith(capacity model.Capacity, load, extra model.Load) bool {
+	for d, u := range load {
+		if u+extra[d] > capacity[d] {
+			return false
+		}
+	}
+	for d, u := range extra {
+		if _, ok := load[d]; !ok && u > capacity[d] {
+			return false
+		}
+	}
+	return true
+}
+
+func maxDurationOf(a, b time.Duration) time.Duration {
+	if a > b {
+		return a
+	}
+	return b
+}
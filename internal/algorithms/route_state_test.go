@@ -0,0 +1,321 @@
+package algorithms
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/edusalguero/roteiro.git/internal/distanceestimator"
+	"github.com/edusalguero/roteiro.git/internal/logger"
+	"github.com/edusalguero/roteiro.git/internal/model"
+	"github.com/edusalguero/roteiro.git/internal/routeestimator"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRouteState_withRequest(t *testing.T) {
+	e := distanceestimator.NewHaversineDistanceEstimator(80)
+	algo := NewSequentialConstruction(logger.NewNopLogger(), routeestimator.NewEstimator(e), e)
+	ctx := context.Background()
+
+	asset := model.Asset{
+		AssetID:       "Miño Asset",
+		Location:      minoLoc,
+		EndLocation:   &sadaLoc,
+		Capacity:      model.NewCapacity(2),
+		SetupDuration: 5 * time.Minute,
+		Shift:         model.TimeWindow{Earliest: departure.Add(10 * time.Minute)},
+	}
+	p := model.Problem{
+		Fleet: []model.Asset{asset},
+		Constraints: model.Constraints{
+			MaxJourneyTimeFactor: 2,
+		},
+		Departure: departure,
+	}
+	planned := []model.Request{
+		{RequestID: "Miño - Pontedeume", PickUp: minoLoc, DropOff: pontedeumeLoc, Load: model.NewLoad(1)},
+		{
+			RequestID:        "As Pontes - Vilalba",
+			PickUp:           aspontesLoc,
+			DropOff:          vilalbaLoc,
+			Load:             model.NewLoad(2),
+			PickUpTimeWindow: model.TimeWindow{Earliest: departure.Add(time.Hour), Latest: departure.Add(2 * time.Hour)},
+		},
+	}
+	r := newAssetRoute(asset, p)
+	for i := range planned {
+		pickUp, dropOff := algo.newRequestStops(ctx, asset, &planned[i], p)
+		r = insertBeforeEnd(r, pickUp, dropOff)
+	}
+
+	tests := []struct {
+		name string
+		req  model.Request
+	}{
+		{
+			"Without time window",
+			model.Request{RequestID: "Sada - Miño", PickUp: sadaLoc, DropOff: minoLoc, Load: model.NewLoad(1)},
+		},
+		{
+			"With time window",
+			model.Request{
+				RequestID:        "Pontedeume - Sada",
+				PickUp:           pontedeumeLoc,
+				DropOff:          sadaLoc,
+				Load:             model.NewLoad(1),
+				PickUpTimeWindow: model.TimeWindow{Latest: departure.Add(45 * time.Minute)},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state, err := algo.newRouteState(ctx, r, asset.Capacity)
+			assert.NoError(t, err)
+			pickUp, dropOff := algo.newRequestStops(ctx, asset, &tt.req, p)
+			rr, err := state.withRequest(ctx, algo, pickUp, dropOff, asset.Capacity)
+			assert.NoError(t, err)
+
+			first, last := insertionPositions(r)
+			for i := first; i <= last; i++ {
+				check := rr.withPickUp(i)
+				for j := i; j <= last; j++ {
+					if j > i {
+						check.next()
+					}
+					got := check.withDropOff()
+
+					candidate := insertStops(r, i, pickUp, j, dropOff)
+					twv, err := algo.countTimeWindowViolations(ctx, candidate)
+					assert.NoError(t, err)
+					position := fmt.Sprintf("pick up at %d and drop off at %d", i, j)
+					assert.Equal(t, candidate[len(candidate)-1].GetDepartureTime(), got.end, position)
+					assert.Equal(t, twv > 0, got.late, position)
+					assert.Equal(t, countCapacityViolations(asset.Capacity, candidate) > 0, got.full, position)
+					assert.Equal(t, candidate[0].ArrivalTime, state.start(), position)
+				}
+			}
+		})
+	}
+}
+
+func TestRouteState_moveBound(t *testing.T) {
+	e := distanceestimator.NewHaversineDistanceEstimator(80)
+	algo := NewSequentialConstruction(logger.NewNopLogger(), routeestimator.NewEstimator(e), e)
+	ctx := context.Background()
+
+	asset := model.Asset{
+		AssetID:     "Miño Asset",
+		Location:    minoLoc,
+		EndLocation: &sadaLoc,
+		Capacity:    model.NewCapacity(2),
+	}
+	p := model.Problem{
+		Fleet: []model.Asset{asset},
+		Constraints: model.Constraints{
+			MaxJourneyTimeFactor: 2,
+		},
+		Departure: departure,
+	}
+	planned := []model.Request{
+		{RequestID: "Miño - Pontedeume", PickUp: minoLoc, DropOff: pontedeumeLoc, Load: model.NewLoad(1)},
+		{
+			RequestID:        "As Pontes - Vilalba",
+			PickUp:           aspontesLoc,
+			DropOff:          vilalbaLoc,
+			Load:             model.NewLoad(2),
+			PickUpTimeWindow: model.TimeWindow{Earliest: departure.Add(time.Hour), Latest: departure.Add(2 * time.Hour)},
+		},
+		{
+			RequestID:        "Pontedeume - Sada",
+			PickUp:           pontedeumeLoc,
+			DropOff:          sadaLoc,
+			Load:             model.NewLoad(1),
+			PickUpTimeWindow: model.TimeWindow{Latest: departure.Add(45 * time.Minute)},
+		},
+	}
+	r := newAssetRoute(asset, p)
+	for i := range planned {
+		pickUp, dropOff := algo.newRequestStops(ctx, asset, &planned[i], p)
+		r = insertBeforeEnd(r, pickUp, dropOff)
+	}
+
+	tests := []struct {
+		name      string
+		objective model.Objective
+	}{
+		{"Without objective", model.Objective{}},
+		{"With objective", model.Objective{VehicleCost: 10, DistanceCost: 1, DurationCost: 20, WaitingCost: 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, state, err := algo.climbingCost(ctx, r, asset, tt.objective)
+			assert.NoError(t, err)
+
+			for i := 2; i < len(r)-1; i++ {
+				for j := 1; j < i; j++ {
+					got, err := state.moveBound(ctx, algo, i, j, asset.Capacity, tt.objective, math.Inf(1))
+					assert.NoError(t, err)
+
+					cost, _, err := algo.climbingCost(ctx, moveStop(r, i, j), asset, tt.objective)
+					assert.NoError(t, err)
+					move := fmt.Sprintf("stop %d before stop %d", i, j)
+					if tt.objective.IsZero() {
+						// Without ride times the bound is the cost
+						assert.Equal(t, cost, got, move)
+					} else {
+						assert.InDelta(t, cost, got, 1e-5, move)
+						assert.LessOrEqual(t, got, cost, move)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestRouteState_withStop(t *testing.T) {
+	e := distanceestimator.NewHaversineDistanceEstimator(80)
+	algo := NewSequentialConstruction(logger.NewNopLogger(), routeestimator.NewEstimator(e), e)
+	ctx := context.Background()
+
+	asset := model.Asset{
+		AssetID:     "Miño Asset",
+		Location:    minoLoc,
+		EndLocation: &minoLoc,
+		Capacity:    model.NewCapacity(2),
+	}
+	p := model.Problem{
+		Fleet:     []model.Asset{asset},
+		Departure: departure,
+	}
+	planned := []model.Request{
+		{
+			RequestID:        "Miño - Pontedeume",
+			PickUp:           minoLoc,
+			DropOff:          pontedeumeLoc,
+			Load:             model.NewLoad(1),
+			PickUpTimeWindow: model.TimeWindow{Earliest: departure.Add(10 * time.Minute), Latest: departure.Add(15 * time.Minute)},
+		},
+		{
+			RequestID:        "As Pontes - Vilalba",
+			PickUp:           aspontesLoc,
+			DropOff:          vilalbaLoc,
+			Load:             model.NewLoad(1),
+			PickUpTimeWindow: model.TimeWindow{Earliest: departure.Add(2 * time.Hour), Latest: departure.Add(3 * time.Hour)},
+		},
+	}
+	r := newAssetRoute(asset, p)
+	for i := range planned {
+		pickUp, dropOff := algo.newRequestStops(ctx, asset, &planned[i], p)
+		r = insertBeforeEnd(r, pickUp, dropOff)
+	}
+	state, err := algo.newRouteState(ctx, r, asset.Capacity)
+	assert.NoError(t, err)
+
+	rule := model.BreakRule{ID: "Lunch", Duration: 45 * time.Minute}
+	for i := 0; i < len(r)-1; i++ {
+		candidate := insertBreak(r, i, rule, departure)
+		late, end, err := state.withStop(ctx, algo, i, candidate[i+1])
+		assert.NoError(t, err)
+
+		twv, err := algo.countTimeWindowViolations(ctx, candidate)
+		assert.NoError(t, err)
+		position := fmt.Sprintf("break after %d", i)
+		assert.Equal(t, twv, late, position)
+		assert.Equal(t, candidate[len(candidate)-1].GetDepartureTime(), end, position)
+	}
+}
+
+// The checks of every position of a request in a route of 40 requests, with the route state and planning the route
+// again for every position as the insertion did before it
+func BenchmarkRouteState_insertionChecks(b *testing.B) {
+	e := distanceestimator.NewHaversineDistanceEstimator(80)
+	algo := NewSequentialConstruction(logger.NewNopLogger(), routeestimator.NewEstimator(e), e)
+	ctx := context.Background()
+
+	p := benchmarkProblem(41, 1)
+	sort.SliceStable(p.Requests, func(i, j int) bool {
+		return p.Requests[i].PickUpTimeWindow.Earliest.Before(p.Requests[j].PickUpTimeWindow.Earliest)
+	})
+	asset := p.Fleet[0]
+	r := newAssetRoute(asset, p)
+	for i := range p.Requests[:40] {
+		r = algo.addRequestStops(ctx, r, asset, &p.Requests[i], p)
+	}
+	pickUp, dropOff := algo.newRequestStops(ctx, asset, &p.Requests[40], p)
+	first, last := insertionPositions(r)
+
+	b.Run("Route state", func(b *testing.B) {
+		for n := 0; n < b.N; n++ {
+			state, err := algo.newRouteState(ctx, r, asset.Capacity)
+			if err != nil {
+				b.Fatal(err)
+			}
+			rr, err := state.withRequest(ctx, algo, pickUp, dropOff, asset.Capacity)
+			if err != nil {
+				b.Fatal(err)
+			}
+			for i := first; i <= last; i++ {
+				check := rr.withPickUp(i)
+				for j := i; j <= last; j++ {
+					if j > i {
+						check.next()
+					}
+					check.withDropOff()
+				}
+			}
+		}
+	})
+
+	b.Run("Full reschedule", func(b *testing.B) {
+		for n := 0; n < b.N; n++ {
+			for i := first; i <= last; i++ {
+				for j := i; j <= last; j++ {
+					candidate := insertStops(r, i, pickUp, j, dropOff)
+					if _, err := algo.countTimeWindowViolations(ctx, candidate); err != nil {
+						b.Fatal(err)
+					}
+					countCapacityViolations(asset.Capacity, candidate)
+				}
+			}
+		}
+	})
+}
+
+// The route is planned again to count its stops served late
+func (a *SequentialConstruction) countTimeWindowViolations(ctx context.Context, r model.Route) (int, error) {
+	if err := a.scheduleRoute(ctx, r); err != nil {
+		return 0, err
+	}
+
+	twv := 0
+	for i, stop := range r {
+		if i == 0 {
+			// no time from depot to depot
+			continue
+		}
+
+		if stop.ServiceTime > stop.GetMaxServiceTime() {
+			twv++
+		}
+	}
+	return twv, nil
+}
+
+// Every dimension of the load is checked against the same dimension of the capacity
+func countCapacityViolations(capacity model.Capacity, route model.Route) int {
+	violations := 0
+	load := model.Load{}
+	for _, s := range route {
+		for d, u := range s.Load {
+			load[d] += u
+		}
+		if !capacity.Fits(load) {
+			violations++
+		}
+	}
+
+	return violations
+}
@@ -9,8 +9,10 @@ package algorithms
 
 import (
 	"context"
+	"fmt"
 	"math"
 	"sort"
+	"strings"
 	"time"
 
 	"github.com/edusalguero/roteiro.git/internal/cost"
@@ -20,6 +22,14 @@ import (
 	"github.com/edusalguero/roteiro.git/internal/routeestimator"
 )
 
+var ErrMustServeUnassigned = fmt.Errorf("must serve requests can not be assigned")
+
+// The assets with costs are compared by the cost of a route of this distance, in meters, and duration
+const (
+	referenceRouteDistance = 50000
+	referenceRouteDuration = time.Hour
+)
+
 type SequentialConstruction struct {
 	logger         logger.Logger
 	routeEstimator routeestimator.Estimator
@@ -30,10 +40,35 @@ func NewSequentialConstruction(l logger.Logger, e routeestimator.Estimator, de c
 	return &SequentialConstruction{logger: l, routeEstimator: e, costEstimator: de}
 }
 
+const SequentialConstructionName = "sequential_construction"
+
+func SequentialConstructionDefinition() Definition {
+	return Definition{
+		Name:        SequentialConstructionName,
+		Description: "Builds the routes one by one, inserting the farthest requests first",
+		New: func(l logger.Logger, e routeestimator.Estimator, de cost.Service, _ Parameters) Algorithm {
+			return NewSequentialConstruction(l, e, de)
+		},
+	}
+}
+
 // Based on algorithm 2: The Sequential Construction
 // https://www.sciencedirect.com/science/article/pii/S131915781100036X#n0040
-// nolint funlen
 func (a *SequentialConstruction) Solve(ctx context.Context, p model.Problem) (*model.Solution, error) {
+	s, err := a.construct(ctx, p, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkMustServe(s.Unassigned); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// The solution of the construction, even when there are must serve requests unassigned. The order perturbs the
+// opening of the assets and the requests tried, nil means the plain construction
+// nolint funlen
+func (a *SequentialConstruction) construct(ctx context.Context, p model.Problem, order *constructionOrder) (*model.Solution, error) {
 	algoStart := time.Now()
 	usedAssets := 0
 	insertedRequests := 0
@@ -41,72 +76,135 @@ func (a *SequentialConstruction) Solve(ctx context.Context, p model.Problem) (*m
 
 	var unassignedRequests model.Requests
 	var solutionRoutes []model.SolutionRoute
+	reasons := make(map[model.Ref][]model.UnassignedReason)
 	var totalDistance float64 = 0
 	var totalDuration time.Duration
 
+	committedAssets := committedRequests(p.Fleet)
 	for i := range p.Requests {
+		if _, ok := committedAssets[p.Requests[i].RequestID]; ok {
+			continue
+		}
 		unassignedRequests = append(unassignedRequests, &p.Requests[i])
 	}
 
-	availableAssets := assetsWithMoreCapacityFirst(p.Fleet)
+	// The assets are sorted and removed from a copy, the problem can be solved again
+	availableAssets := assetsInOpeningOrder(order.shuffle(append([]model.Asset{}, p.Fleet...)))
 	availableAssetsCount := len(availableAssets)
 
+	partial := false
 	for {
 		if len(availableAssets) == 0 {
 			break
 		}
-		var r model.Route
+		if ctx.Err() != nil {
+			partial = true
+			break
+		}
 		var routeReqs []model.Request
-		var err error
 
 		asset := availableAssets[0]
-		assetLocation := asset.Location
-		unassignedRequests := a.sortRequestFromAssetLocationToDropOffFarthestFirst(ctx, assetLocation, unassignedRequests)
+		unassignedRequests := a.sortRequestFromAssetLocationToDropOffFarthestFirst(ctx, asset, unassignedRequests, order)
 		a.logger.Debugf("##  Creating a new route....")
 
-		r = append(r, &model.Stop{Ref: model.Ref(asset.AssetID),
-			Point:    assetLocation,
-			Activity: model.ActivityTypeStart,
-		})
+		r := newAssetRoute(asset, p)
+		r, committed, err := a.addCommittedStops(ctx, r, asset, p)
+		if err != nil {
+			return nil, err
+		}
+		for _, req := range committed {
+			insertedRequests++
+			routeReqs = append(routeReqs, withoutServiceTimes(*req))
+		}
 
 		for i := range unassignedRequests {
-			ur := &unassignedRequests[i]
-			if *ur == nil {
+			if unassignedRequests[i] == nil {
 				continue
 			}
-			req := *ur
-			a.logger.Debugf("###  Adding request a new route: %s", req.RequestID)
-			r = a.addRequestStops(ctx, r, assetLocation, req, p.GetMaxJourneyTimeFactor())
-			r, err = a.hillClimbingRoutingAlgorithmV3(ctx, r, asset)
+			if ctx.Err() != nil {
+				// The route is closed with the requests inserted so far
+				partial = true
+				break
+			}
+			unit := insertionUnit(unassignedRequests, i, p.Constraints)
+			if unit == nil {
+				continue
+			}
+			var members []*model.Request
+			for _, u := range unit {
+				members = append(members, unassignedRequests[u])
+			}
+
+			if assetID, ok := groupAsset(committedAssets, members[0].RequestID, p.Constraints); ok && assetID != asset.AssetID {
+				// The group is committed to another asset
+				for _, req := range members {
+					reasons[req.RequestID] = addReasons(reasons[req.RequestID], model.UnassignedReasonGroup)
+				}
+				continue
+			}
+			if found := incompatibilities(asset, members, routeReqs, p.Constraints); len(found) > 0 {
+				for _, req := range members {
+					own, ok := found[req.RequestID]
+					if !ok {
+						// Other request of the group can not be inserted
+						own = []model.UnassignedReason{model.UnassignedReasonGroup}
+					}
+					reasons[req.RequestID] = addReasons(reasons[req.RequestID], own...)
+				}
+				continue
+			}
+
+			// The hill climbing may reorder the stops already in the route
+			previous := r
+			for _, req := range members {
+				a.logger.Debugf("###  Adding request a new route: %s", req.RequestID)
+				r = a.addRequestStops(ctx, r, asset, req, p)
+				if r, err = a.hillClimbingRoutingAlgorithmV3(ctx, r, asset, p.Objective); err != nil {
+					return nil, err
+				}
+			}
+
+			planned, placed, err := a.withBreaks(ctx, r, asset, p.Departure)
 			if err != nil {
 				return nil, err
 			}
-
-			if a.isFeasibleRoute(ctx, r, asset) {
-				// Remove from unassignedRequests
-				unassignedRequests[i] = nil
-				insertedRequests++
-				routeReqs = append(routeReqs, model.Request{
-					RequestID: req.RequestID,
-					PickUp:    req.PickUp,
-					DropOff:   req.DropOff,
-					Load:      req.Load,
-				})
-			} else {
-				// Remove req from r
-				r = removeFromRoute(r, *req)
+			feasible, violations := a.isFeasibleRoute(ctx, planned, asset, p.Departure)
+			if !placed {
+				feasible = false
+				violations = addReasons(violations, model.UnassignedReasonBreak)
+			}
+			if !feasible {
+				r = previous
+			}
+			for k, req := range members {
+				if feasible {
+					// Remove from unassignedRequests
+					unassignedRequests[unit[k]] = nil
+					insertedRequests++
+					routeReqs = append(routeReqs, withoutServiceTimes(*req))
+				} else {
+					reasons[req.RequestID] = addReasons(reasons[req.RequestID], violations...)
+				}
 			}
 		}
 
 		availableAssets = remove(availableAssets, asset)
+		r, _, err = a.withBreaks(ctx, r, asset, p.Departure)
+		if err != nil {
+			return nil, err
+		}
 		re, _ := a.routeEstimator.GetRouteEstimation(ctx, r.GetPoints())
-		totalDuration += re.TotalDuration
-		totalDistance += re.TotalDistance
+		if err := a.scheduleRoute(ctx, r); err != nil {
+			return nil, err
+		}
+		metrics := newRouteMetrics(r, re, asset, p.Departure)
+		totalDuration += metrics.Duration
+		totalDistance += metrics.Distance
 		solutionRoutes = append(solutionRoutes, model.SolutionRoute{
 			Asset:     asset,
 			Requests:  routeReqs,
-			Waypoints: buildRouteWaypoints(r, asset),
-			Metrics:   model.RouteMetrics{Duration: re.TotalDuration, Distance: re.TotalDistance},
+			Waypoints: buildRouteWaypoints(r, asset, p.Departure),
+			Metrics:   metrics,
 		})
 
 		usedAssets++
@@ -115,29 +213,63 @@ func (a *SequentialConstruction) Solve(ctx context.Context, p model.Problem) (*m
 		}
 	}
 
-	unassigned := getNotAssignedRequest(unassignedRequests)
+	if partial {
+		for _, req := range unassignedRequests {
+			if req != nil {
+				reasons[req.RequestID] = addReasons(reasons[req.RequestID], model.UnassignedReasonStopped)
+			}
+		}
+	}
+	unassigned := getNotAssignedRequest(unassignedRequests, reasons)
 	algoDuration := time.Since(algoStart)
 	s := model.NewSolution(
 		model.NewSolutionMetrics(usedAssets, insertedRequests, len(unassigned), totalDistance, totalDuration, algoDuration),
 		solutionRoutes, unassigned)
+	s.Metrics.UnassignedPenalty = unassignedPenalty(unassigned)
+	s.Metrics.Cost = routesCost(solutionRoutes)
+	s.Metrics.Objective = p.Objective.Breakdown(*s)
+	s.Metrics.Value = solutionValue(p, *s)
+	s.Metrics.Partial = partial
+	s.Metrics.Seed = p.Seed
 
 	a.logger.Debugf("Solution: %v", s)
-
 	return s, nil
 }
 
 func remove(assets []model.Asset, asset model.Asset) []model.Asset {
 	for i, a := range assets {
-		if a == asset {
+		if a.AssetID == asset.AssetID {
 			return append(assets[:i], assets[i+1:]...)
 		}
 	}
 	return assets
 }
 
-func buildRouteWaypoints(r model.Route, asset model.Asset) []model.Waypoint {
+// The route duration includes the waiting and the service times
+func newRouteMetrics(r model.Route, e *routeestimator.Estimation, asset model.Asset, departure time.Time) model.RouteMetrics {
+	start := departure.Add(r[0].ArrivalTime)
+	end := departure.Add(r[len(r)-1].GetDepartureTime())
+	return model.RouteMetrics{
+		Duration: end.Sub(start),
+		Distance: e.TotalDistance,
+		Start:    start,
+		End:      end,
+		Cost:     asset.RouteCost(e.TotalDistance, end.Sub(start)),
+	}
+}
+
+func routesCost(routes []model.SolutionRoute) float64 {
+	total := 0.0
+	for _, sr := range routes {
+		total += sr.Metrics.Cost
+	}
+	return total
+}
+
+// The stops of the route must be scheduled. Every break has its own waypoint
+func buildRouteWaypoints(r model.Route, asset model.Asset, departure time.Time) []model.Waypoint {
 	var waypoints []model.Waypoint
-	var load model.Load = 0
+	load := model.Load{}
 	l := len(r)
 	for i := 0; i < l; {
 		stop := r[i]
@@ -153,11 +285,11 @@ func buildRouteWaypoints(r model.Route, asset model.Asset) []model.Waypoint {
 				break
 			}
 			s := r[j]
-			if s.Point != p {
+			if s.Point != p || (j > i && (s.IsBreak() || stop.IsBreak())) {
 				break
 			}
+			load = load.Add(s.Load)
 			if s.Activity != model.ActivityTypeStart {
-				load += s.Load
 				activities = append(activities, model.NewActivity(s.Activity, s.Ref))
 			}
 			j++
@@ -165,184 +297,700 @@ func buildRouteWaypoints(r model.Route, asset model.Asset) []model.Waypoint {
 		i = j
 
 		waypoints = append(waypoints, model.Waypoint{
-			Location:   p,
-			Load:       load,
-			Activities: activities,
+			Location:     p,
+			Load:         load,
+			Activities:   activities,
+			Arrival:      departure.Add(stop.ArrivalTime),
+			ServiceStart: departure.Add(stop.ServiceTime),
+			Departure:    departure.Add(r[j-1].GetDepartureTime()),
 		})
 	}
 
 	return waypoints
 }
 
-func getNotAssignedRequest(requests model.Requests) []model.Request {
-	var unassigned = make([]model.Request, 0)
+func getNotAssignedRequest(requests model.Requests, reasons map[model.Ref][]model.UnassignedReason) []model.UnassignedRequest {
+	var unassigned = make([]model.UnassignedRequest, 0)
 	for i := range requests {
 		ur := requests[i]
 		if ur == nil {
 			continue
 		}
 
-		// Do no copy calculated service times
-		unassigned = append(unassigned, model.Request{
-			RequestID: ur.RequestID,
-			PickUp:    ur.PickUp,
-			DropOff:   ur.DropOff,
-			Load:      ur.Load,
+		unassigned = append(unassigned, model.UnassignedRequest{
+			Request: withoutServiceTimes(*ur),
+			Reasons: reasons[ur.RequestID],
 		})
 	}
 
 	return unassigned
 }
 
+// The requests of the same vehicle group are inserted together.
+// It returns nil when the group is inserted from a previous request
+func insertionUnit(requests model.Requests, i int, c model.Constraints) []int {
+	unit := []int{i}
+	group := c.GroupOf(requests[i].RequestID)
+	if group == nil {
+		return unit
+	}
+
+	for j, req := range requests {
+		if req == nil || j == i {
+			continue
+		}
+		for _, ref := range group {
+			if req.RequestID != ref {
+				continue
+			}
+			if j < i {
+				return nil
+			}
+			unit = append(unit, j)
+		}
+	}
+	return unit
+}
+
+// The requests can only be inserted in the routes of compatible assets without incompatible requests
+func incompatibilities(
+	asset model.Asset,
+	members []*model.Request,
+	routeReqs []model.Request,
+	c model.Constraints,
+) map[model.Ref][]model.UnassignedReason {
+	found := make(map[model.Ref][]model.UnassignedReason)
+	for _, req := range members {
+		own := assetIncompatibilities(asset, req)
+		if hasIncompatibleRequest(req.RequestID, members, routeReqs, c) {
+			own = append(own, model.UnassignedReasonIncompatible)
+		}
+		if len(own) > 0 {
+			found[req.RequestID] = own
+		}
+	}
+	return found
+}
+
+func hasIncompatibleRequest(ref model.Ref, members []*model.Request, routeReqs []model.Request, c model.Constraints) bool {
+	for _, other := range routeReqs {
+		if c.AreIncompatible(ref, other.RequestID) {
+			return true
+		}
+	}
+	for _, other := range members {
+		if other.RequestID != ref && c.AreIncompatible(ref, other.RequestID) {
+			return true
+		}
+	}
+	return false
+}
+
+// The request can only be inserted in the routes of compatible assets
+func assetIncompatibilities(asset model.Asset, req *model.Request) []model.UnassignedReason {
+	var incompatibilities []model.UnassignedReason
+	if !asset.HasSkills(req.RequiredSkills) {
+		incompatibilities = append(incompatibilities, model.UnassignedReasonSkills)
+	}
+	if !req.IsAllowedFor(asset.AssetID) {
+		incompatibilities = append(incompatibilities, model.UnassignedReasonNotAllowed)
+	}
+	return incompatibilities
+}
+
+func unassignedPenalty(unassigned []model.UnassignedRequest) float64 {
+	penalty := 0.0
+	for _, u := range unassigned {
+		penalty += u.UnassignedPenalty
+	}
+	return penalty
+}
+
+// The must serve requests left out because the solving was stopped could still be served, so they do not make the
+// problem infeasible and the partial solution is returned with them
+func checkMustServe(unassigned []model.UnassignedRequest) error {
+	var refs []string
+	for _, u := range unassigned {
+		if u.MustServe && !isStoppedRequest(u) {
+			refs = append(refs, fmt.Sprintf("%s %v", u.RequestID, u.Reasons))
+		}
+	}
+	if len(refs) > 0 {
+		return fmt.Errorf("%w: %s", ErrMustServeUnassigned, strings.Join(refs, ", "))
+	}
+	return nil
+}
+
+func isStoppedRequest(u model.UnassignedRequest) bool {
+	for _, r := range u.Reasons {
+		if r == model.UnassignedReasonStopped {
+			return true
+		}
+	}
+	return false
+}
+
+// The reasons are not repeated
+func addReasons(reasons []model.UnassignedReason, others ...model.UnassignedReason) []model.UnassignedReason {
+	for _, o := range others {
+		found := false
+		for _, r := range reasons {
+			if r == o {
+				found = true
+				break
+			}
+		}
+		if !found {
+			reasons = append(reasons, o)
+		}
+	}
+	return reasons
+}
+
+// Do no copy calculated service times
+func withoutServiceTimes(req model.Request) model.Request {
+	req.PickUpServiceTime = 0
+	req.DropOffServiceTime = 0
+	return req
+}
+
+// The assets with more capacity are opened first. When the fleet has costs, the assets with the cheapest reference
+// route per unit of capacity are opened first, and then the ones with more capacity
+func assetsInOpeningOrder(assets []model.Asset) []model.Asset {
+	if !hasCosts(assets) {
+		return assetsWithMoreCapacityFirst(assets)
+	}
+	sort.SliceStable(assets, func(i, j int) bool {
+		ci, cj := costPerCapacityUnit(assets[i]), costPerCapacityUnit(assets[j])
+		if ci != cj {
+			return ci < cj
+		}
+		return assets[i].Capacity.Units() > assets[j].Capacity.Units()
+	})
+	return assets
+}
+
 func assetsWithMoreCapacityFirst(assets []model.Asset) []model.Asset {
 	sort.SliceStable(assets, func(i, j int) bool {
-		return assets[i].Capacity > assets[j].Capacity
+		return assets[i].Capacity.Units() > assets[j].Capacity.Units()
 	})
 
 	return assets
 }
 
-func (a *SequentialConstruction) addRequestStops(ctx context.Context, r model.Route, assetLocation point.Point, req *model.Request, timeFactor float64) model.Route {
-	a.updateRequestServiceTime(ctx, assetLocation, req, timeFactor)
-	r = append(r, &model.Stop{
-		Ref:            req.RequestID,
-		Point:          req.PickUp,
-		MaxServiceTime: req.PickUpServiceTime,
-		Load:           req.Load,
-		Activity:       model.ActivityTypePickUp,
-	})
+func hasCosts(assets []model.Asset) bool {
+	for _, asset := range assets {
+		if asset.HasCosts() {
+			return true
+		}
+	}
+	return false
+}
 
-	r = append(r, &model.Stop{
-		Ref:            req.RequestID,
-		Point:          req.DropOff,
-		MaxServiceTime: req.DropOffServiceTime,
-		Load:           -req.Load,
-		Activity:       model.ActivityTypeDropOff,
-	})
+// The cost of the reference route of the asset per unit of capacity. The assets without capacity are the most expensive
+func costPerCapacityUnit(asset model.Asset) float64 {
+	units := asset.Capacity.Units()
+	if units <= 0 {
+		return math.Inf(1)
+	}
+	return asset.RouteCost(referenceRouteDistance, referenceRouteDuration) / float64(units)
+}
+
+// The requests with locked stops or on board of every asset
+func committedRequests(fleet []model.Asset) map[model.Ref]model.AssetID {
+	committed := make(map[model.Ref]model.AssetID)
+	for _, asset := range fleet {
+		for _, ls := range asset.LockedStops {
+			committed[ls.RequestID] = asset.AssetID
+		}
+		for _, ref := range asset.OnboardRequests {
+			committed[ref] = asset.AssetID
+		}
+	}
+	return committed
+}
+
+// The asset of the committed requests of the same vehicle group of the request. The rest of the group can only be
+// inserted in its route
+func groupAsset(committed map[model.Ref]model.AssetID, ref model.Ref, c model.Constraints) (model.AssetID, bool) {
+	for _, member := range c.GroupOf(ref) {
+		if assetID, ok := committed[member]; ok {
+			return assetID, true
+		}
+	}
+	return "", false
+}
+
+// The route starts at the location of the asset, with the initial load and the onboard requests,
+// and finishes at its end location when it has one
+func newAssetRoute(asset model.Asset, p model.Problem) model.Route {
+	load := asset.InitialLoad
+	for _, ref := range asset.OnboardRequests {
+		if req := findRequest(p.Requests, ref); req != nil {
+			load = load.Add(req.Load)
+		}
+	}
+
+	r := model.Route{&model.Stop{Ref: model.Ref(asset.AssetID),
+		Point:           asset.Location,
+		MinServiceTime:  earliestServiceTime(asset.Shift, p.Departure),
+		ServiceDuration: asset.SetupDuration,
+		Load:            load,
+		Activity:        model.ActivityTypeStart,
+	}}
+	if asset.EndLocation != nil {
+		r = append(r, &model.Stop{Ref: model.Ref(asset.AssetID),
+			Point:          *asset.EndLocation,
+			MaxServiceTime: withinHorizon(maxDuration, p),
+			Activity:       model.ActivityTypeEnd,
+		})
+	}
 	return r
 }
 
-// Based on algorithm 1: The HC routing algorithm.
-// https://www.sciencedirect.com/science/article/pii/S131915781100036X#n0035
-func (a *SequentialConstruction) hillClimbingRoutingAlgorithmV3(ctx context.Context, r model.Route, asset model.Asset) (model.Route, error) {
+// The locked stops are served first, in the given order, and keep their position. The drop offs of the onboard
+// requests and the stops of the committed requests that are not locked are inserted after them.
+// It returns the committed requests
+func (a *SequentialConstruction) addCommittedStops(
+	ctx context.Context,
+	r model.Route,
+	asset model.Asset,
+	p model.Problem,
+) (model.Route, []*model.Request, error) {
+	r, committed, dropOffs := a.addLockedStops(ctx, r, asset, p)
+	if len(committed) == 0 {
+		return r, nil, nil
+	}
+
+	r = insertBeforeEnd(r, dropOffs...)
+	r, err := a.hillClimbingRoutingAlgorithmV3(ctx, r, asset, p.Objective)
+	if err != nil {
+		return nil, nil, err
+	}
+	return r, committed, nil
+}
+
+// The locked stops are added in the given order. It returns the committed requests and their drop offs that are not
+// locked, the ones of the onboard requests among them
+func (a *SequentialConstruction) addLockedStops(
+	ctx context.Context,
+	r model.Route,
+	asset model.Asset,
+	p model.Problem,
+) (model.Route, []*model.Request, []*model.Stop) {
+	if len(asset.LockedStops) == 0 && len(asset.OnboardRequests) == 0 {
+		return r, nil, nil
+	}
+
+	var committed []*model.Request
+	stops := make(map[model.Ref][2]*model.Stop)
+	commit := func(ref model.Ref) bool {
+		if _, ok := stops[ref]; ok {
+			return true
+		}
+		req := findRequest(p.Requests, ref)
+		if req == nil {
+			return false
+		}
+		pickUp, dropOff := a.newCommittedStops(ctx, asset, req, p)
+		stops[ref] = [2]*model.Stop{pickUp, dropOff}
+		committed = append(committed, req)
+		return true
+	}
+
+	for _, ls := range asset.LockedStops {
+		if !commit(ls.RequestID) {
+			continue
+		}
+		stop := stops[ls.RequestID][0]
+		if ls.Activity == model.ActivityTypeDropOff {
+			stop = stops[ls.RequestID][1]
+		}
+		if stop != nil {
+			r = insertBeforeEnd(r, stop)
+		}
+	}
+	for _, ref := range asset.OnboardRequests {
+		commit(ref)
+	}
+
+	var dropOffs []*model.Stop
+	for _, req := range committed {
+		if dropOff := stops[req.RequestID][1]; !dropOff.Locked {
+			dropOffs = append(dropOffs, dropOff)
+		}
+	}
+	return r, committed, dropOffs
+}
+
+// The onboard requests only have drop off. The stops locked by the asset are flagged
+func (a *SequentialConstruction) newCommittedStops(
+	ctx context.Context,
+	asset model.Asset,
+	req *model.Request,
+	p model.Problem,
+) (pickUp, dropOff *model.Stop) {
+	pickUp, dropOff = a.newRequestStops(ctx, asset, req, p)
+	if asset.IsOnboard(req.RequestID) {
+		pickUp = nil
+		dropOff.MaxServiceTime = withinHorizon(a.onboardDropOffServiceTime(ctx, asset, req, p), p)
+		dropOff.MaxRideTime = 0
+	}
+	for _, ls := range asset.LockedStops {
+		if ls.RequestID != req.RequestID {
+			continue
+		}
+		if ls.Activity == model.ActivityTypePickUp && pickUp != nil {
+			pickUp.Locked = true
+		}
+		if ls.Activity == model.ActivityTypeDropOff {
+			dropOff.Locked = true
+		}
+	}
+	return pickUp, dropOff
+}
+
+// The explicit time window of the drop off takes precedence over the one derived from the journey time factor,
+// which applies from the location of the asset
+func (a *SequentialConstruction) onboardDropOffServiceTime(
+	ctx context.Context,
+	asset model.Asset,
+	req *model.Request,
+	p model.Problem,
+) time.Duration {
+	if req.DropOffTimeWindow.HasLatest() {
+		return latestServiceTime(req.DropOffTimeWindow, p.Departure)
+	}
+	if !req.DropOffTimeWindow.IsZero() {
+		return maxDuration
+	}
+
+	ready := asset.SetupDuration
+	if shiftStart := earliestServiceTime(asset.Shift, p.Departure); shiftStart > 0 {
+		ready += shiftStart
+	}
+	toDropOff, _ := a.costEstimator.GetCost(ctx, asset.Location, req.DropOff)
+	return ready + increaseDurationInAFactor(toDropOff.Duration, p.GetMaxJourneyTimeFactor())
+}
+
+func findRequest(requests []model.Request, ref model.Ref) *model.Request {
+	for i := range requests {
+		if requests[i].RequestID == ref {
+			return &requests[i]
+		}
+	}
+	return nil
+}
+
+func (a *SequentialConstruction) addRequestStops(ctx context.Context, r model.Route, asset model.Asset, req *model.Request, p model.Problem) model.Route {
+	pickUp, dropOff := a.newRequestStops(ctx, asset, req, p)
+	return insertBeforeEnd(r, pickUp, dropOff)
+}
+
+func (a *SequentialConstruction) newRequestStops(
+	ctx context.Context,
+	asset model.Asset,
+	req *model.Request,
+	p model.Problem,
+) (pickUp, dropOff *model.Stop) {
+	a.updateRequestServiceTime(ctx, asset, req, p.GetMaxJourneyTimeFactor(), p.Departure)
+	pickUp = &model.Stop{
+		Ref:             req.RequestID,
+		Point:           req.PickUp,
+		MinServiceTime:  earliestServiceTime(req.PickUpTimeWindow, p.Departure),
+		MaxServiceTime:  withinHorizon(req.PickUpServiceTime, p),
+		ServiceDuration: req.PickUpDuration.For(req.Load),
+		Load:            req.Load,
+		Activity:        model.ActivityTypePickUp,
+	}
+
+	dropOff = &model.Stop{
+		Ref:             req.RequestID,
+		Point:           req.DropOff,
+		MinServiceTime:  earliestServiceTime(req.DropOffTimeWindow, p.Departure),
+		MaxServiceTime:  withinHorizon(req.DropOffServiceTime, p),
+		ServiceDuration: req.DropOffDuration.For(req.Load),
+		MaxRideTime:     a.maxRideTime(ctx, req),
+		Load:            req.Load.Negate(),
+		Activity:        model.ActivityTypeDropOff,
+	}
+	return pickUp, dropOff
+}
+
+// The tightest of the absolute limit and the one derived from the detour factor
+func (a *SequentialConstruction) maxRideTime(ctx context.Context, req *model.Request) time.Duration {
+	limit := req.MaxRideTime
+	if req.MaxDetourFactor == 0 {
+		return limit
+	}
+
+	direct, err := a.costEstimator.GetCost(ctx, req.PickUp, req.DropOff)
+	if err != nil {
+		a.logger.Debugf("Error getting the direct cost of the request %s: %s", req.RequestID, err)
+		return limit
+	}
+	byFactor := increaseDurationInAFactor(direct.Duration, req.MaxDetourFactor)
+	if limit == 0 || byFactor < limit {
+		return byFactor
+	}
+	return limit
+}
+
+// The stops are added before the arrival of the asset to its end location
+func insertBeforeEnd(r model.Route, stops ...*model.Stop) model.Route {
 	l := len(r)
+	if l == 0 || !r[l-1].IsAssetArrival() {
+		return append(r, stops...)
+	}
+
+	route := make(model.Route, 0, l+len(stops))
+	route = append(route, r[:l-1]...)
+	route = append(route, stops...)
+	return append(route, r[l-1])
+}
+
+// The breaks of the asset are placed, one by one, where the route finishes earlier without adding time window
+// violations. The route must not have breaks. It returns false when a needed break can not be placed
+func (a *SequentialConstruction) withBreaks(
+	ctx context.Context,
+	r model.Route,
+	asset model.Asset,
+	departure time.Time,
+) (model.Route, bool, error) {
+	if len(asset.Breaks) == 0 || countRequests(r) == 0 {
+		return r, true, nil
+	}
+
+	placed := true
+	for _, rule := range asset.Breaks {
+		state, err := a.newRouteState(ctx, r, asset.Capacity)
+		if err != nil {
+			return nil, false, err
+		}
+		driving := state.cumulativeDriving()
+		if !isBreakNeeded(r, state.finish(), driving, rule, departure) {
+			continue
+		}
+		baseline := state.lateFrom(0)
+
+		var best model.Route
+		var bestTWV int
+		var bestEnd time.Duration
+		for i := 0; i < len(r)-1; i++ {
+			if !isWithinDrivingLimit(r, driving, i, rule.AfterDriving) {
+				continue
+			}
+			candidate := insertBreak(r, i, rule, departure)
+			twv, end, err := state.withStop(ctx, a, i, candidate[i+1])
+			if err != nil {
+				return nil, false, err
+			}
+			if best == nil || twv < bestTWV || (twv == bestTWV && end < bestEnd) {
+				best, bestTWV, bestEnd = candidate, twv, end
+			}
+		}
+
+		if best == nil || bestTWV > baseline {
+			placed = false
+			continue
+		}
+		r = best
+	}
+	return r, placed, nil
+}
+
+// The end is the departure from the last stop
+func isBreakNeeded(r model.Route, end time.Duration, driving []time.Duration, rule model.BreakRule, departure time.Time) bool {
+	if !rule.Window.IsZero() && end > earliestServiceTime(rule.Window, departure) {
+		return true
+	}
+	if rule.AfterDriving == 0 {
+		return false
+	}
+
+	from := 0
 	for i := range r {
-		i := l - 1 - i
-		current := r[i]
-		if current.IsAssetDeparture() {
+		if r[i].IsBreak() || i == len(r)-1 {
+			if driving[i]-driving[from] > rule.AfterDriving {
+				return true
+			}
+			from = i
+		}
+	}
+	return false
+}
+
+// The driving time is measured from the previous break, or the start, to the next break, or the end of the route
+func isWithinDrivingLimit(r model.Route, driving []time.Duration, after int, limit time.Duration) bool {
+	if limit == 0 {
+		return true
+	}
+
+	previous := 0
+	for i := after; i > 0; i-- {
+		if r[i].IsBreak() {
+			previous = i
+			break
+		}
+	}
+	next := len(r) - 1
+	for i := after + 1; i < len(r); i++ {
+		if r[i].IsBreak() {
+			next = i
 			break
 		}
-		for j := l - 1; j > 0; j-- {
-			neighbor := r[j]
-			if current.GetMaxServiceTime() > neighbor.GetMaxServiceTime() {
-				rPrima := r
-				costR, err := a.cost(ctx, r, asset)
+	}
+	return driving[after]-driving[previous] <= limit && driving[next]-driving[after] <= limit
+}
+
+// The break is taken at the location of the stop it follows
+func insertBreak(r model.Route, after int, rule model.BreakRule, departure time.Time) model.Route {
+	route := make(model.Route, 0, len(r)+1)
+	route = append(route, r[:after+1]...)
+	route = append(route, &model.Stop{
+		Ref:             rule.ID,
+		Point:           r[after].Point,
+		MinServiceTime:  earliestServiceTime(rule.Window, departure),
+		MaxServiceTime:  latestServiceTime(rule.Window, departure),
+		ServiceDuration: rule.Duration,
+		Activity:        model.ActivityTypeBreak,
+	})
+	return append(route, r[after+1:]...)
+}
+
+// Based on algorithm 1: The HC routing algorithm.
+// https://www.sciencedirect.com/science/article/pii/S131915781100036X#n0035
+// Every stop is tried before the stops with later max service times. A move is kept when the route costs less with
+// it. The route is only planned when the bound of the move given by its state is lower than its cost, and it is
+// checked once it is planned
+func (a *SequentialConstruction) hillClimbingRoutingAlgorithmV3(
+	ctx context.Context,
+	r model.Route,
+	asset model.Asset,
+	o model.Objective,
+) (model.Route, error) {
+	l := len(r)
+	if r[l-1].IsAssetArrival() {
+		// The end location is always the last stop
+		l--
+	}
+	cost, state, err := a.climbingCost(ctx, r, asset, o)
+	if err != nil {
+		return nil, err
+	}
+	// The locked stops are always before the rest
+	for improved := true; improved; {
+		improved = false
+		for i := l - 1; i > 0 && !r[i].Locked; i-- {
+			for j := i - 1; j > 0 && !r[j].Locked; j-- {
+				if r[j].GetMaxServiceTime() <= r[i].GetMaxServiceTime() {
+					continue
+				}
+				bound, err := state.moveBound(ctx, a, i, j, asset.Capacity, o, cost)
 				if err != nil {
 					return nil, err
 				}
-				rPrima.Swap(i, j)
-				costRPrima, err := a.cost(ctx, rPrima, asset)
+				if bound >= cost {
+					continue
+				}
+				candidate := moveStop(r, i, j)
+				c, candidateState, err := a.climbingCost(ctx, candidate, asset, o)
 				if err != nil {
 					return nil, err
 				}
-				if costRPrima-costR < 0 {
-					r = rPrima
-					a.logger.Debugf("Updated r [Cost(%d) vs NewCost(%d)]", costR, costRPrima)
+				if c < cost {
+					r, cost, state, improved = candidate, c, candidateState, true
 				}
 			}
 		}
 	}
+	// The stops are left with the schedule of the route kept
+	state.schedule()
 	return r, nil
 }
 
-// The cost function of a route
-// It is described by the following equation:
-//
-// F(r) =w1×D(r) +w2×T W V(r) +w3×CV(r)
-//
-// where D(r)is the total route duration, including the waiting time and the service time at each location.
-// TWV(r)is the total number of time window violations in the route.
-// CV(r)is the total number of capacity violations.
-// The constants w1,w2, and  w3 are  weights in the range [0,1], and w1+w2+w3= 1.0.
-//
-// The largest penalty should be imposed on the time window violations, in order to direct the search towards more feasible routes.
-// We used the following weights for the route cost function:w1= 0.201,w2= 0.7 and w3= 0.0992.
-func (a *SequentialConstruction) cost(ctx context.Context, r model.Route, asset model.Asset) (float64, error) {
-	const (
-		W1 float64 = 0.201
-		W2 float64 = 0.7
-		W3 float64 = 0.0992
-	)
-
-	points := r.GetPoints()
-	estimation, err := a.routeEstimator.GetRouteEstimation(ctx, points)
-	if err != nil {
-		return math.Inf(0), err
-	}
-
-	// time window constraint violations
-	twv, err := a.countTimeWindowViolations(ctx, r)
-	if err != nil {
-		a.logger.Debugf("Error counting time window violations: %s", err)
-		return math.Inf(0), err
-	}
-	cv := countCapacityViolations(asset.Capacity, r)
-
-	vs := []float64{estimation.TotalDuration.Minutes(), float64(twv), float64(cv)}
-	d := normalize(estimation.TotalDuration.Minutes(), vs)
-	t := normalize(float64(twv), vs)
-	c := normalize(float64(cv), vs)
-	return W1*d + W2*t + W3*c, nil
-}
-
-func normalize(v float64, vs []float64) float64 {
-	return v - smallest(vs)/biggest(vs) - smallest(vs)
+// The stop i is moved before the stop j, j < i. The route is not modified
+func moveStop(r model.Route, i, j int) model.Route {
+	moved := make(model.Route, 0, len(r))
+	moved = append(moved, r[:j]...)
+	moved = append(moved, r[i])
+	moved = append(moved, r[j:i]...)
+	return append(moved, r[i+1:]...)
 }
 
-func smallest(values []float64) float64 {
-	var n, s float64
-	for _, v := range values {
-		if v < n {
-			n = v
-			s = n
-		}
+// The cost of the scheduled route without breaks. The stops out of their time windows or ride times, the loads over
+// the capacity and the drop offs before their pick ups cost more than any objective. It returns the state of the
+// route too
+func (a *SequentialConstruction) climbingCost(
+	ctx context.Context,
+	r model.Route,
+	asset model.Asset,
+	o model.Objective,
+) (float64, *routeState, error) {
+	state, err := a.newRouteState(ctx, r, asset.Capacity)
+	if err != nil {
+		return 0, nil, err
 	}
-	return s
-}
-
-func biggest(values []float64) float64 {
-	var n, b float64
-	for _, v := range values {
-		if v > n {
-			n = v
-			b = n
-		}
+	state.schedule()
+	c, err := a.scheduledCost(ctx, r, o)
+	if err != nil {
+		return 0, nil, err
 	}
-	return b
+	violations := state.lateFrom(0) + countRideTimeViolations(r) + state.fullFrom(0) + state.order
+	return c + violationCost*float64(violations), state, nil
 }
 
+// The requests pinned to the asset go first, then the must serve requests and then the ones with higher priority
+// and penalty. The requests without estimation go after the ones with it, and the already inserted ones at the end
 func (a *SequentialConstruction) sortRequestFromAssetLocationToDropOffFarthestFirst(
 	ctx context.Context,
-	assetLocation point.Point,
+	asset model.Asset,
 	requests model.Requests,
+	order *constructionOrder,
 ) model.Requests {
+	assetLocation := asset.Location
+	// The distances are estimated once, the order is the same whatever the comparisons of the sort are
+	distances := make(map[*model.Request]float64, len(requests))
+	for _, req := range requests {
+		if req == nil {
+			continue
+		}
+		distances[req] = -1
+		if e, err := a.routeEstimator.GetRouteEstimation(ctx, []point.Point{assetLocation, req.PickUp, req.DropOff}); err == nil {
+			distances[req] = order.perturb(e.TotalDistance)
+		}
+	}
 	sort.SliceStable(requests, func(i, j int) bool {
 		if requests[i] == nil || requests[j] == nil {
-			return false
+			return requests[j] == nil && requests[i] != nil
 		}
-		est2i, err := a.routeEstimator.GetRouteEstimation(ctx, []point.Point{assetLocation, requests[i].PickUp, requests[i].DropOff})
-		if err != nil {
-			return false
+		pinnedI, pinnedJ := requests[i].AssetID == asset.AssetID, requests[j].AssetID == asset.AssetID
+		if pinnedI != pinnedJ {
+			return pinnedI
 		}
-		est2j, err := a.routeEstimator.GetRouteEstimation(ctx, []point.Point{assetLocation, requests[j].PickUp, requests[j].DropOff})
-		if err != nil {
-			return true
+		if before, decided := isMoreImportant(requests[i], requests[j]); decided {
+			return before
 		}
-		return est2i.TotalDistance > est2j.TotalDistance
+		return distances[requests[i]] > distances[requests[j]]
 	})
 	return requests
 }
 
+// The must serve requests are more important, then the ones with higher priority and penalty.
+// It returns false as second value when both are equally important
+func isMoreImportant(r1, r2 *model.Request) (bool, bool) {
+	if r1.MustServe != r2.MustServe {
+		return r1.MustServe, true
+	}
+	if r1.Priority != r2.Priority {
+		return r1.Priority > r2.Priority, true
+	}
+	if r1.UnassignedPenalty != r2.UnassignedPenalty {
+		return r1.UnassignedPenalty > r2.UnassignedPenalty, true
+	}
+	return false, false
+}
+
 func removeFromRoute(r model.Route, req model.Request) model.Route {
 	var route model.Route
 	route = append(route, r[0])
@@ -355,73 +1003,171 @@ func removeFromRoute(r model.Route, req model.Request) model.Route {
 	return route
 }
 
-func (a *SequentialConstruction) isFeasibleRoute(ctx context.Context, r model.Route, asset model.Asset) bool {
-	// time window constraint capacityViolations
-	timeWindowViolations, err := a.countTimeWindowViolations(ctx, r)
+// The violated constraints are returned when the route is not feasible. The route is left scheduled
+func (a *SequentialConstruction) isFeasibleRoute(
+	ctx context.Context,
+	r model.Route,
+	asset model.Asset,
+	departure time.Time,
+) (bool, []model.UnassignedReason) {
+	var violations []model.UnassignedReason
+
+	state, err := a.newRouteState(ctx, r, asset.Capacity)
 	if err != nil {
-		a.logger.Debugf("Error counting time window capacityViolations: %s", err)
-		return false
+		a.logger.Debugf("Error scheduling the route: %s", err)
+		return false, nil
+	}
+	state.schedule()
+
+	// time window constraint capacityViolations
+	timeWindowViolations := state.lateFrom(0)
+	if timeWindowViolations > 0 {
+		violations = append(violations, model.UnassignedReasonTimeWindow)
+	}
+
+	// max ride time constraint violations
+	rideTimeViolations := countRideTimeViolations(r)
+	if rideTimeViolations > 0 {
+		violations = append(violations, model.UnassignedReasonMaxRideTime)
 	}
 
 	//  capacity constraint capacityViolations
-	orderViolations := countOrderViolations(r)
+	orderViolations := state.order
 
 	//  capacity constraint capacityViolations
-	capacityViolations := countCapacityViolations(asset.Capacity, r)
+	capacityViolations := state.fullFrom(0)
+	if capacityViolations > 0 {
+		violations = append(violations, model.UnassignedReasonCapacity)
+	}
+
+	// shift and route limits of the asset
+	limitsViolations := state.limitsViolations(asset, departure)
+	violations = append(violations, limitsViolations...)
 
-	feasible := capacityViolations == 0 && timeWindowViolations == 0 && orderViolations == 0
-	a.logger.Debugf("Is Feasible %b [CV: %d / TWV %d / OV: %d ]", feasible, capacityViolations, timeWindowViolations, orderViolations)
-	return feasible
+	feasible := len(violations) == 0 && orderViolations == 0
+	a.logger.Debugf("Is Feasible %b [CV: %d / TWV %d / RTV %d / OV: %d / Limits: %v]",
+		feasible, capacityViolations, timeWindowViolations, rideTimeViolations, orderViolations, limitsViolations)
+	return feasible, violations
 }
 
-func (a *SequentialConstruction) countTimeWindowViolations(ctx context.Context, r model.Route) (int, error) {
-	points := r.GetPoints()
-	twv := 0
-	for i, stop := range r {
-		if i == 0 {
-			// no time from depot to depot
-			continue
+func countRequests(r model.Route) int {
+	requests := 0
+	for _, stop := range r {
+		if stop.Activity == model.ActivityTypePickUp {
+			requests++
 		}
+	}
+	return requests
+}
 
-		e, err := a.routeEstimator.GetRouteEstimation(ctx, points[0:i+1])
-		if err != nil {
-			return 0, err
+// Set the arrival and service times of every stop of the route as offsets from the departure
+func (a *SequentialConstruction) scheduleRoute(ctx context.Context, r model.Route) error {
+	e, err := a.routeEstimator.GetRouteEstimation(ctx, r.GetPoints())
+	if err != nil {
+		return err
+	}
+
+	departure := time.Duration(0)
+	for i, stop := range r {
+		arrival := departure
+		if i > 0 {
+			arrival += e.Legs[i-1].Duration
 		}
-		r[i].ServiceTime = e.TotalDuration // Set route service time
-		if e.TotalDuration > stop.GetMaxServiceTime() {
-			twv++
+		stop.ArrivalTime = arrival
+		stop.ServiceTime = arrival
+		if stop.ServiceTime < stop.GetMinServiceTime() {
+			// The asset arrives early and waits until the time window opens
+			stop.ServiceTime = stop.GetMinServiceTime()
+			if stop.IsAssetDeparture() {
+				// The asset is not available before its shift starts
+				stop.ArrivalTime = stop.ServiceTime
+			}
 		}
+		departure = stop.GetDepartureTime()
 	}
-	return twv, nil
+	return nil
 }
 
+// The max service times are offsets from the departure.
+// The explicit time windows of the request take precedence over the ones derived from the journey time factor.
+// The journey time factor only applies to the driving time, the start of the shift, the setup of the asset and
+// the boarding are added to it
 func (a *SequentialConstruction) updateRequestServiceTime(
 	ctx context.Context,
-	assetLocation point.Point,
+	asset model.Asset,
 	request *model.Request,
 	timeFactor float64,
+	departure time.Time,
 ) {
-	toPickUp, _ := a.costEstimator.GetCost(ctx, assetLocation, request.PickUp)
-	request.PickUpServiceTime = increaseDurationInAFactor(toPickUp.Duration, timeFactor)
+	ready := asset.SetupDuration
+	if shiftStart := earliestServiceTime(asset.Shift, departure); shiftStart > 0 {
+		ready += shiftStart
+	}
+
+	toPickUp, _ := a.costEstimator.GetCost(ctx, asset.Location, request.PickUp)
+	request.PickUpServiceTime = ready + increaseDurationInAFactor(toPickUp.Duration, timeFactor)
+	if !request.PickUpTimeWindow.IsZero() {
+		request.PickUpServiceTime = latestServiceTime(request.PickUpTimeWindow, departure)
+	}
+
+	boarding := request.PickUpDuration.For(request.Load)
+	directRoute, _ := a.routeEstimator.GetRouteEstimation(ctx, []point.Point{asset.Location, request.PickUp, request.DropOff})
+	switch {
+	case request.DropOffTimeWindow.HasLatest():
+		request.DropOffServiceTime = latestServiceTime(request.DropOffTimeWindow, departure)
+	case request.PickUpTimeWindow.HasLatest():
+		// The journey time factor applies from the latest pick up
+		ride := directRoute.TotalDuration - toPickUp.Duration
+		request.DropOffServiceTime = request.PickUpServiceTime + boarding + increaseDurationInAFactor(ride, timeFactor)
+	case !request.PickUpTimeWindow.IsZero() || !request.DropOffTimeWindow.IsZero():
+		request.DropOffServiceTime = maxDuration
+	default:
+		request.DropOffServiceTime = ready + boarding + increaseDurationInAFactor(directRoute.TotalDuration, timeFactor)
+	}
+}
+
+const maxDuration = time.Duration(math.MaxInt64)
+
+func earliestServiceTime(w model.TimeWindow, departure time.Time) time.Duration {
+	if !w.HasEarliest() {
+		return 0
+	}
+	return w.Earliest.Sub(departure)
+}
 
-	directRoute, _ := a.routeEstimator.GetRouteEstimation(ctx, []point.Point{assetLocation, request.PickUp, request.DropOff})
-	request.DropOffServiceTime = increaseDurationInAFactor(directRoute.TotalDuration, timeFactor)
+// Limit the max service time to the end of the planning horizon
+func withinHorizon(maxServiceTime time.Duration, p model.Problem) time.Duration {
+	if p.HorizonEnd.IsZero() {
+		return maxServiceTime
+	}
+	if horizon := p.HorizonEnd.Sub(p.Departure); horizon < maxServiceTime {
+		return horizon
+	}
+	return maxServiceTime
+}
+
+func latestServiceTime(w model.TimeWindow, departure time.Time) time.Duration {
+	if !w.HasLatest() {
+		return maxDuration
+	}
+	return w.Latest.Sub(departure)
 }
 
-func countOrderViolations(r model.Route) int {
+// The ride time goes from the departure of the pick up to the service of the drop off. The route must be scheduled
+func countRideTimeViolations(r model.Route) int {
 	violations := 0
 	for i, stop := range r {
-		if stop.Activity == model.ActivityTypeStart {
+		if stop.Activity != model.ActivityTypeDropOff || stop.MaxRideTime == 0 {
 			continue
 		}
-		for j := i; j < len(r); j++ {
-			if r[j].Ref != stop.Ref {
+		for j := i - 1; j >= 0; j-- {
+			if r[j].Ref != stop.Ref || r[j].Activity != model.ActivityTypePickUp {
 				continue
 			}
-
-			if r[j].Activity == model.ActivityTypePickUp && stop.Activity == model.ActivityTypeDropOff {
+			if stop.ServiceTime-r[j].GetDepartureTime() > stop.MaxRideTime {
 				violations++
 			}
+			break
 		}
 	}
 
@@ -432,16 +1178,3 @@ func increaseDurationInAFactor(duration time.Duration, factor float64) time.Dura
 	d := float64(duration.Nanoseconds()) * factor
 	return time.Duration(d)
 }
-
-func countCapacityViolations(capacity model.Capacity, route model.Route) int {
-	violations := 0
-	load := 0
-	for _, s := range route {
-		load += int(s.Load)
-		if load > int(capacity) {
-			violations++
-		}
-	}
-
-	return violations
-}
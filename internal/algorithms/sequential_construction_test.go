@@ -2,8 +2,11 @@ package algorithms
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"math/rand"
 	"testing"
+	"time"
 
 	"github.com/edusalguero/roteiro.git/internal/distanceestimator"
 	"github.com/edusalguero/roteiro.git/internal/logger"
@@ -20,6 +23,7 @@ var sadaLoc = point.NewPoint(43.347306, -8.276904)
 var pontevedraLoc = point.NewPoint(42.4336114, -8.6475)
 var vilalbaLoc = point.NewPoint(43.296272, -7.67861)
 var oneOrigin = point.NewPoint(4.68295, -74.04965)
+var departure = time.Date(2020, 12, 1, 8, 0, 0, 0, time.UTC)
 
 type Route []point.Point
 
@@ -33,7 +37,7 @@ func TestSequentialConstruction_Solve(t *testing.T) {
 		name       string
 		problem    model.Problem
 		routes     []Route
-		unassigned []model.Request
+		unassigned []model.UnassignedRequest
 		wantErr    bool
 		skip       bool
 	}{
@@ -44,7 +48,7 @@ func TestSequentialConstruction_Solve(t *testing.T) {
 					{
 						AssetID:  "Miño Asset",
 						Location: minoLoc,
-						Capacity: 4,
+						Capacity: model.NewCapacity(4),
 					},
 				},
 				Requests: []model.Request{
@@ -52,25 +56,25 @@ func TestSequentialConstruction_Solve(t *testing.T) {
 						RequestID: "As Pontes 1",
 						PickUp:    aspontesLoc,
 						DropOff:   sadaLoc,
-						Load:      1,
+						Load:      model.NewLoad(1),
 					},
 					{
 						RequestID: "As Pontes 2",
 						PickUp:    aspontesLoc,
 						DropOff:   sadaLoc,
-						Load:      1,
+						Load:      model.NewLoad(1),
 					},
 					{
 						RequestID: "As Pontes 3",
 						PickUp:    aspontesLoc,
 						DropOff:   sadaLoc,
-						Load:      1,
+						Load:      model.NewLoad(1),
 					},
 					{
 						RequestID: "As Pontes 4",
 						PickUp:    aspontesLoc,
 						DropOff:   sadaLoc,
-						Load:      1,
+						Load:      model.NewLoad(1),
 					},
 				},
 				Constraints: model.Constraints{
@@ -78,7 +82,7 @@ func TestSequentialConstruction_Solve(t *testing.T) {
 				},
 			},
 			[]Route{[]point.Point{minoLoc, aspontesLoc, sadaLoc}},
-			[]model.Request{},
+			[]model.UnassignedRequest{},
 			false,
 			false,
 		},
@@ -89,7 +93,7 @@ func TestSequentialConstruction_Solve(t *testing.T) {
 					{
 						AssetID:  "Miño Asset",
 						Location: minoLoc,
-						Capacity: 2,
+						Capacity: model.NewCapacity(2),
 					},
 				},
 				Requests: []model.Request{
@@ -97,25 +101,25 @@ func TestSequentialConstruction_Solve(t *testing.T) {
 						RequestID: "As Pontes 1",
 						PickUp:    aspontesLoc,
 						DropOff:   sadaLoc,
-						Load:      1,
+						Load:      model.NewLoad(1),
 					},
 					{
 						RequestID: "As Pontes 2",
 						PickUp:    aspontesLoc,
 						DropOff:   sadaLoc,
-						Load:      1,
+						Load:      model.NewLoad(1),
 					},
 					{
 						RequestID: "As Pontes 3",
 						PickUp:    aspontesLoc,
 						DropOff:   sadaLoc,
-						Load:      1,
+						Load:      model.NewLoad(1),
 					},
 					{
 						RequestID: "As Pontes 4",
 						PickUp:    aspontesLoc,
 						DropOff:   sadaLoc,
-						Load:      1,
+						Load:      model.NewLoad(1),
 					},
 				},
 				Constraints: model.Constraints{
@@ -123,18 +127,24 @@ func TestSequentialConstruction_Solve(t *testing.T) {
 				},
 			},
 			[]Route{[]point.Point{minoLoc, aspontesLoc, sadaLoc}},
-			[]model.Request{
+			[]model.UnassignedRequest{
 				{
-					RequestID: "As Pontes 3",
-					PickUp:    aspontesLoc,
-					DropOff:   sadaLoc,
-					Load:      1,
+					Request: model.Request{
+						RequestID: "As Pontes 3",
+						PickUp:    aspontesLoc,
+						DropOff:   sadaLoc,
+						Load:      model.NewLoad(1),
+					},
+					Reasons: []model.UnassignedReason{model.UnassignedReasonCapacity},
 				},
 				{
-					RequestID: "As Pontes 4",
-					PickUp:    aspontesLoc,
-					DropOff:   sadaLoc,
-					Load:      1,
+					Request: model.Request{
+						RequestID: "As Pontes 4",
+						PickUp:    aspontesLoc,
+						DropOff:   sadaLoc,
+						Load:      model.NewLoad(1),
+					},
+					Reasons: []model.UnassignedReason{model.UnassignedReasonCapacity},
 				},
 			},
 			false,
@@ -147,12 +157,12 @@ func TestSequentialConstruction_Solve(t *testing.T) {
 					{
 						AssetID:  "Miño Asset",
 						Location: minoLoc,
-						Capacity: 2,
+						Capacity: model.NewCapacity(2),
 					},
 					{
 						AssetID:  "As Pontes Asset",
 						Location: aspontesLoc,
-						Capacity: 2,
+						Capacity: model.NewCapacity(2),
 					},
 				},
 				Requests: []model.Request{
@@ -160,25 +170,25 @@ func TestSequentialConstruction_Solve(t *testing.T) {
 						RequestID: "As Pontes 1",
 						PickUp:    aspontesLoc,
 						DropOff:   sadaLoc,
-						Load:      1,
+						Load:      model.NewLoad(1),
 					},
 					{
 						RequestID: "As Pontes 2",
 						PickUp:    aspontesLoc,
 						DropOff:   sadaLoc,
-						Load:      1,
+						Load:      model.NewLoad(1),
 					},
 					{
 						RequestID: "As Pontes 3",
 						PickUp:    aspontesLoc,
 						DropOff:   sadaLoc,
-						Load:      1,
+						Load:      model.NewLoad(1),
 					},
 					{
 						RequestID: "As Pontes 4",
 						PickUp:    aspontesLoc,
 						DropOff:   sadaLoc,
-						Load:      1,
+						Load:      model.NewLoad(1),
 					},
 				},
 
@@ -190,7 +200,7 @@ func TestSequentialConstruction_Solve(t *testing.T) {
 				[]point.Point{minoLoc, aspontesLoc, sadaLoc},
 				[]point.Point{aspontesLoc, sadaLoc},
 			},
-			[]model.Request{},
+			[]model.UnassignedRequest{},
 			false,
 			false,
 		},
@@ -201,12 +211,12 @@ func TestSequentialConstruction_Solve(t *testing.T) {
 					{
 						AssetID:  "As Pontes Asset",
 						Location: aspontesLoc,
-						Capacity: 2,
+						Capacity: model.NewCapacity(2),
 					},
 					{
 						AssetID:  "Miño Asset",
 						Location: minoLoc,
-						Capacity: 1,
+						Capacity: model.NewCapacity(1),
 					},
 				},
 				Requests: []model.Request{
@@ -214,25 +224,25 @@ func TestSequentialConstruction_Solve(t *testing.T) {
 						RequestID: "As Pontes 1",
 						PickUp:    aspontesLoc,
 						DropOff:   sadaLoc,
-						Load:      1,
+						Load:      model.NewLoad(1),
 					},
 					{
 						RequestID: "As Pontes 2",
 						PickUp:    aspontesLoc,
 						DropOff:   sadaLoc,
-						Load:      1,
+						Load:      model.NewLoad(1),
 					},
 					{
 						RequestID: "As Pontes 3",
 						PickUp:    aspontesLoc,
 						DropOff:   sadaLoc,
-						Load:      1,
+						Load:      model.NewLoad(1),
 					},
 					{
 						RequestID: "As Pontes 4",
 						PickUp:    aspontesLoc,
 						DropOff:   sadaLoc,
-						Load:      1,
+						Load:      model.NewLoad(1),
 					},
 				},
 
@@ -244,12 +254,17 @@ func TestSequentialConstruction_Solve(t *testing.T) {
 				[]point.Point{aspontesLoc, sadaLoc},
 				[]point.Point{minoLoc, aspontesLoc, sadaLoc},
 			},
-			[]model.Request{{
-				RequestID: "As Pontes 4",
-				PickUp:    aspontesLoc,
-				DropOff:   sadaLoc,
-				Load:      1,
-			}},
+			[]model.UnassignedRequest{
+				{
+					Request: model.Request{
+						RequestID: "As Pontes 4",
+						PickUp:    aspontesLoc,
+						DropOff:   sadaLoc,
+						Load:      model.NewLoad(1),
+					},
+					Reasons: []model.UnassignedReason{model.UnassignedReasonCapacity},
+				},
+			},
 			false,
 			false,
 		},
@@ -260,12 +275,12 @@ func TestSequentialConstruction_Solve(t *testing.T) {
 					{
 						AssetID:  "As Pontes Asset",
 						Location: aspontesLoc,
-						Capacity: 2,
+						Capacity: model.NewCapacity(2),
 					},
 					{
 						AssetID:  "Miño Asset",
 						Location: minoLoc,
-						Capacity: 1,
+						Capacity: model.NewCapacity(1),
 					},
 				},
 				Requests: []model.Request{
@@ -273,25 +288,25 @@ func TestSequentialConstruction_Solve(t *testing.T) {
 						RequestID: "As Pontes 1",
 						PickUp:    aspontesLoc,
 						DropOff:   sadaLoc,
-						Load:      1,
+						Load:      model.NewLoad(1),
 					},
 					{
 						RequestID: "As Pontes 2",
 						PickUp:    aspontesLoc,
 						DropOff:   sadaLoc,
-						Load:      1,
+						Load:      model.NewLoad(1),
 					},
 					{
 						RequestID: "As Pontes 3",
 						PickUp:    aspontesLoc,
 						DropOff:   sadaLoc,
-						Load:      3,
+						Load:      model.NewLoad(3),
 					},
 					{
 						RequestID: "As Pontes 4",
 						PickUp:    aspontesLoc,
 						DropOff:   sadaLoc,
-						Load:      1,
+						Load:      model.NewLoad(1),
 					},
 				},
 
@@ -303,12 +318,17 @@ func TestSequentialConstruction_Solve(t *testing.T) {
 				[]point.Point{aspontesLoc, sadaLoc},
 				[]point.Point{minoLoc, aspontesLoc, sadaLoc},
 			},
-			[]model.Request{{
-				RequestID: "As Pontes 3",
-				PickUp:    aspontesLoc,
-				DropOff:   sadaLoc,
-				Load:      3,
-			}},
+			[]model.UnassignedRequest{
+				{
+					Request: model.Request{
+						RequestID: "As Pontes 3",
+						PickUp:    aspontesLoc,
+						DropOff:   sadaLoc,
+						Load:      model.NewLoad(3),
+					},
+					Reasons: []model.UnassignedReason{model.UnassignedReasonCapacity},
+				},
+			},
 			false,
 			false,
 		},
@@ -319,12 +339,12 @@ func TestSequentialConstruction_Solve(t *testing.T) {
 					{
 						AssetID:  "As Pontes Asset",
 						Location: aspontesLoc,
-						Capacity: 3,
+						Capacity: model.NewCapacity(3),
 					},
 					{
 						AssetID:  "Miño Asset",
 						Location: minoLoc,
-						Capacity: 2,
+						Capacity: model.NewCapacity(2),
 					},
 				},
 				Requests: []model.Request{
@@ -332,25 +352,25 @@ func TestSequentialConstruction_Solve(t *testing.T) {
 						RequestID: "As Pontes 1",
 						PickUp:    aspontesLoc,
 						DropOff:   sadaLoc,
-						Load:      1,
+						Load:      model.NewLoad(1),
 					},
 					{
 						RequestID: "As Pontes 2",
 						PickUp:    aspontesLoc,
 						DropOff:   sadaLoc,
-						Load:      1,
+						Load:      model.NewLoad(1),
 					},
 					{
 						RequestID: "As Pontes 3",
 						PickUp:    aspontesLoc,
 						DropOff:   sadaLoc,
-						Load:      1,
+						Load:      model.NewLoad(1),
 					},
 					{
 						RequestID: "As Pontes 4",
 						PickUp:    aspontesLoc,
 						DropOff:   sadaLoc,
-						Load:      1,
+						Load:      model.NewLoad(1),
 					},
 				},
 
@@ -362,7 +382,7 @@ func TestSequentialConstruction_Solve(t *testing.T) {
 				[]point.Point{aspontesLoc, sadaLoc},
 				[]point.Point{minoLoc, aspontesLoc, sadaLoc},
 			},
-			[]model.Request{},
+			[]model.UnassignedRequest{},
 			false,
 			false,
 		},
@@ -373,17 +393,17 @@ func TestSequentialConstruction_Solve(t *testing.T) {
 					{
 						AssetID:  "Sada Asset",
 						Location: sadaLoc,
-						Capacity: 4,
+						Capacity: model.NewCapacity(4),
 					},
 					{
 						AssetID:  "Sada Asset",
 						Location: sadaLoc,
-						Capacity: 4,
+						Capacity: model.NewCapacity(4),
 					},
 					{
 						AssetID:  "Sada Asset",
 						Location: sadaLoc,
-						Capacity: 4,
+						Capacity: model.NewCapacity(4),
 					},
 				},
 				Requests: []model.Request{
@@ -391,25 +411,25 @@ func TestSequentialConstruction_Solve(t *testing.T) {
 						RequestID: "Pontevedra - Sada",
 						PickUp:    pontevedraLoc, // Pontevedra
 						DropOff:   sadaLoc,       // Sada
-						Load:      1,
+						Load:      model.NewLoad(1),
 					},
 					{
 						RequestID: "Vilalba - Sada",
 						PickUp:    vilalbaLoc, // Vilalba
 						DropOff:   sadaLoc,    // Sada
-						Load:      1,
+						Load:      model.NewLoad(1),
 					},
 					{
 						RequestID: "As Pontes - Sada",
 						PickUp:    aspontesLoc, // As Pontes
 						DropOff:   sadaLoc,     // Sada
-						Load:      1,
+						Load:      model.NewLoad(1),
 					},
 					{
 						RequestID: "As Pontes - Miño",
 						PickUp:    aspontesLoc, // As Pontes
 						DropOff:   minoLoc,     // Miño
-						Load:      1,
+						Load:      model.NewLoad(1),
 					},
 				},
 				Constraints: model.Constraints{
@@ -421,7 +441,7 @@ func TestSequentialConstruction_Solve(t *testing.T) {
 				[]point.Point{sadaLoc, aspontesLoc, vilalbaLoc, sadaLoc},
 				[]point.Point{sadaLoc, aspontesLoc, minoLoc},
 			},
-			[]model.Request{},
+			[]model.UnassignedRequest{},
 			false,
 			false,
 		},
@@ -432,7 +452,7 @@ func TestSequentialConstruction_Solve(t *testing.T) {
 					{
 						AssetID:  "Pontedeume Asset",
 						Location: pontedeumeLoc,
-						Capacity: 4,
+						Capacity: model.NewCapacity(4),
 					},
 				},
 				Requests: []model.Request{
@@ -440,13 +460,13 @@ func TestSequentialConstruction_Solve(t *testing.T) {
 						RequestID: "As Pontes - Sada",
 						PickUp:    aspontesLoc, // As Pontes
 						DropOff:   sadaLoc,     // Sada
-						Load:      1,
+						Load:      model.NewLoad(1),
 					},
 					{
 						RequestID: "Miño - As Pontes",
 						PickUp:    minoLoc,     // Miño
 						DropOff:   aspontesLoc, // As Pontes
-						Load:      1,
+						Load:      model.NewLoad(1),
 					},
 				},
 				Constraints: model.Constraints{
@@ -456,7 +476,7 @@ func TestSequentialConstruction_Solve(t *testing.T) {
 			[]Route{
 				[]point.Point{pontedeumeLoc, minoLoc, aspontesLoc, sadaLoc},
 			},
-			[]model.Request{},
+			[]model.UnassignedRequest{},
 			false,
 			false,
 		},
@@ -467,7 +487,7 @@ func TestSequentialConstruction_Solve(t *testing.T) {
 					{
 						AssetID:  "Asset",
 						Location: point.NewPoint(49.2553636, -123.0873365),
-						Capacity: 4,
+						Capacity: model.NewCapacity(4),
 					},
 				},
 				Requests: []model.Request{
@@ -475,13 +495,13 @@ func TestSequentialConstruction_Solve(t *testing.T) {
 						RequestID: "Order 1",
 						PickUp:    point.NewPoint(49.227107, -123.1163085),
 						DropOff:   point.NewPoint(49.2474624, -123.1532338),
-						Load:      1,
+						Load:      model.NewLoad(1),
 					},
 					{
 						RequestID: "Order 2",
 						PickUp:    point.NewPoint(49.2474624, -123.1532338),
 						DropOff:   point.NewPoint(49.287107, -122.1163085),
-						Load:      1,
+						Load:      model.NewLoad(1),
 					},
 				},
 				Constraints: model.Constraints{
@@ -496,7 +516,406 @@ func TestSequentialConstruction_Solve(t *testing.T) {
 					point.NewPoint(49.287107, -122.1163085),  // Order 2 Drop off
 				},
 			},
-			[]model.Request{},
+			[]model.UnassignedRequest{},
+			false,
+			false,
+		},
+		{
+			"Multiple capacity dimensions",
+			model.Problem{
+				Fleet: []model.Asset{
+					{
+						AssetID:  "Miño Van",
+						Location: minoLoc,
+						Capacity: model.Capacity{"seated": 2, "wheelchair": 1},
+					},
+				},
+				Requests: []model.Request{
+					{
+						RequestID: "As Pontes 1",
+						PickUp:    aspontesLoc,
+						DropOff:   sadaLoc,
+						Load:      model.Load{"seated": 1},
+					},
+					{
+						RequestID: "As Pontes 2",
+						PickUp:    aspontesLoc,
+						DropOff:   sadaLoc,
+						Load:      model.Load{"wheelchair": 1},
+					},
+					{
+						RequestID: "As Pontes 3",
+						PickUp:    aspontesLoc,
+						DropOff:   sadaLoc,
+						Load:      model.Load{"wheelchair": 1},
+					},
+					{
+						RequestID: "As Pontes 4",
+						PickUp:    aspontesLoc,
+						DropOff:   sadaLoc,
+						Load:      model.Load{"seated": 1, "luggage": 1},
+					},
+				},
+				Constraints: model.Constraints{
+					MaxJourneyTimeFactor: 1.5,
+				},
+			},
+			[]Route{[]point.Point{minoLoc, aspontesLoc, sadaLoc}},
+			[]model.UnassignedRequest{
+				{
+					Request: model.Request{
+						RequestID: "As Pontes 3",
+						PickUp:    aspontesLoc,
+						DropOff:   sadaLoc,
+						Load:      model.Load{"wheelchair": 1},
+					},
+					Reasons: []model.UnassignedReason{model.UnassignedReasonCapacity},
+				},
+				{
+					Request: model.Request{
+						RequestID: "As Pontes 4",
+						PickUp:    aspontesLoc,
+						DropOff:   sadaLoc,
+						Load:      model.Load{"seated": 1, "luggage": 1},
+					},
+					Reasons: []model.UnassignedReason{model.UnassignedReasonCapacity},
+				},
+			},
+			false,
+			false,
+		},
+		{
+			"Time windows",
+			model.Problem{
+				Fleet: []model.Asset{
+					{
+						AssetID:  "Pontedeume Asset",
+						Location: pontedeumeLoc,
+						Capacity: model.NewCapacity(4),
+					},
+				},
+				Requests: []model.Request{
+					{
+						RequestID: "Miño - Sada",
+						PickUp:    minoLoc,
+						DropOff:   sadaLoc,
+						Load:      model.NewLoad(1),
+						PickUpTimeWindow: model.TimeWindow{
+							Earliest: departure.Add(time.Hour),
+							Latest:   departure.Add(70 * time.Minute),
+						},
+					},
+					{
+						RequestID: "Sada - Pontedeume",
+						PickUp:    sadaLoc,
+						DropOff:   pontedeumeLoc,
+						Load:      model.NewLoad(1),
+						PickUpTimeWindow: model.TimeWindow{
+							Latest: departure.Add(15 * time.Minute),
+						},
+					},
+					{
+						RequestID: "As Pontes - Sada",
+						PickUp:    aspontesLoc,
+						DropOff:   sadaLoc,
+						Load:      model.NewLoad(1),
+						DropOffTimeWindow: model.TimeWindow{
+							Latest: departure.Add(30 * time.Minute),
+						},
+					},
+				},
+				Constraints: model.Constraints{
+					MaxJourneyTimeFactor: 1.5,
+				},
+				Departure: departure,
+			},
+			[]Route{
+				[]point.Point{pontedeumeLoc, sadaLoc, pontedeumeLoc, minoLoc, sadaLoc},
+			},
+			[]model.UnassignedRequest{
+				{
+					Request: model.Request{
+						RequestID: "As Pontes - Sada",
+						PickUp:    aspontesLoc,
+						DropOff:   sadaLoc,
+						Load:      model.NewLoad(1),
+						DropOffTimeWindow: model.TimeWindow{
+							Latest: departure.Add(30 * time.Minute),
+						},
+					},
+					Reasons: []model.UnassignedReason{model.UnassignedReasonTimeWindow},
+				},
+			},
+			false,
+			false,
+		},
+		{
+			"Planning horizon",
+			model.Problem{
+				Fleet: []model.Asset{
+					{
+						AssetID:  "Miño Asset",
+						Location: minoLoc,
+						Capacity: model.NewCapacity(4),
+					},
+				},
+				Requests: []model.Request{
+					{
+						RequestID: "As Pontes - Sada",
+						PickUp:    aspontesLoc,
+						DropOff:   sadaLoc,
+						Load:      model.NewLoad(1),
+					},
+					{
+						RequestID: "Miño - Sada",
+						PickUp:    minoLoc,
+						DropOff:   sadaLoc,
+						Load:      model.NewLoad(1),
+					},
+				},
+				Constraints: model.Constraints{
+					MaxJourneyTimeFactor: 1.5,
+				},
+				Departure:  departure,
+				HorizonEnd: departure.Add(30 * time.Minute),
+			},
+			[]Route{
+				[]point.Point{minoLoc, sadaLoc},
+			},
+			[]model.UnassignedRequest{
+				{
+					Request: model.Request{
+						RequestID: "As Pontes - Sada",
+						PickUp:    aspontesLoc,
+						DropOff:   sadaLoc,
+						Load:      model.NewLoad(1),
+					},
+					Reasons: []model.UnassignedReason{model.UnassignedReasonTimeWindow},
+				},
+			},
+			false,
+			false,
+		},
+		{
+			"End depots",
+			model.Problem{
+				Fleet: []model.Asset{
+					{
+						AssetID:     "Miño Asset",
+						Location:    minoLoc,
+						EndLocation: &minoLoc,
+						Capacity:    model.NewCapacity(1),
+					},
+					{
+						AssetID:     "As Pontes Asset",
+						Location:    aspontesLoc,
+						EndLocation: &pontedeumeLoc,
+						Capacity:    model.NewCapacity(1),
+					},
+				},
+				Requests: []model.Request{
+					{
+						RequestID: "As Pontes - Sada",
+						PickUp:    aspontesLoc,
+						DropOff:   sadaLoc,
+						Load:      model.NewLoad(1),
+					},
+					{
+						RequestID: "Miño - Sada",
+						PickUp:    minoLoc,
+						DropOff:   sadaLoc,
+						Load:      model.NewLoad(1),
+					},
+				},
+				Constraints: model.Constraints{
+					MaxJourneyTimeFactor: 2,
+				},
+				Departure: departure,
+			},
+			[]Route{
+				[]point.Point{minoLoc, sadaLoc, aspontesLoc, sadaLoc, minoLoc},
+			},
+			[]model.UnassignedRequest{},
+			false,
+			false,
+		},
+		{
+			"Asset shifts and route limits",
+			model.Problem{
+				Fleet: []model.Asset{
+					{
+						AssetID:     "Miño Asset",
+						Location:    minoLoc,
+						Capacity:    model.NewCapacity(4),
+						MaxRequests: 1,
+					},
+					{
+						AssetID:     "As Pontes Asset",
+						Location:    aspontesLoc,
+						Capacity:    model.NewCapacity(2),
+						Shift:       model.TimeWindow{Latest: departure.Add(10 * time.Minute)},
+						MaxDuration: 20 * time.Minute,
+						MaxDistance: 10000,
+					},
+				},
+				Requests: []model.Request{
+					{
+						RequestID: "As Pontes - Sada",
+						PickUp:    aspontesLoc,
+						DropOff:   sadaLoc,
+						Load:      model.NewLoad(1),
+					},
+					{
+						RequestID: "Miño - Sada",
+						PickUp:    minoLoc,
+						DropOff:   sadaLoc,
+						Load:      model.NewLoad(1),
+					},
+				},
+				Constraints: model.Constraints{
+					MaxJourneyTimeFactor: 2,
+				},
+				Departure: departure,
+			},
+			[]Route{
+				[]point.Point{minoLoc, aspontesLoc, sadaLoc},
+				[]point.Point{aspontesLoc},
+			},
+			[]model.UnassignedRequest{
+				{
+					Request: model.Request{
+						RequestID: "Miño - Sada",
+						PickUp:    minoLoc,
+						DropOff:   sadaLoc,
+						Load:      model.NewLoad(1),
+					},
+					Reasons: []model.UnassignedReason{
+						model.UnassignedReasonMaxRequests,
+						model.UnassignedReasonShift,
+						model.UnassignedReasonMaxDuration,
+						model.UnassignedReasonMaxDistance,
+					},
+				},
+			},
+			false,
+			false,
+		},
+		{
+			"Max ride times",
+			model.Problem{
+				Fleet: []model.Asset{
+					{
+						AssetID:  "Miño Asset",
+						Location: minoLoc,
+						Capacity: model.NewCapacity(4),
+					},
+				},
+				Requests: []model.Request{
+					{
+						RequestID:   "As Pontes - Sada 1",
+						PickUp:      aspontesLoc,
+						DropOff:     sadaLoc,
+						Load:        model.NewLoad(1),
+						MaxRideTime: 20 * time.Minute,
+					},
+					{
+						RequestID:       "As Pontes - Sada 2",
+						PickUp:          aspontesLoc,
+						DropOff:         sadaLoc,
+						Load:            model.NewLoad(1),
+						MaxDetourFactor: 1.1,
+					},
+				},
+				Constraints: model.Constraints{
+					MaxJourneyTimeFactor: 1.5,
+				},
+				Departure: departure,
+			},
+			[]Route{
+				[]point.Point{minoLoc, aspontesLoc, sadaLoc},
+			},
+			[]model.UnassignedRequest{
+				{
+					Request: model.Request{
+						RequestID:   "As Pontes - Sada 1",
+						PickUp:      aspontesLoc,
+						DropOff:     sadaLoc,
+						Load:        model.NewLoad(1),
+						MaxRideTime: 20 * time.Minute,
+					},
+					Reasons: []model.UnassignedReason{model.UnassignedReasonMaxRideTime},
+				},
+			},
+			false,
+			false,
+		},
+		{
+			"Skills and allowed assets",
+			model.Problem{
+				Fleet: []model.Asset{
+					{
+						AssetID:  "Miño Asset",
+						Location: minoLoc,
+						Capacity: model.NewCapacity(4),
+						Skills:   []model.Skill{"wheelchair_ramp"},
+					},
+					{
+						AssetID:  "As Pontes Asset",
+						Location: aspontesLoc,
+						Capacity: model.NewCapacity(2),
+					},
+				},
+				Requests: []model.Request{
+					{
+						RequestID:      "Wheelchair",
+						PickUp:         aspontesLoc,
+						DropOff:        sadaLoc,
+						Load:           model.NewLoad(1),
+						RequiredSkills: []model.Skill{"wheelchair_ramp"},
+					},
+					{
+						RequestID:     "Only As Pontes Asset",
+						PickUp:        aspontesLoc,
+						DropOff:       sadaLoc,
+						Load:          model.NewLoad(1),
+						AllowedAssets: []model.AssetID{"As Pontes Asset"},
+					},
+					{
+						RequestID:       "Not Miño Asset",
+						PickUp:          aspontesLoc,
+						DropOff:         sadaLoc,
+						Load:            model.NewLoad(1),
+						ForbiddenAssets: []model.AssetID{"Miño Asset"},
+					},
+					{
+						RequestID:      "Child seat",
+						PickUp:         aspontesLoc,
+						DropOff:        sadaLoc,
+						Load:           model.NewLoad(1),
+						RequiredSkills: []model.Skill{"child_seat"},
+					},
+				},
+				Constraints: model.Constraints{
+					MaxJourneyTimeFactor: 1.5,
+				},
+				Departure: departure,
+			},
+			[]Route{
+				[]point.Point{minoLoc, aspontesLoc, sadaLoc},
+				[]point.Point{aspontesLoc, sadaLoc},
+			},
+			[]model.UnassignedRequest{
+				{
+					Request: model.Request{
+						RequestID:      "Child seat",
+						PickUp:         aspontesLoc,
+						DropOff:        sadaLoc,
+						Load:           model.NewLoad(1),
+						RequiredSkills: []model.Skill{"child_seat"},
+					},
+					Reasons: []model.UnassignedReason{model.UnassignedReasonSkills},
+				},
+			},
 			false,
 			false,
 		},
@@ -507,42 +926,42 @@ func TestSequentialConstruction_Solve(t *testing.T) {
 					{
 						AssetID:  "Asset 1",
 						Location: oneOrigin,
-						Capacity: 4,
+						Capacity: model.NewCapacity(4),
 					},
 					{
 						AssetID:  "Asset 2",
 						Location: oneOrigin,
-						Capacity: 4,
+						Capacity: model.NewCapacity(4),
 					},
 					{
 						AssetID:  "Asset 3",
 						Location: oneOrigin,
-						Capacity: 4,
+						Capacity: model.NewCapacity(4),
 					},
 					{
 						AssetID:  "Asset 4",
 						Location: oneOrigin,
-						Capacity: 4,
+						Capacity: model.NewCapacity(4),
 					},
 					{
 						AssetID:  "Asset 5",
 						Location: oneOrigin,
-						Capacity: 4,
+						Capacity: model.NewCapacity(4),
 					},
 					{
 						AssetID:  "Asset 6",
 						Location: oneOrigin,
-						Capacity: 4,
+						Capacity: model.NewCapacity(4),
 					},
 					{
 						AssetID:  "Asset 7",
 						Location: oneOrigin,
-						Capacity: 4,
+						Capacity: model.NewCapacity(4),
 					},
 					{
 						AssetID:  "Asset 8",
 						Location: oneOrigin,
-						Capacity: 4,
+						Capacity: model.NewCapacity(4),
 					},
 				},
 				Requests: manyRequests(t, oneOrigin),
@@ -587,8 +1006,8 @@ func TestSequentialConstruction_Solve(t *testing.T) {
 				},
 				[]point.Point{
 					point.NewPoint(4.682950, -74.049650),
-					point.NewPoint(4.753690, -74.100280),
 					point.NewPoint(4.747060, -74.112300),
+					point.NewPoint(4.753690, -74.100280),
 					point.NewPoint(4.758210, -74.100110),
 					point.NewPoint(4.758280, -74.104930),
 				},
@@ -602,7 +1021,7 @@ func TestSequentialConstruction_Solve(t *testing.T) {
 					point.NewPoint(4.721290, -74.055900),
 				},
 			},
-			[]model.Request{},
+			[]model.UnassignedRequest{},
 			false,
 			false,
 		},
@@ -631,6 +1050,546 @@ func TestSequentialConstruction_Solve(t *testing.T) {
 	}
 }
 
+func TestSequentialConstruction_Solve_ServiceDurations(t *testing.T) {
+	e := distanceestimator.NewHaversineDistanceEstimator(80)
+	algo := NewSequentialConstruction(logger.NewNopLogger(), routeestimator.NewEstimator(e), e)
+
+	minoToSada := 4*time.Minute + 16589576885
+	p := model.Problem{
+		Fleet: []model.Asset{
+			{
+				AssetID:       "Miño Asset",
+				Location:      minoLoc,
+				Capacity:      model.NewCapacity(4),
+				SetupDuration: 5 * time.Minute,
+			},
+		},
+		Requests: []model.Request{
+			{
+				RequestID:       "Miño - Sada",
+				PickUp:          minoLoc,
+				DropOff:         sadaLoc,
+				Load:            model.NewLoad(2),
+				PickUpDuration:  model.ServiceDuration{Base: time.Minute, PerLoadUnit: 30 * time.Second},
+				DropOffDuration: model.ServiceDuration{Base: time.Minute},
+			},
+		},
+		Constraints: model.Constraints{
+			MaxJourneyTimeFactor: 1.5,
+		},
+		Departure: departure,
+	}
+
+	got, err := algo.Solve(context.Background(), p)
+	assert.NoError(t, err)
+	assert.Len(t, got.Routes, 1)
+	route := got.Routes[0]
+	assert.Equal(t, 5*time.Minute+2*time.Minute+minoToSada+time.Minute, route.Metrics.Duration)
+	assert.Equal(t, departure, route.Metrics.Start)
+	assert.Equal(t, departure.Add(route.Metrics.Duration), route.Metrics.End)
+	assert.Equal(t, route.Metrics.Duration, got.Metrics.Duration)
+
+	pickUp := route.Waypoints[0]
+	assert.Equal(t, departure, pickUp.Arrival)
+	assert.Equal(t, departure.Add(5*time.Minute+2*time.Minute), pickUp.Departure)
+	dropOff := route.Waypoints[1]
+	assert.Equal(t, pickUp.Departure.Add(minoToSada), dropOff.Arrival)
+	assert.Equal(t, dropOff.Arrival.Add(time.Minute), dropOff.Departure)
+}
+
+func TestSequentialConstruction_Solve_ShiftStart(t *testing.T) {
+	e := distanceestimator.NewHaversineDistanceEstimator(80)
+	algo := NewSequentialConstruction(logger.NewNopLogger(), routeestimator.NewEstimator(e), e)
+
+	shiftStart := departure.Add(time.Hour)
+	p := model.Problem{
+		Fleet: []model.Asset{
+			{
+				AssetID:  "Miño Asset",
+				Location: minoLoc,
+				Capacity: model.NewCapacity(4),
+				Shift:    model.TimeWindow{Earliest: shiftStart},
+			},
+		},
+		Requests: []model.Request{
+			{
+				RequestID: "Miño - Sada",
+				PickUp:    minoLoc,
+				DropOff:   sadaLoc,
+				Load:      model.NewLoad(1),
+			},
+		},
+		Constraints: model.Constraints{
+			MaxJourneyTimeFactor: 1.5,
+		},
+		Departure: departure,
+	}
+
+	got, err := algo.Solve(context.Background(), p)
+	assert.NoError(t, err)
+	assert.Empty(t, got.Unassigned)
+	assert.Len(t, got.Routes, 1)
+	route := got.Routes[0]
+	assert.Equal(t, shiftStart, route.Metrics.Start)
+	assert.Equal(t, shiftStart, route.Waypoints[0].Arrival)
+	assert.Equal(t, shiftStart, route.Waypoints[0].Departure)
+}
+
+func TestSequentialConstruction_Solve_Cancelled(t *testing.T) {
+	e := distanceestimator.NewHaversineDistanceEstimator(80)
+	algo := NewSequentialConstruction(logger.NewNopLogger(), routeestimator.NewEstimator(e), e)
+
+	p := model.Problem{
+		Fleet: []model.Asset{
+			{AssetID: "Miño Asset", Location: minoLoc, Capacity: model.NewCapacity(1)},
+		},
+		Requests: []model.Request{
+			{RequestID: "Miño - Sada", PickUp: minoLoc, DropOff: sadaLoc, Load: model.NewLoad(1)},
+		},
+		Constraints: model.Constraints{
+			MaxJourneyTimeFactor: 1.5,
+		},
+		Departure: departure,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	got, err := algo.Solve(ctx, p)
+	assert.NoError(t, err)
+	assert.True(t, got.Metrics.Partial)
+	assert.Empty(t, got.Routes)
+	assert.Len(t, got.Unassigned, 1)
+	assert.Equal(t, []model.UnassignedReason{model.UnassignedReasonStopped}, got.Unassigned[0].Reasons)
+
+	t.Run("Must serve request", func(t *testing.T) {
+		// The request is not tried, so the stopped solving does not make the problem infeasible
+		p.Requests[0].MustServe = true
+		got, err := algo.Solve(ctx, p)
+		assert.NoError(t, err)
+		assert.True(t, got.Metrics.Partial)
+		assert.Len(t, got.Unassigned, 1)
+		assert.True(t, got.Unassigned[0].MustServe)
+		assert.Equal(t, []model.UnassignedReason{model.UnassignedReasonStopped}, got.Unassigned[0].Reasons)
+	})
+}
+
+func TestSequentialConstruction_Solve_AssetCosts(t *testing.T) {
+	e := distanceestimator.NewHaversineDistanceEstimator(80)
+	algo := NewSequentialConstruction(logger.NewNopLogger(), routeestimator.NewEstimator(e), e)
+
+	minibus := model.Asset{
+		AssetID:      "Minibus",
+		Location:     minoLoc,
+		Capacity:     model.NewCapacity(4),
+		DistanceCost: 2,
+	}
+	taxi := model.Asset{
+		AssetID:      "Taxi",
+		Location:     minoLoc,
+		Capacity:     model.NewCapacity(2),
+		FixedCost:    3,
+		DistanceCost: 0.5,
+		DurationCost: 12,
+	}
+	p := model.Problem{
+		Fleet: []model.Asset{minibus, taxi},
+		Requests: []model.Request{
+			{
+				RequestID: "Miño - Sada",
+				PickUp:    minoLoc,
+				DropOff:   sadaLoc,
+				Load:      model.NewLoad(1),
+			},
+		},
+		Constraints: model.Constraints{
+			MaxJourneyTimeFactor: 1.5,
+		},
+		Departure: departure,
+	}
+
+	// The taxi is cheaper per seat
+	got, err := algo.Solve(context.Background(), p)
+	assert.NoError(t, err)
+	assert.Len(t, got.Routes, 1)
+	route := got.Routes[0]
+	assert.Equal(t, taxi.AssetID, route.Asset.AssetID)
+	want := 3 + 0.5*route.Metrics.Distance/1000 + 12*route.Metrics.Duration.Hours()
+	assert.InDelta(t, want, route.Metrics.Cost, 1e-9)
+	assert.InDelta(t, want, got.Metrics.Cost, 1e-9)
+
+	// Without costs the biggest asset is opened first
+	p.Fleet = []model.Asset{
+		{AssetID: minibus.AssetID, Location: minoLoc, Capacity: minibus.Capacity},
+		{AssetID: taxi.AssetID, Location: minoLoc, Capacity: taxi.Capacity},
+	}
+	got, err = algo.Solve(context.Background(), p)
+	assert.NoError(t, err)
+	assert.Equal(t, minibus.AssetID, got.Routes[0].Asset.AssetID)
+	assert.Zero(t, got.Metrics.Cost)
+}
+
+func TestSequentialConstruction_Solve_Breaks(t *testing.T) {
+	e := distanceestimator.NewHaversineDistanceEstimator(80)
+	algo := NewSequentialConstruction(logger.NewNopLogger(), routeestimator.NewEstimator(e), e)
+
+	minoToAspontes := 23*time.Minute + 3433251498
+	aspontesToSada := 27*time.Minute + 4557459203
+	newProblem := func(rule model.BreakRule) model.Problem {
+		return model.Problem{
+			Fleet: []model.Asset{
+				{
+					AssetID:  "Miño Asset",
+					Location: minoLoc,
+					Capacity: model.NewCapacity(4),
+					Breaks:   []model.BreakRule{rule},
+				},
+			},
+			Requests: []model.Request{
+				{
+					RequestID: "As Pontes - Sada",
+					PickUp:    aspontesLoc,
+					DropOff:   sadaLoc,
+					Load:      model.NewLoad(1),
+				},
+			},
+			Constraints: model.Constraints{
+				MaxJourneyTimeFactor: 3,
+			},
+			Departure: departure,
+		}
+	}
+
+	t.Run("Break after driving", func(t *testing.T) {
+		got, err := algo.Solve(context.Background(), newProblem(model.BreakRule{
+			ID:           "Rest",
+			Duration:     30 * time.Minute,
+			AfterDriving: 30 * time.Minute,
+		}))
+		assert.NoError(t, err)
+		assert.Empty(t, got.Unassigned)
+		assert.Equal(t, []Route{{minoLoc, aspontesLoc, aspontesLoc, sadaLoc}}, getTestRoutes(t, got.Routes))
+
+		rest := got.Routes[0].Waypoints[2]
+		assert.Equal(t, []model.Activity{model.NewActivity(model.ActivityTypeBreak, "Rest")}, rest.Activities)
+		assert.Equal(t, departure.Add(minoToAspontes), rest.Arrival)
+		assert.Equal(t, rest.Arrival.Add(30*time.Minute), rest.Departure)
+		assert.Equal(t, rest.Departure.Add(aspontesToSada), got.Routes[0].Waypoints[3].Arrival)
+		assert.Equal(t, minoToAspontes+30*time.Minute+aspontesToSada, got.Routes[0].Metrics.Duration)
+	})
+
+	t.Run("Break not possible", func(t *testing.T) {
+		got, err := algo.Solve(context.Background(), newProblem(model.BreakRule{
+			ID:           "Rest",
+			Duration:     30 * time.Minute,
+			AfterDriving: 20 * time.Minute,
+		}))
+		assert.NoError(t, err)
+		assert.Len(t, got.Unassigned, 1)
+		assert.Equal(t, []model.UnassignedReason{model.UnassignedReasonBreak}, got.Unassigned[0].Reasons)
+	})
+}
+
+func TestSequentialConstruction_Solve_IncompatibleAndGroupedRequests(t *testing.T) {
+	e := distanceestimator.NewHaversineDistanceEstimator(80)
+	algo := NewSequentialConstruction(logger.NewNopLogger(), routeestimator.NewEstimator(e), e)
+
+	newRequest := func(id model.Ref, load int) model.Request {
+		return model.Request{RequestID: id, PickUp: aspontesLoc, DropOff: sadaLoc, Load: model.NewLoad(load)}
+	}
+	p := model.Problem{
+		Fleet: []model.Asset{
+			{
+				AssetID:  "Miño Asset",
+				Location: minoLoc,
+				Capacity: model.NewCapacity(4),
+			},
+			{
+				AssetID:  "As Pontes Asset",
+				Location: aspontesLoc,
+				Capacity: model.NewCapacity(4),
+			},
+		},
+		Requests: []model.Request{
+			newRequest("A", 1),
+			newRequest("B", 1),
+			newRequest("Family 1", 1),
+			newRequest("Family 2", 1),
+			newRequest("Group 1", 2),
+			newRequest("Group 2", 2),
+			newRequest("Group 3", 2),
+		},
+		Constraints: model.Constraints{
+			MaxJourneyTimeFactor: 1.5,
+			IncompatibleRequests: []model.RequestPair{{"A", "B"}},
+			SameVehicleGroups: []model.RequestGroup{
+				{"Family 1", "Family 2"},
+				{"Group 1", "Group 2", "Group 3"},
+			},
+		},
+		Departure: departure,
+	}
+
+	got, err := algo.Solve(context.Background(), p)
+	assert.NoError(t, err)
+
+	var routes [][]model.Ref
+	for _, r := range got.Routes {
+		var refs []model.Ref
+		for _, req := range r.Requests {
+			refs = append(refs, req.RequestID)
+		}
+		routes = append(routes, refs)
+	}
+	assert.Equal(t, [][]model.Ref{{"A", "Family 1", "Family 2"}, {"B"}}, routes)
+
+	var unassigned []model.Ref
+	for _, u := range got.Unassigned {
+		unassigned = append(unassigned, u.RequestID)
+		assert.Equal(t, []model.UnassignedReason{model.UnassignedReasonTimeWindow, model.UnassignedReasonCapacity}, u.Reasons)
+	}
+	assert.Equal(t, []model.Ref{"Group 1", "Group 2", "Group 3"}, unassigned)
+}
+
+func TestSequentialConstruction_Solve_Priorities(t *testing.T) {
+	e := distanceestimator.NewHaversineDistanceEstimator(80)
+	algo := NewSequentialConstruction(logger.NewNopLogger(), routeestimator.NewEstimator(e), e)
+
+	newProblem := func(leisure, dialysis model.Request) model.Problem {
+		return model.Problem{
+			Fleet: []model.Asset{
+				{
+					AssetID:  "Miño Asset",
+					Location: minoLoc,
+					Capacity: model.NewCapacity(1),
+				},
+			},
+			Requests: []model.Request{leisure, dialysis},
+			Constraints: model.Constraints{
+				MaxJourneyTimeFactor: 1.2,
+			},
+			Departure: departure,
+		}
+	}
+	leisure := model.Request{
+		RequestID:         "Leisure",
+		PickUp:            aspontesLoc,
+		DropOff:           sadaLoc,
+		Load:              model.NewLoad(1),
+		UnassignedPenalty: 5,
+	}
+	dialysis := model.Request{
+		RequestID:         "Dialysis",
+		PickUp:            minoLoc,
+		DropOff:           sadaLoc,
+		Load:              model.NewLoad(1),
+		Priority:          1,
+		UnassignedPenalty: 10,
+	}
+
+	t.Run("Higher priority first", func(t *testing.T) {
+		got, err := algo.Solve(context.Background(), newProblem(leisure, dialysis))
+		assert.NoError(t, err)
+		assert.Equal(t, []Route{{minoLoc, sadaLoc}}, getTestRoutes(t, got.Routes))
+		assert.Len(t, got.Unassigned, 1)
+		assert.Equal(t, model.Ref("Leisure"), got.Unassigned[0].RequestID)
+		assert.Equal(t, 5.0, got.Metrics.UnassignedPenalty)
+	})
+
+	t.Run("Must serve first", func(t *testing.T) {
+		mustServe := leisure
+		mustServe.MustServe = true
+		got, err := algo.Solve(context.Background(), newProblem(mustServe, dialysis))
+		assert.NoError(t, err)
+		assert.Equal(t, []Route{{minoLoc, aspontesLoc, sadaLoc}}, getTestRoutes(t, got.Routes))
+		assert.Equal(t, 10.0, got.Metrics.UnassignedPenalty)
+	})
+
+	t.Run("Must serve unassigned", func(t *testing.T) {
+		mustServe := dialysis
+		mustServe.MustServe = true
+		alsoMustServe := leisure
+		alsoMustServe.MustServe = true
+		got, err := algo.Solve(context.Background(), newProblem(alsoMustServe, mustServe))
+		assert.True(t, errors.Is(err, ErrMustServeUnassigned))
+		assert.Nil(t, got)
+	})
+}
+
+func TestSequentialConstruction_Solve_PinnedAndLockedRequests(t *testing.T) {
+	e := distanceestimator.NewHaversineDistanceEstimator(80)
+	algo := NewSequentialConstruction(logger.NewNopLogger(), routeestimator.NewEstimator(e), e)
+
+	p := model.Problem{
+		Fleet: []model.Asset{
+			{
+				AssetID:  "Miño Asset",
+				Location: minoLoc,
+				Capacity: model.NewCapacity(2),
+				LockedStops: []model.LockedStop{
+					{RequestID: "As Pontes - Sada", Activity: model.ActivityTypePickUp},
+					{RequestID: "Miño - Sada", Activity: model.ActivityTypePickUp},
+					{RequestID: "Miño - Sada", Activity: model.ActivityTypeDropOff},
+				},
+			},
+			{
+				AssetID:  "Sada Asset",
+				Location: sadaLoc,
+				Capacity: model.NewCapacity(1),
+			},
+		},
+		Requests: []model.Request{
+			{
+				RequestID: "Miño - Sada",
+				PickUp:    minoLoc,
+				DropOff:   sadaLoc,
+				Load:      model.NewLoad(1),
+			},
+			{
+				RequestID: "As Pontes - Sada",
+				PickUp:    aspontesLoc,
+				DropOff:   sadaLoc,
+				Load:      model.NewLoad(1),
+			},
+			{
+				RequestID: "As Pontes - Miño",
+				PickUp:    aspontesLoc,
+				DropOff:   minoLoc,
+				Load:      model.NewLoad(1),
+				AssetID:   "Sada Asset",
+			},
+		},
+		Constraints: model.Constraints{
+			MaxJourneyTimeFactor: 10,
+		},
+		Departure: departure,
+	}
+
+	got, err := algo.Solve(context.Background(), p)
+	assert.NoError(t, err)
+	assert.Equal(t, []Route{
+		{minoLoc, aspontesLoc, minoLoc, sadaLoc},
+		{sadaLoc, aspontesLoc, minoLoc},
+	}, getTestRoutes(t, got.Routes))
+	assert.Equal(t, "Miño Asset", string(got.Routes[0].Asset.AssetID))
+	assert.Len(t, got.Routes[0].Requests, 2)
+	assert.Empty(t, got.Unassigned)
+}
+
+func TestSequentialConstruction_Solve_OnboardRequests(t *testing.T) {
+	e := distanceestimator.NewHaversineDistanceEstimator(80)
+	algo := NewSequentialConstruction(logger.NewNopLogger(), routeestimator.NewEstimator(e), e)
+
+	newProblem := func(capacity int) model.Problem {
+		return model.Problem{
+			Fleet: []model.Asset{
+				{
+					AssetID:         "Miño Asset",
+					Location:        minoLoc,
+					Capacity:        model.NewCapacity(capacity),
+					InitialLoad:     model.NewLoad(1),
+					OnboardRequests: []model.Ref{"As Pontes - Sada"},
+				},
+			},
+			Requests: []model.Request{
+				{
+					RequestID: "As Pontes - Sada",
+					PickUp:    aspontesLoc,
+					DropOff:   sadaLoc,
+					Load:      model.NewLoad(1),
+				},
+				{
+					RequestID: "Miño - Sada",
+					PickUp:    minoLoc,
+					DropOff:   sadaLoc,
+					Load:      model.NewLoad(1),
+				},
+			},
+			Constraints: model.Constraints{
+				MaxJourneyTimeFactor: 1.5,
+			},
+			Departure: departure,
+		}
+	}
+
+	t.Run("Full from the start", func(t *testing.T) {
+		got, err := algo.Solve(context.Background(), newProblem(2))
+		assert.NoError(t, err)
+		assert.Equal(t, []Route{{minoLoc, sadaLoc}}, getTestRoutes(t, got.Routes))
+		assert.Equal(t, model.NewLoad(2), got.Routes[0].Waypoints[0].Load)
+		assert.Equal(t, model.NewLoad(1), got.Routes[0].Waypoints[1].Load)
+		assert.Equal(t, []model.UnassignedRequest{
+			{Request: newProblem(2).Requests[1], Reasons: []model.UnassignedReason{model.UnassignedReasonCapacity}},
+		}, got.Unassigned)
+	})
+
+	t.Run("Room for one more", func(t *testing.T) {
+		got, err := algo.Solve(context.Background(), newProblem(3))
+		assert.NoError(t, err)
+		assert.Equal(t, []Route{{minoLoc, sadaLoc}}, getTestRoutes(t, got.Routes))
+		assert.Equal(t, model.NewLoad(3), got.Routes[0].Waypoints[0].Load)
+		assert.Len(t, got.Routes[0].Requests, 2)
+		assert.Empty(t, got.Unassigned)
+	})
+}
+
+func TestSequentialConstruction_Solve_GroupWithOnboardRequest(t *testing.T) {
+	e := distanceestimator.NewHaversineDistanceEstimator(80)
+	algo := NewSequentialConstruction(logger.NewNopLogger(), routeestimator.NewEstimator(e), e)
+
+	newProblem := func(capacity int) model.Problem {
+		return model.Problem{
+			Fleet: []model.Asset{
+				{
+					AssetID:         "small",
+					Location:        aspontesLoc,
+					Capacity:        model.NewCapacity(capacity),
+					OnboardRequests: []model.Ref{"a"},
+				},
+				{
+					AssetID:  "big",
+					Location: aspontesLoc,
+					Capacity: model.NewCapacity(4),
+				},
+			},
+			Requests: []model.Request{
+				{RequestID: "a", PickUp: aspontesLoc, DropOff: sadaLoc, Load: model.NewLoad(1)},
+				{RequestID: "b", PickUp: aspontesLoc, DropOff: sadaLoc, Load: model.NewLoad(1)},
+			},
+			Constraints: model.Constraints{
+				MaxJourneyTimeFactor: 1.5,
+				SameVehicleGroups:    []model.RequestGroup{{"a", "b"}},
+			},
+			Departure: departure,
+		}
+	}
+
+	t.Run("With the onboard request", func(t *testing.T) {
+		got, err := algo.Solve(context.Background(), newProblem(2))
+		assert.NoError(t, err)
+		for _, r := range got.Routes {
+			if r.Asset.AssetID == "small" {
+				assert.Len(t, r.Requests, 2)
+			} else {
+				assert.Empty(t, r.Requests)
+			}
+		}
+		assert.Empty(t, got.Unassigned)
+	})
+
+	t.Run("Unassigned when it does not fit", func(t *testing.T) {
+		got, err := algo.Solve(context.Background(), newProblem(1))
+		assert.NoError(t, err)
+		for _, r := range got.Routes {
+			for _, req := range r.Requests {
+				assert.NotEqual(t, model.Ref("b"), req.RequestID, "b is served by %s", r.Asset.AssetID)
+			}
+		}
+		assert.Len(t, got.Unassigned, 1)
+		assert.Equal(t, model.Ref("b"), got.Unassigned[0].RequestID)
+		assert.Contains(t, got.Unassigned[0].Reasons, model.UnassignedReasonGroup)
+	})
+}
+
 func getTestRoutes(t *testing.T, routes []model.SolutionRoute) []Route {
 	t.Helper()
 	var testRoutes []Route
@@ -679,7 +1638,7 @@ func manyRequests(t *testing.T, oneOrigin point.Point) []model.Request {
 			RequestID: model.Ref(fmt.Sprintf("Rider %d", i)),
 			PickUp:    oneOrigin,
 			DropOff:   p,
-			Load:      1,
+			Load:      model.NewLoad(1),
 		})
 	}
 	return many
@@ -697,69 +1656,89 @@ func Test_buildRouteWaypoints(t *testing.T) {
 			model.Asset{
 				AssetID:  "Pontedeume Asset",
 				Location: pontedeumeLoc,
-				Capacity: 4,
+				Capacity: model.NewCapacity(4),
 			},
 			model.Route{
 				&model.Stop{
 					Ref:      "Pontedeume Asset",
 					Point:    pontedeumeLoc,
-					Load:     0,
+					Load:     model.NewLoad(0),
 					Activity: model.ActivityTypeStart,
 				},
 				&model.Stop{
-					Ref:      "As Pontes - Sada",
-					Point:    aspontesLoc,
-					Load:     1,
-					Activity: model.ActivityTypePickUp,
+					Ref:         "As Pontes - Sada",
+					Point:       aspontesLoc,
+					Load:        model.NewLoad(1),
+					Activity:    model.ActivityTypePickUp,
+					ArrivalTime: 20 * time.Minute,
+					ServiceTime: 20 * time.Minute,
 				},
 				&model.Stop{
-					Ref:      "As Pontes - Miño",
-					Point:    aspontesLoc,
-					Load:     1,
-					Activity: model.ActivityTypePickUp,
+					Ref:         "As Pontes - Miño",
+					Point:       aspontesLoc,
+					Load:        model.NewLoad(1),
+					Activity:    model.ActivityTypePickUp,
+					ArrivalTime: 20 * time.Minute,
+					ServiceTime: 20 * time.Minute,
 				},
 				&model.Stop{
-					Ref:      "As Pontes - Miño",
-					Point:    minoLoc,
-					Load:     -1,
-					Activity: model.ActivityTypeDropOff,
+					Ref:         "As Pontes - Miño",
+					Point:       minoLoc,
+					Load:        model.NewLoad(-1),
+					Activity:    model.ActivityTypeDropOff,
+					ArrivalTime: 43 * time.Minute,
+					ServiceTime: 45 * time.Minute,
 				},
 				&model.Stop{
-					Ref:      "As Pontes - Sada",
-					Point:    sadaLoc,
-					Load:     -1,
-					Activity: model.ActivityTypeDropOff,
+					Ref:         "As Pontes - Sada",
+					Point:       sadaLoc,
+					Load:        model.NewLoad(-1),
+					Activity:    model.ActivityTypeDropOff,
+					ArrivalTime: 50 * time.Minute,
+					ServiceTime: 50 * time.Minute,
 				},
 			},
 			[]model.Waypoint{
 				{
 					Location: pontedeumeLoc,
-					Load:     0,
+					Load:     model.NewLoad(0),
 					Activities: []model.Activity{
 						model.NewActivity(model.ActivityTypeStart, "Pontedeume Asset"),
 					},
+					Arrival:      departure,
+					ServiceStart: departure,
+					Departure:    departure,
 				},
 				{
 					Location: aspontesLoc,
-					Load:     2,
+					Load:     model.NewLoad(2),
 					Activities: []model.Activity{
 						model.NewActivity(model.ActivityTypePickUp, "As Pontes - Sada"),
 						model.NewActivity(model.ActivityTypePickUp, "As Pontes - Miño"),
 					},
+					Arrival:      departure.Add(20 * time.Minute),
+					ServiceStart: departure.Add(20 * time.Minute),
+					Departure:    departure.Add(20 * time.Minute),
 				},
 				{
 					Location: minoLoc,
-					Load:     1,
+					Load:     model.NewLoad(1),
 					Activities: []model.Activity{
 						model.NewActivity(model.ActivityTypeDropOff, "As Pontes - Miño"),
 					},
+					Arrival:      departure.Add(43 * time.Minute),
+					ServiceStart: departure.Add(45 * time.Minute),
+					Departure:    departure.Add(45 * time.Minute),
 				},
 				{
 					Location: sadaLoc,
-					Load:     0,
+					Load:     model.NewLoad(0),
 					Activities: []model.Activity{
 						model.NewActivity(model.ActivityTypeDropOff, "As Pontes - Sada"),
 					},
+					Arrival:      departure.Add(50 * time.Minute),
+					ServiceStart: departure.Add(50 * time.Minute),
+					Departure:    departure.Add(50 * time.Minute),
 				},
 			},
 		},
@@ -768,77 +1747,152 @@ func Test_buildRouteWaypoints(t *testing.T) {
 			model.Asset{
 				AssetID:  "Pontedeume Asset",
 				Location: pontedeumeLoc,
-				Capacity: 4,
+				Capacity: model.NewCapacity(4),
 			},
 			model.Route{
 				&model.Stop{
 					Ref:      "Pontedeume Asset",
 					Point:    pontedeumeLoc,
-					Load:     0,
+					Load:     model.NewLoad(0),
 					Activity: model.ActivityTypeStart,
 				},
 				&model.Stop{
 					Ref:      "As Pontes - Pontedeume",
 					Point:    aspontesLoc,
-					Load:     1,
+					Load:     model.NewLoad(1),
 					Activity: model.ActivityTypePickUp,
 				},
 				&model.Stop{
 					Ref:      "As Pontes - Miño",
 					Point:    aspontesLoc,
-					Load:     1,
+					Load:     model.NewLoad(1),
 					Activity: model.ActivityTypePickUp,
 				},
 				&model.Stop{
 					Ref:      "As Pontes - Pontedeume",
 					Point:    pontedeumeLoc,
-					Load:     -1,
+					Load:     model.NewLoad(-1),
 					Activity: model.ActivityTypeDropOff,
 				},
 				&model.Stop{
 					Ref:      "As Pontes - Miño",
 					Point:    minoLoc,
-					Load:     -1,
+					Load:     model.NewLoad(-1),
 					Activity: model.ActivityTypeDropOff,
 				},
 			},
 			[]model.Waypoint{
 				{
 					Location: pontedeumeLoc,
-					Load:     0,
+					Load:     model.NewLoad(0),
 					Activities: []model.Activity{
 						model.NewActivity(model.ActivityTypeStart, "Pontedeume Asset"),
 					},
+					Arrival:      departure,
+					ServiceStart: departure,
+					Departure:    departure,
 				},
 				{
 					Location: aspontesLoc,
-					Load:     2,
+					Load:     model.NewLoad(2),
 					Activities: []model.Activity{
 						model.NewActivity(model.ActivityTypePickUp, "As Pontes - Pontedeume"),
 						model.NewActivity(model.ActivityTypePickUp, "As Pontes - Miño"),
 					},
+					Arrival:      departure,
+					ServiceStart: departure,
+					Departure:    departure,
 				},
 				{
 					Location: pontedeumeLoc,
-					Load:     1,
+					Load:     model.NewLoad(1),
 					Activities: []model.Activity{
 						model.NewActivity(model.ActivityTypeDropOff, "As Pontes - Pontedeume"),
 					},
+					Arrival:      departure,
+					ServiceStart: departure,
+					Departure:    departure,
 				},
 				{
 					Location: minoLoc,
-					Load:     0,
+					Load:     model.NewLoad(0),
 					Activities: []model.Activity{
 						model.NewActivity(model.ActivityTypeDropOff, "As Pontes - Miño"),
 					},
+					Arrival:      departure,
+					ServiceStart: departure,
+					Departure:    departure,
 				},
 			},
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := buildRouteWaypoints(tt.route, tt.asset)
+			got := buildRouteWaypoints(tt.route, tt.asset, departure)
 			assert.Equal(t, tt.waypoints, got)
 		})
 	}
 }
+
+func BenchmarkSequentialConstruction_Solve(b *testing.B) {
+	e := distanceestimator.NewHaversineDistanceEstimator(80)
+	algo := NewSequentialConstruction(logger.NewNopLogger(), routeestimator.NewEstimator(e), e)
+	p := benchmarkProblem(500, 10)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := algo.Solve(context.Background(), withOwnRequests(p)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkSequentialConstruction_Insert(b *testing.B) {
+	e := distanceestimator.NewHaversineDistanceEstimator(80)
+	algo := NewSequentialConstruction(logger.NewNopLogger(), routeestimator.NewEstimator(e), e)
+	p := benchmarkProblem(500, 10)
+	var refs []model.Ref
+	for _, req := range p.Requests {
+		refs = append(refs, req.RequestID)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := algo.Insert(context.Background(), withOwnRequests(p), model.Solution{}, refs); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// The requests go between random places around A Coruña, to be picked up within half an hour along the day
+func benchmarkProblem(requests, assets int) model.Problem {
+	rnd := rand.New(rand.NewSource(1))
+	around := func() point.Point {
+		return point.NewPoint(43.2+0.3*rnd.Float64(), -8.3+0.7*rnd.Float64())
+	}
+
+	p := model.Problem{
+		Constraints: model.Constraints{
+			MaxJourneyTimeFactor: 2,
+		},
+		Departure: departure,
+	}
+	for i := 0; i < assets; i++ {
+		p.Fleet = append(p.Fleet, model.Asset{
+			AssetID:  model.AssetID(fmt.Sprintf("Asset %d", i)),
+			Location: around(),
+			Capacity: model.NewCapacity(8),
+		})
+	}
+	for i := 0; i < requests; i++ {
+		earliest := departure.Add(time.Duration(rnd.Intn(12*60)) * time.Minute)
+		p.Requests = append(p.Requests, model.Request{
+			RequestID:        model.Ref(fmt.Sprintf("Rider %d", i)),
+			PickUp:           around(),
+			DropOff:          around(),
+			Load:             model.NewLoad(1),
+			PickUpTimeWindow: model.TimeWindow{Earliest: earliest, Latest: earliest.Add(30 * time.Minute)},
+		})
+	}
+	return p
+}
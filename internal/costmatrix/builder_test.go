@@ -6,6 +6,7 @@ import (
 
 	"github.com/edusalguero/roteiro.git/internal/distanceestimator"
 	"github.com/edusalguero/roteiro.git/internal/logger"
+	"github.com/edusalguero/roteiro.git/internal/model"
 	"github.com/edusalguero/roteiro.git/internal/point"
 	"github.com/edusalguero/roteiro.git/internal/problem"
 	"github.com/stretchr/testify/assert"
@@ -35,7 +36,7 @@ func TestNewDistanceMatrixBuilder(t *testing.T) {
 
 					AssetID:  "Asset 1",
 					Location: point.NewPoint(43.3475, -8.206389),
-					Capacity: 2,
+					Capacity: problem.Capacity{model.DefaultDimension: 2},
 				},
 			},
 			nil,
@@ -49,7 +50,7 @@ func TestNewDistanceMatrixBuilder(t *testing.T) {
 
 					AssetID:  "Asset 1",
 					Location: point.NewPoint(43.3475, -8.206389),
-					Capacity: 2,
+					Capacity: problem.Capacity{model.DefaultDimension: 2},
 				},
 			},
 			[]problem.Request{
@@ -3,6 +3,7 @@ package costmatrix
 import (
 	"context"
 	"fmt"
+	"sort"
 	"sync"
 
 	"github.com/edusalguero/roteiro.git/internal/cost"
@@ -44,6 +45,15 @@ func (d *DistanceMatrix) buildMatrix(ctx context.Context) error {
 		points = append(points, r.DropOff)
 		points = append(points, r.PickUp)
 	}
+	for _, a := range d.assets {
+		if a.EndLocation != nil {
+			points = append(points, *a.EndLocation)
+		}
+		if len(a.Breaks) > 0 {
+			// The break can be taken at the asset location before leaving
+			points = append(points, a.Location)
+		}
+	}
 	points = point.UniquePoints(points)
 
 	limiter := make(chan int, 10000) // This is just a buffer to limit the number of concurrent goroutines
@@ -62,6 +72,10 @@ func (d *DistanceMatrix) buildMatrix(ctx context.Context) error {
 
 	wg.Wait()
 	if len(d.errors) > 0 {
+		// The costs arrive in any order, the errors are reported always in the same one
+		sort.Slice(d.errors, func(i, j int) bool {
+			return d.errors[i].Error() < d.errors[j].Error()
+		})
 		d.logger.Errorf("Error building Cost MatrixL: %s", d.errors)
 		return ErrBuildingMatrix
 	}
@@ -74,9 +88,7 @@ func (d *DistanceMatrix) getCostFrom2Points(ctx context.Context, costResults cha
 		wg.Add(1)
 		go func(p point.Point) {
 			c, err := d.distanceEstimator.GetCost(ctx, from, p)
-			costMap := costMap{}
-			costMap[costPath{from, p}] = c
-			costResults <- costResponse{costMap: costMap, err: err}
+			costResults <- costResponse{path: costPath{from, p}, cost: c, err: err}
 			<-sem
 		}(p)
 	}
@@ -88,9 +100,7 @@ func (d *DistanceMatrix) handleCostResults(costs chan costResponse, lock sync.Lo
 		if result.err != nil {
 			d.errors = append(d.errors, result.err)
 		}
-		for path, c := range result.costMap {
-			d.matrix[path] = c
-		}
+		d.matrix[result.path] = result.cost
 		lock.Unlock()
 		wg.Done()
 	}
@@ -100,6 +110,7 @@ type costPath [2]point.Point
 type costMap map[costPath]*cost.Cost
 
 type costResponse struct {
-	costMap costMap
-	err     error
+	path costPath
+	cost *cost.Cost
+	err  error
 }
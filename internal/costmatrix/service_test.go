@@ -8,6 +8,7 @@ import (
 	"github.com/edusalguero/roteiro.git/internal/cost"
 	"github.com/edusalguero/roteiro.git/internal/distanceestimator"
 	"github.com/edusalguero/roteiro.git/internal/logger"
+	"github.com/edusalguero/roteiro.git/internal/model"
 	"github.com/edusalguero/roteiro.git/internal/point"
 	"github.com/edusalguero/roteiro.git/internal/problem"
 	"github.com/stretchr/testify/assert"
@@ -37,7 +38,7 @@ func TestDistanceMatrix_GetDistance(t *testing.T) {
 
 					AssetID:  "Asset 1",
 					Location: point.NewPoint(43.3475, -8.206389),
-					Capacity: 2,
+					Capacity: problem.Capacity{model.DefaultDimension: 2},
 				},
 			},
 			requests: []problem.Request{
@@ -66,42 +67,42 @@ func TestDistanceMatrix_GetDistance(t *testing.T) {
 				{
 					AssetID:  "Asset 1",
 					Location: oneOrigin,
-					Capacity: 4,
+					Capacity: problem.Capacity{model.DefaultDimension: 4},
 				},
 				{
 					AssetID:  "Asset 2",
 					Location: oneOrigin,
-					Capacity: 4,
+					Capacity: problem.Capacity{model.DefaultDimension: 4},
 				},
 				{
 					AssetID:  "Asset 3",
 					Location: oneOrigin,
-					Capacity: 4,
+					Capacity: problem.Capacity{model.DefaultDimension: 4},
 				},
 				{
 					AssetID:  "Asset 4",
 					Location: oneOrigin,
-					Capacity: 4,
+					Capacity: problem.Capacity{model.DefaultDimension: 4},
 				},
 				{
 					AssetID:  "Asset 5",
 					Location: oneOrigin,
-					Capacity: 4,
+					Capacity: problem.Capacity{model.DefaultDimension: 4},
 				},
 				{
 					AssetID:  "Asset 6",
 					Location: oneOrigin,
-					Capacity: 4,
+					Capacity: problem.Capacity{model.DefaultDimension: 4},
 				},
 				{
 					AssetID:  "Asset 7",
 					Location: oneOrigin,
-					Capacity: 4,
+					Capacity: problem.Capacity{model.DefaultDimension: 4},
 				},
 				{
 					AssetID:  "Asset 8",
 					Location: oneOrigin,
-					Capacity: 4,
+					Capacity: problem.Capacity{model.DefaultDimension: 4},
 				},
 			},
 			requests: manyRequests(t, oneOrigin),
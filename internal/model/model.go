@@ -11,36 +11,352 @@ type Problem struct {
 	Fleet       []Asset
 	Requests    []Request
 	Constraints Constraints
+	Departure   time.Time // Instant the assets leave their locations. Time windows are measured from it
+	HorizonEnd  time.Time // Instant by which every route must be done. Zero means no limit
+	Objective   Objective
+	Seed        int64 // Seed of the randomized parts of the algorithms. The same seed gives the same solution
 }
 
 func (p Problem) GetMaxJourneyTimeFactor() float64 {
 	return p.Constraints.MaxJourneyTimeFactor
 }
 
+// Objective weighs the parts of the cost of a solution. The algorithms keep their own costs with the zero objective
+type Objective struct {
+	VehicleCost    float64 // Fixed cost of every used asset
+	DistanceCost   float64 // Cost per kilometre driven
+	DurationCost   float64 // Cost per hour of route, including the waiting and the service times
+	RideTimeCost   float64 // Cost per minute of every rider in the vehicle
+	WaitingCost    float64 // Cost per minute the assets wait for the time windows
+	UnassignedCost float64 // Cost of every unassigned request besides its unassigned penalty
+}
+
+func (o Objective) IsZero() bool {
+	return o == Objective{}
+}
+
+// RouteUsage are the magnitudes of a route the objective weighs
+type RouteUsage struct {
+	Distance float64 // Meters
+	Duration time.Duration
+	RideTime time.Duration // Sum of the in-vehicle times of the riders
+	Waiting  time.Duration
+}
+
+// RouteCost is the cost of a used route
+func (o Objective) RouteCost(u RouteUsage) ObjectiveBreakdown {
+	return ObjectiveBreakdown{
+		Vehicles: o.VehicleCost,
+		Distance: o.DistanceCost * u.Distance / 1000,
+		Duration: o.DurationCost * u.Duration.Hours(),
+		RideTime: o.RideTimeCost * u.RideTime.Minutes(),
+		Waiting:  o.WaitingCost * u.Waiting.Minutes(),
+	}.withTotal()
+}
+
+// DefaultUnassignedCost is the cost of the unassigned requests the objective does not price. It is higher than the
+// cost of any route, so the requests are not left unassigned to save the cost of serving them
+const DefaultUnassignedCost = 1e6
+
+// UnassignedRequestCost is the default unassigned cost when neither the objective nor the request price it.
+// The must serve requests cost the default unassigned cost more, they are only left unassigned when they can not be
+// served
+func (o Objective) UnassignedRequestCost(req Request) float64 {
+	c := o.UnassignedCost + req.UnassignedPenalty
+	if c == 0 {
+		c = DefaultUnassignedCost
+	}
+	if req.MustServe {
+		c += DefaultUnassignedCost
+	}
+	return c
+}
+
+// Breakdown is the cost of the solution by part. The routes are measured from their waypoints.
+// It is empty with the zero objective, the algorithms keep their own costs then
+func (o Objective) Breakdown(s Solution) ObjectiveBreakdown {
+	var b ObjectiveBreakdown
+	if o.IsZero() {
+		return b
+	}
+	for _, sr := range s.Routes {
+		b = b.Add(o.RouteCost(sr.Usage()))
+	}
+	for _, u := range s.Unassigned {
+		b.Unassigned += o.UnassignedRequestCost(u.Request)
+	}
+	return b.withTotal()
+}
+
+// ObjectiveBreakdown is the cost of a solution by part
+type ObjectiveBreakdown struct {
+	Vehicles   float64
+	Distance   float64
+	Duration   float64
+	RideTime   float64
+	Waiting    float64
+	Unassigned float64
+	Total      float64
+}
+
+func (b ObjectiveBreakdown) Add(o ObjectiveBreakdown) ObjectiveBreakdown {
+	return ObjectiveBreakdown{
+		Vehicles:   b.Vehicles + o.Vehicles,
+		Distance:   b.Distance + o.Distance,
+		Duration:   b.Duration + o.Duration,
+		RideTime:   b.RideTime + o.RideTime,
+		Waiting:    b.Waiting + o.Waiting,
+		Unassigned: b.Unassigned + o.Unassigned,
+	}.withTotal()
+}
+
+func (b ObjectiveBreakdown) withTotal() ObjectiveBreakdown {
+	b.Total = b.Vehicles + b.Distance + b.Duration + b.RideTime + b.Waiting + b.Unassigned
+	return b
+}
+
 type Asset struct {
-	AssetID  AssetID
-	Location point.Point
-	Capacity Capacity
+	AssetID         AssetID
+	Location        point.Point
+	EndLocation     *point.Point // Where the route finishes. Nil for open routes, which finish at the last drop off
+	Capacity        Capacity
+	SetupDuration   time.Duration // Time to get the asset ready before leaving its location
+	Shift           TimeWindow    // Availability of the asset. The route can not start before it opens nor finish after it closes
+	MaxDuration     time.Duration // Max duration of the route. Zero means no limit
+	MaxDistance     float64       // Max driving distance of the route in meters. Zero means no limit
+	MaxRequests     int           // Max number of requests served in the route. Zero means no limit
+	Breaks          []BreakRule
+	Skills          []Skill
+	LockedStops     []LockedStop // Stops the asset is already committed to, in order. They are served first
+	InitialLoad     Load         // Load on board at the start of the route besides the onboard requests. It is never dropped off
+	OnboardRequests []Ref        // Requests already picked up. Only their drop offs are pending
+	FixedCost       float64      // Cost of using the asset
+	DistanceCost    float64      // Cost per kilometre driven
+	DurationCost    float64      // Cost per hour of route
 }
 
 type AssetID string
-type Load int
-type Capacity int
+
+func (a Asset) HasCosts() bool {
+	return a.FixedCost != 0 || a.DistanceCost != 0 || a.DurationCost != 0
+}
+
+// RouteCost is the monetary cost of a route of the asset. The distance is in meters
+func (a Asset) RouteCost(distance float64, duration time.Duration) float64 {
+	return a.FixedCost + a.DistanceCost*distance/1000 + a.DurationCost*duration.Hours()
+}
+
+// LockedStop is a stop of a request that can not be moved to another position nor to another asset
+type LockedStop struct {
+	RequestID Ref
+	Activity  ActivityType
+}
+
+// Skill is a feature of the asset or its driver: wheelchair ramp, child seat...
+type Skill string
+
+func (a Asset) IsOnboard(ref Ref) bool {
+	for _, onboard := range a.OnboardRequests {
+		if onboard == ref {
+			return true
+		}
+	}
+	return false
+}
+
+func (a Asset) HasSkills(skills []Skill) bool {
+	for _, required := range skills {
+		found := false
+		for _, s := range a.Skills {
+			if s == required {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// BreakRule is a break the driver of the asset must take during the route.
+// A break is taken at the location of the previous stop and it is needed when the route is still running
+// once its window opens or when the route drives longer than the allowed driving time
+type BreakRule struct {
+	ID           Ref
+	Duration     time.Duration
+	Window       TimeWindow    // Instants in which the break can start. Zero means any time
+	AfterDriving time.Duration // Max driving time before and after the break. Zero means no limit
+}
+
+// Dimension names a kind of capacity: seats, wheelchairs, luggage...
+type Dimension string
+
+// DefaultDimension is used when the capacities and the loads are plain numbers
+const DefaultDimension Dimension = "default"
+
+// Load is the amount of units of every dimension. Dimensions without units are not present
+type Load map[Dimension]int
+
+func NewLoad(units int) Load {
+	return Load{}.Add(Load{DefaultDimension: units})
+}
+
+func (l Load) Add(other Load) Load {
+	sum := make(Load, len(l))
+	for d, u := range l {
+		sum[d] = u
+	}
+	for d, u := range other {
+		sum[d] += u
+		if sum[d] == 0 {
+			delete(sum, d)
+		}
+	}
+	return sum
+}
+
+func (l Load) Negate() Load {
+	negated := make(Load, len(l))
+	for d, u := range l {
+		negated[d] = -u
+	}
+	return negated
+}
+
+// Units is the total amount of units of all the dimensions
+func (l Load) Units() int {
+	units := 0
+	for _, u := range l {
+		units += u
+	}
+	return units
+}
+
+// Capacity is the max amount of units of every dimension. Dimensions not present have no capacity
+type Capacity map[Dimension]int
+
+func NewCapacity(units int) Capacity {
+	return Capacity{DefaultDimension: units}
+}
+
+// Units is the total amount of units of all the dimensions
+func (c Capacity) Units() int {
+	units := 0
+	for _, u := range c {
+		units += u
+	}
+	return units
+}
+
+// Fits checks the load in every dimension
+func (c Capacity) Fits(l Load) bool {
+	for d, u := range l {
+		if u > c[d] {
+			return false
+		}
+	}
+	return true
+}
 
 type Constraints struct {
 	MaxJourneyTimeFactor float64 // Max multiplier on the direct route. Used to calculate the dropoff time offset
+	IncompatibleRequests []RequestPair
+	SameVehicleGroups    []RequestGroup // A request belongs to one group at most
+}
+
+// RequestPair are two requests that can not share a route
+type RequestPair [2]Ref
+
+// RequestGroup are requests that must share a route. They are all assigned or none of them
+type RequestGroup []Ref
+
+func (c Constraints) AreIncompatible(a, b Ref) bool {
+	for _, pair := range c.IncompatibleRequests {
+		if (pair[0] == a && pair[1] == b) || (pair[0] == b && pair[1] == a) {
+			return true
+		}
+	}
+	return false
+}
+
+// GroupOf returns the group of the request, or nil when it does not belong to any
+func (c Constraints) GroupOf(ref Ref) RequestGroup {
+	for _, group := range c.SameVehicleGroups {
+		for _, r := range group {
+			if r == ref {
+				return group
+			}
+		}
+	}
+	return nil
+}
+
+// TimeWindow is the interval of instants in which a stop can be served.
+// A zero bound means the window is open on that side
+type TimeWindow struct {
+	Earliest time.Time
+	Latest   time.Time
+}
+
+func (w TimeWindow) HasEarliest() bool {
+	return !w.Earliest.IsZero()
+}
+
+func (w TimeWindow) HasLatest() bool {
+	return !w.Latest.IsZero()
+}
+
+func (w TimeWindow) IsZero() bool {
+	return !w.HasEarliest() && !w.HasLatest()
+}
+
+// ServiceDuration is the time spent at a stop boarding or alighting
+type ServiceDuration struct {
+	Base        time.Duration
+	PerLoadUnit time.Duration
+}
+
+func (d ServiceDuration) For(load Load) time.Duration {
+	return d.Base + d.PerLoadUnit*time.Duration(load.Units())
 }
 
 type Solution struct {
 	Metrics    SolutionMetrics
 	Routes     []SolutionRoute
-	Unassigned []Request
+	Unassigned []UnassignedRequest
 }
 
-func NewSolution(metrics SolutionMetrics, routes []SolutionRoute, unassigned []Request) *Solution {
+func NewSolution(metrics SolutionMetrics, routes []SolutionRoute, unassigned []UnassignedRequest) *Solution {
 	return &Solution{Metrics: metrics, Routes: routes, Unassigned: unassigned}
 }
 
+// UnassignedRequest is a request that could not be inserted in any route,
+// with the constraints violated when trying to insert it
+type UnassignedRequest struct {
+	Request
+	Reasons []UnassignedReason
+}
+
+type UnassignedReason string
+
+const (
+	UnassignedReasonCapacity     UnassignedReason = "capacity"
+	UnassignedReasonTimeWindow   UnassignedReason = "time_window"
+	UnassignedReasonShift        UnassignedReason = "shift"
+	UnassignedReasonMaxDuration  UnassignedReason = "max_duration"
+	UnassignedReasonMaxDistance  UnassignedReason = "max_distance"
+	UnassignedReasonMaxRequests  UnassignedReason = "max_requests"
+	UnassignedReasonBreak        UnassignedReason = "break"
+	UnassignedReasonMaxRideTime  UnassignedReason = "max_ride_time"
+	UnassignedReasonSkills       UnassignedReason = "skills"
+	UnassignedReasonNotAllowed   UnassignedReason = "asset_not_allowed"
+	UnassignedReasonIncompatible UnassignedReason = "incompatible_requests"
+	UnassignedReasonGroup        UnassignedReason = "group"
+	UnassignedReasonStopped      UnassignedReason = "stopped" // The solving was stopped before trying the request
+)
+
 type SolutionRoute struct {
 	Asset     Asset
 	Requests  []Request
@@ -48,10 +364,39 @@ type SolutionRoute struct {
 	Metrics   RouteMetrics
 }
 
+// Usage measures the route from its waypoints. The riders on board at the start ride from the departure of the asset
+func (sr SolutionRoute) Usage() RouteUsage {
+	u := RouteUsage{Distance: sr.Metrics.Distance, Duration: sr.Metrics.Duration}
+	if len(sr.Waypoints) == 0 {
+		return u
+	}
+	pickedUp := make(map[Ref]time.Time)
+	for _, ref := range sr.Asset.OnboardRequests {
+		pickedUp[ref] = sr.Waypoints[0].Departure
+	}
+	for _, w := range sr.Waypoints {
+		u.Waiting += w.ServiceStart.Sub(w.Arrival)
+		for _, a := range w.Activities {
+			switch a.ActivityType {
+			case ActivityTypePickUp:
+				pickedUp[a.Ref] = w.Departure
+			case ActivityTypeDropOff:
+				if start, ok := pickedUp[a.Ref]; ok {
+					u.RideTime += w.ServiceStart.Sub(start)
+				}
+			}
+		}
+	}
+	return u
+}
+
 type Waypoint struct {
-	Location   point.Point
-	Load       Load
-	Activities []Activity
+	Location     point.Point
+	Load         Load
+	Activities   []Activity
+	Arrival      time.Time
+	ServiceStart time.Time
+	Departure    time.Time
 }
 
 type Ref string
@@ -70,19 +415,43 @@ const (
 	ActivityTypePickUp  ActivityType = "PickUp"
 	ActivityTypeDropOff ActivityType = "DropOff"
 	ActivityTypeStart   ActivityType = "Start"
+	ActivityTypeEnd     ActivityType = "End"
+	ActivityTypeBreak   ActivityType = "Break"
 )
 
 type RouteMetrics struct {
 	Duration time.Duration
 	Distance float64
+	Start    time.Time
+	End      time.Time
+	Cost     float64 // Monetary cost of the route with the costs of its asset
 }
 type SolutionMetrics struct {
-	NumAssets     int
-	NumRequests   int
-	NumUnassigned int
-	Duration      time.Duration
-	Distance      float64
-	SolvedTime    time.Duration
+	NumAssets         int
+	NumRequests       int
+	NumUnassigned     int
+	Duration          time.Duration
+	Distance          float64
+	SolvedTime        time.Duration
+	UnassignedPenalty float64 // Sum of the penalties of the unassigned requests
+	Objective         ObjectiveBreakdown
+	Cost              float64  // Monetary cost of the routes
+	Value             float64  // Cost the algorithms minimize. The objective total when the problem has an objective
+	LowerBound        *float64 // Lower bound of the value of the optimal solution. Nil when unknown
+	Partial           bool     // The solving was stopped, the solution is the best one found so far
+	Seed              int64    // Seed of the problem the solution was found with
+}
+
+// OptimalityGap is the relative distance between the value of the solution and its lower bound.
+// It is false when the lower bound is unknown
+func (m SolutionMetrics) OptimalityGap() (float64, bool) {
+	if m.LowerBound == nil {
+		return 0, false
+	}
+	if m.Value <= 0 || *m.LowerBound >= m.Value {
+		return 0, true
+	}
+	return (m.Value - *m.LowerBound) / m.Value, true
 }
 
 func NewSolutionMetrics(numAssets, numRequests, numUnassigned int, distance float64, duration, solvedTime time.Duration) SolutionMetrics {
@@ -96,10 +465,44 @@ type Request struct {
 	Load               Load
 	PickUp             point.Point
 	DropOff            point.Point
+	PickUpTimeWindow   TimeWindow
+	DropOffTimeWindow  TimeWindow
+	PickUpDuration     ServiceDuration
+	DropOffDuration    ServiceDuration
+	MaxRideTime        time.Duration // Max in-vehicle time. Zero means no limit
+	MaxDetourFactor    float64       // Max multiplier on the direct time from the pick up to the drop off. Zero means no limit
+	RequiredSkills     []Skill
+	AllowedAssets      []AssetID // Only these assets can serve the request. Empty means any asset
+	ForbiddenAssets    []AssetID
+	AssetID            AssetID // The request can only be assigned to this asset. Empty means any asset
+	Priority           int     // Higher priorities are inserted first
+	UnassignedPenalty  float64 // Cost of leaving the request unassigned
+	MustServe          bool    // The solve fails when the request can not be assigned
 	PickUpServiceTime  time.Duration
 	DropOffServiceTime time.Duration
 }
 
+// IsAllowedFor checks the allowed and forbidden assets of the request
+func (r Request) IsAllowedFor(asset AssetID) bool {
+	if r.AssetID != "" && r.AssetID != asset {
+		return false
+	}
+	for _, a := range r.ForbiddenAssets {
+		if a == asset {
+			return false
+		}
+	}
+	if len(r.AllowedAssets) == 0 {
+		return true
+	}
+	for _, a := range r.AllowedAssets {
+		if a == asset {
+			return true
+		}
+	}
+	return false
+}
+
 type Route []*Stop
 
 func (r Route) Swap(i, j int) {
@@ -117,25 +520,49 @@ func (r Route) GetPoints() []point.Point {
 }
 
 type Stop struct {
-	Ref            Ref
-	Point          point.Point
-	MaxServiceTime time.Duration
-	ServiceTime    time.Duration
-	Load           Load
-	Activity       ActivityType
+	Ref             Ref
+	Point           point.Point
+	MinServiceTime  time.Duration // The asset waits when it arrives before it
+	MaxServiceTime  time.Duration
+	ArrivalTime     time.Duration
+	ServiceTime     time.Duration
+	ServiceDuration time.Duration
+	MaxRideTime     time.Duration // Only for drop offs. Zero means no limit
+	Locked          bool          // Locked stops keep their position
+	Load            Load
+	Activity        ActivityType
 }
 
 func (s Stop) IsAssetDeparture() bool {
 	return s.Activity == ActivityTypeStart
 }
 
+func (s Stop) IsAssetArrival() bool {
+	return s.Activity == ActivityTypeEnd
+}
+
+func (s Stop) IsBreak() bool {
+	return s.Activity == ActivityTypeBreak
+}
+
+func (s Stop) GetMinServiceTime() time.Duration {
+	return s.MinServiceTime
+}
+
 func (s Stop) GetMaxServiceTime() time.Duration {
 	return s.MaxServiceTime
 }
 
+func (s Stop) GetDepartureTime() time.Duration {
+	return s.ServiceTime + s.ServiceDuration
+}
+
 func (s Stop) String() string {
 	t := "Depot"
-	if !s.IsAssetDeparture() {
+	switch {
+	case s.IsBreak():
+		t = "Break"
+	case !s.IsAssetDeparture() && !s.IsAssetArrival():
 		t = "Request"
 	}
 	return fmt.Sprintf(`[%s '%s' (%s)]`, t, s.Activity, s.Point)
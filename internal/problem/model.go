@@ -13,39 +13,109 @@ type ID struct {
 }
 
 type Problem struct {
-	ID          ID
-	Fleet       []Asset
-	Requests    []Request
-	Constraints Constraints
+	ID           ID
+	Fleet        []Asset
+	Requests     []Request
+	Constraints  Constraints
+	Departure    time.Time          // Instant the assets leave their locations
+	HorizonEnd   time.Time          // Instant by which every route must be done. Zero means no limit
+	Algorithm    string             // Name of the algorithm solving the problem. Empty means the default one
+	Parameters   map[string]float64 // Tunable parameters of the algorithm. The defaults for the missing ones
+	Objective    model.Objective    // Costs the solution is optimized for. Zero means the costs of the algorithm
+	MaxSolveTime time.Duration      // Max time solving the problem. The best solution so far is returned. Zero means no limit
+	Seed         int64              // Seed of the randomized parts of the algorithms. Zero means a random one
 }
 
 type Asset struct {
-	AssetID  AssetID
-	Location point.Point
-	Capacity Capacity
+	AssetID         AssetID
+	Location        point.Point
+	EndLocation     *point.Point // Where the route finishes. Nil for open routes
+	Capacity        Capacity
+	SetupDuration   time.Duration // Time to get the asset ready before leaving its location
+	Shift           TimeWindow    // Availability of the asset. Zero means always available
+	MaxDuration     time.Duration // Max duration of the route. Zero means no limit
+	MaxDistance     float64       // Max driving distance of the route in meters. Zero means no limit
+	MaxRequests     int           // Max number of requests served in the route. Zero means no limit
+	Breaks          []BreakRule
+	Skills          []model.Skill
+	LockedStops     []LockedStop // Stops the asset is already committed to, in order
+	InitialLoad     Load         // Load on board at the start of the route besides the onboard requests
+	OnboardRequests []RequestID  // Requests already picked up. Only their drop offs are pending
+	FixedCost       float64      // Cost of using the asset
+	DistanceCost    float64      // Cost per kilometre driven
+	DurationCost    float64      // Cost per hour of route
+}
+
+// LockedStop is a stop of a request that can not be moved to another position nor to another asset
+type LockedStop struct {
+	RequestID RequestID
+	Activity  model.ActivityType
 }
 
 type AssetID string
-type Capacity int8
-type Load int8
+
+// BreakRule is a break the driver of the asset must take during the route
+type BreakRule struct {
+	ID           string
+	Duration     time.Duration
+	Window       TimeWindow    // Instants in which the break can start. Zero means any time
+	AfterDriving time.Duration // Max driving time before and after the break. Zero means no limit
+}
+type Capacity map[model.Dimension]int
+type Load map[model.Dimension]int
 
 type Request struct {
 	RequestID          RequestID
 	PickUp             point.Point
 	DropOff            point.Point
 	Load               Load
+	PickUpTimeWindow   TimeWindow
+	DropOffTimeWindow  TimeWindow
+	PickUpDuration     ServiceDuration
+	DropOffDuration    ServiceDuration
+	MaxRideTime        time.Duration // Max in-vehicle time. Zero means no limit
+	MaxDetourFactor    float64       // Max multiplier on the direct time from the pick up to the drop off. Zero means no limit
+	RequiredSkills     []model.Skill
+	AllowedAssets      []AssetID // Only these assets can serve the request. Empty means any asset
+	ForbiddenAssets    []AssetID
+	AssetID            AssetID // The request can only be assigned to this asset. Empty means any asset
+	Priority           int     // Higher priorities are inserted first
+	UnassignedPenalty  float64 // Cost of leaving the request unassigned
+	MustServe          bool    // The solve fails when the request can not be assigned
 	PickUpServiceTime  time.Duration
 	DropOffServiceTime time.Duration
 }
 
 type RequestID string
 
+// TimeWindow is the interval of instants in which a stop can be served.
+// A zero bound means the window is open on that side
+type TimeWindow struct {
+	Earliest time.Time
+	Latest   time.Time
+}
+
+// ServiceDuration is the time spent at a stop boarding or alighting
+type ServiceDuration struct {
+	Base        time.Duration
+	PerLoadUnit time.Duration
+}
+
 type Constraints struct {
 	MaxJourneyTimeFactor float64 // Max multiplier on the direct route. Used to calculate the dropoff time offset
+	IncompatibleRequests []RequestPair
+	SameVehicleGroups    []RequestGroup
 }
 
+// RequestPair are two requests that can not share a route
+type RequestPair [2]RequestID
+
+// RequestGroup are requests that must share a route
+type RequestGroup []RequestID
+
 type Solution struct {
-	ID ID
+	ID      ID
+	Version int // Every change of the solution of the problem is a new version
 	model.Solution
 }
 
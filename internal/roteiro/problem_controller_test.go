@@ -9,6 +9,7 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/edusalguero/roteiro.git/internal/logger"
 	"github.com/edusalguero/roteiro.git/internal/model"
@@ -72,20 +73,20 @@ func TestProblemController_getProblem(t *testing.T) {
 									Asset: model.Asset{
 										AssetID:  "asset ID",
 										Location: point.NewPoint(52.52568, 13.45345),
-										Capacity: 1,
+										Capacity: model.NewCapacity(1),
 									},
 									Requests: []model.Request{
 										{
 											RequestID: "requester ID",
 											PickUp:    point.NewPoint(52.52568, 13.45345),
 											DropOff:   point.NewPoint(52.52568, 13.45345),
-											Load:      1,
+											Load:      model.NewLoad(1),
 										},
 									},
 									Waypoints: []model.Waypoint{
 										{
 											Location: point.NewPoint(52.52568, 13.45345),
-											Load:     0,
+											Load:     model.NewLoad(0),
 											Activities: []model.Activity{
 												{
 													ActivityType: model.ActivityTypeStart,
@@ -100,9 +101,15 @@ func TestProblemController_getProblem(t *testing.T) {
 													Ref:          "requester ID",
 												},
 											},
+											Arrival:      time.Date(2020, 12, 1, 8, 0, 0, 0, time.UTC),
+											ServiceStart: time.Date(2020, 12, 1, 8, 0, 0, 0, time.UTC),
+											Departure:    time.Date(2020, 12, 1, 8, 0, 0, 0, time.UTC),
 										},
 									},
-									Metrics: model.RouteMetrics{},
+									Metrics: model.RouteMetrics{
+										Start: time.Date(2020, 12, 1, 8, 0, 0, 0, time.UTC),
+										End:   time.Date(2020, 12, 1, 8, 0, 0, 0, time.UTC),
+									},
 								},
 							},
 						},
@@ -2,11 +2,13 @@ package roteiro
 
 import (
 	"context"
+	"errors"
 	"net/http"
 
 	"github.com/edusalguero/roteiro.git/internal/logger"
 	"github.com/edusalguero/roteiro.git/internal/problem"
 	"github.com/edusalguero/roteiro.git/internal/solver"
+	"github.com/edusalguero/roteiro.git/internal/store"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 )
@@ -35,6 +37,21 @@ func (c *SolverController) AddRoutes(g *gin.Engine) {
 	v1 := g.Group("/api/v1/")
 	v1.POST("problem", c.solveProblem)
 	v1.POST("problem-long", c.solveProblemAsync)
+	v1.POST("problem/:problem_id/requests", c.insertRequests)
+	v1.POST("problem/:problem_id/cancellations", c.cancelRequests)
+	v1.GET("algorithms", c.algorithms)
+}
+
+// The options are checked against the algorithms of the solver
+func (c *SolverController) validateOptions(o *options) error {
+	if o == nil {
+		return nil
+	}
+	return o.validate(c.solver.Algorithms())
+}
+
+func (c *SolverController) algorithms(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, newAlgorithmsResponse(c.solver.Algorithms()))
 }
 
 func (c *SolverController) solveProblem(ctx *gin.Context) {
@@ -45,12 +62,32 @@ func (c *SolverController) solveProblem(ctx *gin.Context) {
 		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Bad request!"})
 		return
 	}
+	if err := problemRequest.validate(); err != nil {
+		c.logger.Errorf("Invalid problem request: %v", err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := c.validateOptions(problemRequest.Options); err != nil {
+		c.logger.Errorf("Invalid problem options: %v", err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	id := c.idGeneratorFunc()
 	c.logger.Infof("Solving problem [%s]... [%v]", id, problemRequest)
 	sol, err := c.solver.SolveProblem(
-		context.Background(),
+		ctx.Request.Context(),
 		newProblemFromRequest(problemRequest, id),
 	)
+	if errors.Is(err, solver.ErrInvalidOptions) {
+		c.logger.Errorf("Invalid problem options: %v", err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, solver.ErrInfeasible) {
+		c.logger.Errorf("Infeasible problem: %v", err)
+		ctx.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		c.logger.Errorf("Error solving problem: %v", err)
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error processing solver!"})
@@ -70,9 +107,20 @@ func (c *SolverController) solveProblemAsync(ctx *gin.Context) {
 		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Bad request!"})
 		return
 	}
+	if err := problemRequest.validate(); err != nil {
+		c.logger.Errorf("Invalid problem request: %v", err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := c.validateOptions(problemRequest.Options); err != nil {
+		c.logger.Errorf("Invalid problem options: %v", err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	id := c.idGeneratorFunc()
 	c.logger.Infof("Solving problem [%s]... [%v]", id, problemRequest)
 	p := newProblemFromRequest(problemRequest, id)
+	// The request is done before the solving, only the max solve time of the problem stops it
 	go func(p problem.Problem) {
 		_, _ = c.solver.SolveProblem(
 			context.Background(),
@@ -80,3 +128,100 @@ func (c *SolverController) solveProblemAsync(ctx *gin.Context) {
 	}(p)
 	ctx.JSON(http.StatusAccepted, gin.H{"problem_id": id})
 }
+
+func (c *SolverController) insertRequests(ctx *gin.Context) {
+	problemID := ctx.Param("problem_id")
+	log := c.logger.WithField("problem_id", problemID)
+
+	uid, err := uuid.Parse(problemID)
+	if err != nil {
+		log.Errorf("Invalid problem id: %v", err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid problem id!"})
+		return
+	}
+	var insertionRequest insertionRequest
+	if err := ctx.ShouldBindJSON(&insertionRequest); err != nil {
+		log.Errorf("Error processing request body: %v", err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Bad request!"})
+		return
+	}
+	if err := insertionRequest.validate(); err != nil {
+		log.Errorf("Invalid insertion request: %v", err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	log.Infof("Inserting requests... [%v]", insertionRequest)
+	sol, err := c.solver.InsertRequests(
+		ctx.Request.Context(),
+		problem.ID{UUID: uid},
+		toProblemRequests(insertionRequest.Requests),
+	)
+	if err != nil {
+		log.Errorf("Error inserting requests: %v", err)
+		respondSolutionChangeError(ctx, err)
+		return
+	}
+	res := newSolutionResponseFromSol(sol)
+	log.Infof("Requests inserted... [%v]", res)
+
+	ctx.JSON(http.StatusOK, res)
+}
+
+func (c *SolverController) cancelRequests(ctx *gin.Context) {
+	problemID := ctx.Param("problem_id")
+	log := c.logger.WithField("problem_id", problemID)
+
+	uid, err := uuid.Parse(problemID)
+	if err != nil {
+		log.Errorf("Invalid problem id: %v", err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid problem id!"})
+		return
+	}
+	var cancellationRequest cancellationRequest
+	if err := ctx.ShouldBindJSON(&cancellationRequest); err != nil {
+		log.Errorf("Error processing request body: %v", err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Bad request!"})
+		return
+	}
+	if err := cancellationRequest.validate(); err != nil {
+		log.Errorf("Invalid cancellation request: %v", err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	log.Infof("Cancelling requests... [%v]", cancellationRequest)
+	sol, err := c.solver.CancelRequests(
+		ctx.Request.Context(),
+		problem.ID{UUID: uid},
+		toProblemRequestIDs(cancellationRequest.RequesterIDs),
+		cancellationRequest.ReinsertUnassigned,
+	)
+	if err != nil {
+		log.Errorf("Error cancelling requests: %v", err)
+		respondSolutionChangeError(ctx, err)
+		return
+	}
+	res := newSolutionResponseFromSol(sol)
+	log.Infof("Requests cancelled... [%v]", res)
+
+	ctx.JSON(http.StatusOK, res)
+}
+
+// The errors changing the solution of a stored problem
+func respondSolutionChangeError(ctx *gin.Context, err error) {
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Problem not found!"})
+	case errors.Is(err, store.ErrInProcess):
+		ctx.JSON(http.StatusConflict, gin.H{"error": "Solution is being processed!"})
+	case errors.Is(err, solver.ErrVersionConflict):
+		ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, solver.ErrDuplicatedRequest), errors.Is(err, solver.ErrUnknownRequest):
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, solver.ErrInfeasible):
+		ctx.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+	default:
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Error processing solver!"})
+	}
+}
@@ -4,18 +4,24 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"path/filepath"
+	"regexp"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/edusalguero/roteiro.git/internal/distanceestimator"
 	"github.com/edusalguero/roteiro.git/internal/logger"
 	"github.com/edusalguero/roteiro.git/internal/model"
 	"github.com/edusalguero/roteiro.git/internal/point"
 	"github.com/edusalguero/roteiro.git/internal/problem"
 	"github.com/edusalguero/roteiro.git/internal/solver"
 	solverMock "github.com/edusalguero/roteiro.git/internal/solver/mock"
+	"github.com/edusalguero/roteiro.git/internal/store"
 	httpwrapper "github.com/edusalguero/roteiro.git/internal/utils/httpserver"
 	"github.com/go-test/deep"
 	"github.com/golang/mock/gomock"
@@ -40,6 +46,148 @@ func TestSolverController_solveProblem(t *testing.T) {
 			},
 			400,
 		},
+		{
+			"when invalid time window",
+			func() uuid.UUID {
+				return uuid.MustParse("6e175ad7-7776-4992-94e0-b010589d0772")
+			},
+			func(t *testing.T, s *solverMock.MockService) {
+				// Do nothing
+			},
+			400,
+		},
+		{
+			"when capacity overflows",
+			func() uuid.UUID {
+				return uuid.MustParse("6e175ad7-7776-4992-94e0-b010589d0772")
+			},
+			func(t *testing.T, s *solverMock.MockService) {
+				// Do nothing
+			},
+			400,
+		},
+		{
+			"when negative asset limit",
+			func() uuid.UUID {
+				return uuid.MustParse("6e175ad7-7776-4992-94e0-b010589d0772")
+			},
+			func(t *testing.T, s *solverMock.MockService) {
+				// Do nothing
+			},
+			400,
+		},
+		{
+			"when negative asset cost",
+			func() uuid.UUID {
+				return uuid.MustParse("6e175ad7-7776-4992-94e0-b010589d0772")
+			},
+			func(t *testing.T, s *solverMock.MockService) {
+				// Do nothing
+			},
+			400,
+		},
+		{
+			"when negative objective cost",
+			func() uuid.UUID {
+				return uuid.MustParse("6e175ad7-7776-4992-94e0-b010589d0772")
+			},
+			func(t *testing.T, s *solverMock.MockService) {
+				// Do nothing
+			},
+			400,
+		},
+		{
+			"when invalid break",
+			func() uuid.UUID {
+				return uuid.MustParse("6e175ad7-7776-4992-94e0-b010589d0772")
+			},
+			func(t *testing.T, s *solverMock.MockService) {
+				// Do nothing
+			},
+			400,
+		},
+		{
+			"when invalid detour factor",
+			func() uuid.UUID {
+				return uuid.MustParse("6e175ad7-7776-4992-94e0-b010589d0772")
+			},
+			func(t *testing.T, s *solverMock.MockService) {
+				// Do nothing
+			},
+			400,
+		},
+		{
+			"when invalid same vehicle group",
+			func() uuid.UUID {
+				return uuid.MustParse("6e175ad7-7776-4992-94e0-b010589d0772")
+			},
+			func(t *testing.T, s *solverMock.MockService) {
+				// Do nothing
+			},
+			400,
+		},
+		{
+			"when invalid locked stop",
+			func() uuid.UUID {
+				return uuid.MustParse("6e175ad7-7776-4992-94e0-b010589d0772")
+			},
+			func(t *testing.T, s *solverMock.MockService) {
+				// Do nothing
+			},
+			400,
+		},
+		{
+			"when invalid onboard request",
+			func() uuid.UUID {
+				return uuid.MustParse("6e175ad7-7776-4992-94e0-b010589d0772")
+			},
+			func(t *testing.T, s *solverMock.MockService) {
+				// Do nothing
+			},
+			400,
+		},
+		{
+			"when unknown algorithm",
+			func() uuid.UUID {
+				return uuid.MustParse("6e175ad7-7776-4992-94e0-b010589d0772")
+			},
+			func(t *testing.T, s *solverMock.MockService) {
+				s.EXPECT().Algorithms().Return(solver.NewAlgorithmRegistry(solver.Config{}))
+			},
+			400,
+		},
+		{
+			"when unknown algorithm parameter",
+			func() uuid.UUID {
+				return uuid.MustParse("6e175ad7-7776-4992-94e0-b010589d0772")
+			},
+			func(t *testing.T, s *solverMock.MockService) {
+				s.EXPECT().Algorithms().Return(solver.NewAlgorithmRegistry(solver.Config{}))
+			},
+			400,
+		},
+		{
+			"when negative max solve time",
+			func() uuid.UUID {
+				return uuid.MustParse("6e175ad7-7776-4992-94e0-b010589d0772")
+			},
+			func(t *testing.T, s *solverMock.MockService) {
+				s.EXPECT().Algorithms().Return(solver.NewAlgorithmRegistry(solver.Config{}))
+			},
+			400,
+		},
+		{
+			"when infeasible problem",
+			func() uuid.UUID {
+				return uuid.MustParse("6e175ad7-7776-4992-94e0-b010589d0772")
+			},
+			func(t *testing.T, s *solverMock.MockService) {
+				s.EXPECT().
+					SolveProblem(gomock.Any(), gomock.Any()).
+					Return(nil, fmt.Errorf("%w: must serve requests can not be assigned", solver.ErrInfeasible))
+			},
+			422,
+		},
 		{
 			"when error solving problem",
 			func() uuid.UUID {
@@ -58,6 +206,7 @@ func TestSolverController_solveProblem(t *testing.T) {
 				return uuid.MustParse("83437db4-3e3b-4167-bb7b-74178b6586fd")
 			},
 			func(t *testing.T, s *solverMock.MockService) {
+				lowerBound := 150.0
 				s.EXPECT().
 					SolveProblem(gomock.Any(), gomock.Any()).
 					Return(&problem.Solution{
@@ -70,26 +219,28 @@ func TestSolverController_solveProblem(t *testing.T) {
 								Duration:      0,
 								Distance:      0,
 								SolvedTime:    161939,
+								Value:         200,
+								LowerBound:    &lowerBound,
 							},
 							Routes: []model.SolutionRoute{
 								{
 									Asset: model.Asset{
 										AssetID:  "asset ID",
 										Location: point.NewPoint(52.52568, 13.45345),
-										Capacity: 1,
+										Capacity: model.NewCapacity(1),
 									},
 									Requests: []model.Request{
 										{
 											RequestID: "requester ID",
 											PickUp:    point.NewPoint(52.52568, 13.45345),
 											DropOff:   point.NewPoint(52.52568, 13.45345),
-											Load:      1,
+											Load:      model.NewLoad(1),
 										},
 									},
 									Waypoints: []model.Waypoint{
 										{
 											Location: point.NewPoint(52.52568, 13.45345),
-											Load:     0,
+											Load:     model.NewLoad(0),
 											Activities: []model.Activity{
 												{
 													ActivityType: model.ActivityTypeStart,
@@ -104,12 +255,53 @@ func TestSolverController_solveProblem(t *testing.T) {
 													Ref:          "requester ID",
 												},
 											},
+											Arrival:      time.Date(2020, 12, 1, 8, 0, 0, 0, time.UTC),
+											ServiceStart: time.Date(2020, 12, 1, 8, 0, 0, 0, time.UTC),
+											Departure:    time.Date(2020, 12, 1, 8, 0, 0, 0, time.UTC),
 										},
 									},
-									Metrics: model.RouteMetrics{},
+									Metrics: model.RouteMetrics{
+										Start: time.Date(2020, 12, 1, 8, 0, 0, 0, time.UTC),
+										End:   time.Date(2020, 12, 1, 8, 0, 0, 0, time.UTC),
+									},
+								},
+							},
+							Unassigned: []model.UnassignedRequest{},
+						},
+					}, nil)
+			},
+			200,
+		},
+		{
+			"when unassigned requests",
+			func() uuid.UUID {
+				return uuid.MustParse("83437db4-3e3b-4167-bb7b-74178b6586fd")
+			},
+			func(t *testing.T, s *solverMock.MockService) {
+				s.EXPECT().
+					SolveProblem(gomock.Any(), gomock.Any()).
+					Return(&problem.Solution{
+						ID: problem.ID{UUID: uuid.MustParse("83437db4-3e3b-4167-bb7b-74178b6586fd")},
+						Solution: model.Solution{
+							Metrics: model.SolutionMetrics{
+								NumUnassigned: 1,
+								SolvedTime:    161939,
+							},
+							Routes: []model.SolutionRoute{},
+							Unassigned: []model.UnassignedRequest{
+								{
+									Request: model.Request{
+										RequestID: "requester ID",
+										PickUp:    point.NewPoint(52.52568, 13.45345),
+										DropOff:   point.NewPoint(52.52568, 13.45345),
+										Load:      model.NewLoad(1),
+									},
+									Reasons: []model.UnassignedReason{
+										model.UnassignedReasonShift,
+										model.UnassignedReasonMaxDuration,
+									},
 								},
 							},
-							Unassigned: []model.Request{},
 						},
 					}, nil)
 			},
@@ -162,7 +354,7 @@ func TestSolverController_solveProblemAsync(t *testing.T) {
 	tests := []struct {
 		name          string
 		idGenerator   func() uuid.UUID
-		prepareSolver func(t *testing.T, s *solverMock.MockService)
+		prepareSolver func(t *testing.T, s *solverMock.MockService, solving *sync.WaitGroup)
 		statusCode    int
 	}{
 		{
@@ -170,7 +362,7 @@ func TestSolverController_solveProblemAsync(t *testing.T) {
 			func() uuid.UUID {
 				return uuid.MustParse("6e175ad7-7776-4992-94e0-b010589d0772")
 			},
-			func(t *testing.T, s *solverMock.MockService) {
+			func(t *testing.T, s *solverMock.MockService, solving *sync.WaitGroup) {
 				// Do nothing
 			},
 			400,
@@ -180,9 +372,12 @@ func TestSolverController_solveProblemAsync(t *testing.T) {
 			func() uuid.UUID {
 				return uuid.MustParse("83437db4-3e3b-4167-bb7b-74178b6586fd")
 			},
-			func(t *testing.T, s *solverMock.MockService) {
+			func(t *testing.T, s *solverMock.MockService, solving *sync.WaitGroup) {
+				solving.Add(1)
 				s.EXPECT().
-					SolveProblem(gomock.Any(), gomock.Any()).Times(1)
+					SolveProblem(gomock.Any(), gomock.Any()).
+					Do(func(context.Context, problem.Problem) { solving.Done() }).
+					Times(1)
 			},
 			202,
 		},
@@ -201,7 +396,8 @@ func TestSolverController_solveProblemAsync(t *testing.T) {
 			log := logger.NewNopLogger()
 
 			s := solverMock.NewMockService(ctrl)
-			tt.prepareSolver(t, s)
+			var solving sync.WaitGroup
+			tt.prepareSolver(t, s, &solving)
 			httpServerWrapper.AddController(NewSolverController(log, s, tt.idGenerator))
 
 			w := httptest.NewRecorder()
@@ -210,6 +406,8 @@ func TestSolverController_solveProblemAsync(t *testing.T) {
 			r := readRequestJSON(t, reqPath)
 			req, _ := http.NewRequest("POST", path, bytes.NewReader(r))
 			httpServerWrapper.GetGin().ServeHTTP(w, req)
+			// The problem is solved in background
+			solving.Wait()
 
 			var resData interface{}
 			_ = json.NewDecoder(w.Body).Decode(&resData)
@@ -229,6 +427,264 @@ func TestSolverController_solveProblemAsync(t *testing.T) {
 	}
 }
 
+// The problems give the departure of the assets and are not stopped by time, the alns and the exact have no time limit
+func TestSolverController_solveProblem_SameSeed(t *testing.T) {
+	// The solved time is the only part of the response measured by the clock
+	solvedTime := regexp.MustCompile(`"solved_time":[0-9]+`)
+	idGenerator := func() uuid.UUID {
+		return uuid.MustParse("83437db4-3e3b-4167-bb7b-74178b6586fd")
+	}
+	// Every problem is solved by a new solver, the problem id is not repeated in its repository
+	solve := func(t *testing.T, body []byte) []byte {
+		httpServerWrapper := httpwrapper.NewHTTPServerWrapper(httpwrapper.Config{
+			Mode: "debug",
+			Port: "9092",
+		})
+		defer httpServerWrapper.Stop(context.Background())
+		log := logger.NewNopLogger()
+
+		s := solver.NewSolver(log, solver.Config{
+			LocalSearchBudget: time.Minute,
+			ALNSTimeLimit:     time.Minute,
+			ExactTimeLimit:    time.Minute,
+			MultiStartStarts:  32,
+			MultiStartWorkers: 4,
+		}, store.NewInMemoryRepository(), distanceestimator.NewHaversineDistanceEstimator(80))
+		httpServerWrapper.AddController(NewSolverController(log, s, idGenerator))
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/v1/problem", bytes.NewReader(body))
+		httpServerWrapper.GetGin().ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Len(t, solvedTime.FindAll(w.Body.Bytes(), -1), 1)
+		return solvedTime.ReplaceAll(w.Body.Bytes(), []byte(`"solved_time":0`))
+	}
+
+	for _, name := range []string{"sequential_construction", "local_search", "alns", "multi_start", "exact"} {
+		t.Run(name, func(t *testing.T) {
+			reqPath := filepath.Join("./testdata", t.Name()+".req.json")
+			r := readRequestJSON(t, reqPath)
+
+			first, second := solve(t, r), solve(t, r)
+			assert.Equal(t, string(first), string(second))
+			assert.Contains(t, string(first), `"seed":42`)
+		})
+	}
+}
+
+func TestSolverController_insertRequests(t *testing.T) {
+	tests := []struct {
+		name          string
+		problemID     string
+		prepareSolver func(t *testing.T, s *solverMock.MockService)
+		statusCode    int
+	}{
+		{
+			"when invalid problem id",
+			"invalid",
+			func(t *testing.T, s *solverMock.MockService) {
+				// Do nothing
+			},
+			400,
+		},
+		{
+			"when duplicated request",
+			"83437db4-3e3b-4167-bb7b-74178b6586fd",
+			func(t *testing.T, s *solverMock.MockService) {
+				// Do nothing
+			},
+			400,
+		},
+		{
+			"when problem not found",
+			"83437db4-3e3b-4167-bb7b-74178b6586fd",
+			func(t *testing.T, s *solverMock.MockService) {
+				s.EXPECT().
+					InsertRequests(gomock.Any(), gomock.Any(), gomock.Any()).
+					Return(nil, fmt.Errorf("getting solution: %w", store.ErrNotFound))
+			},
+			404,
+		},
+		{
+			"when solution changed",
+			"83437db4-3e3b-4167-bb7b-74178b6586fd",
+			func(t *testing.T, s *solverMock.MockService) {
+				s.EXPECT().
+					InsertRequests(gomock.Any(), gomock.Any(), gomock.Any()).
+					Return(nil, fmt.Errorf("%w: version 2 already exists", solver.ErrVersionConflict))
+			},
+			409,
+		},
+		{
+			"ok",
+			"83437db4-3e3b-4167-bb7b-74178b6586fd",
+			func(t *testing.T, s *solverMock.MockService) {
+				s.EXPECT().
+					InsertRequests(
+						gomock.Any(),
+						problem.ID{UUID: uuid.MustParse("83437db4-3e3b-4167-bb7b-74178b6586fd")},
+						gomock.Len(1),
+					).
+					Return(&problem.Solution{
+						ID:      problem.ID{UUID: uuid.MustParse("83437db4-3e3b-4167-bb7b-74178b6586fd")},
+						Version: 2,
+						Solution: model.Solution{
+							Metrics: model.SolutionMetrics{
+								NumUnassigned: 1,
+								SolvedTime:    161939,
+							},
+							Routes: []model.SolutionRoute{},
+							Unassigned: []model.UnassignedRequest{
+								{
+									Request: model.Request{
+										RequestID: "new requester ID",
+										PickUp:    point.NewPoint(52.52568, 13.45345),
+										DropOff:   point.NewPoint(52.52568, 13.45345),
+										Load:      model.NewLoad(1),
+									},
+									Reasons: []model.UnassignedReason{
+										model.UnassignedReasonCapacity,
+									},
+								},
+							},
+						},
+					}, nil)
+			},
+			200,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			httpServerWrapper := httpwrapper.NewHTTPServerWrapper(httpwrapper.Config{
+				Mode: "debug",
+				Port: "9092",
+			})
+			defer httpServerWrapper.Stop(context.Background())
+			log := logger.NewNopLogger()
+
+			s := solverMock.NewMockService(ctrl)
+			tt.prepareSolver(t, s)
+			httpServerWrapper.AddController(NewSolverController(log, s, IDGenerator))
+
+			w := httptest.NewRecorder()
+			path := fmt.Sprintf("/api/v1/problem/%s/requests", tt.problemID)
+			reqPath := filepath.Join("./testdata", t.Name()+".req.json")
+			r := readRequestJSON(t, reqPath)
+			req, _ := http.NewRequest("POST", path, bytes.NewReader(r))
+			httpServerWrapper.GetGin().ServeHTTP(w, req)
+
+			var resData interface{}
+			_ = json.NewDecoder(w.Body).Decode(&resData)
+			goldenPath := filepath.Join("./testdata", t.Name()+".golden.json")
+
+			goldenJSON := readGoldenJSON(t, goldenPath)
+			differences := deep.Equal(goldenJSON, resData)
+			if differences != nil {
+				t.Errorf("response not matching golden file: %v", differences)
+			}
+			assert.Equal(t, tt.statusCode, w.Code)
+		})
+	}
+}
+
+func TestSolverController_cancelRequests(t *testing.T) {
+	tests := []struct {
+		name          string
+		prepareSolver func(t *testing.T, s *solverMock.MockService)
+		statusCode    int
+	}{
+		{
+			"when duplicated request",
+			func(t *testing.T, s *solverMock.MockService) {
+				// Do nothing
+			},
+			400,
+		},
+		{
+			"when unknown request",
+			func(t *testing.T, s *solverMock.MockService) {
+				s.EXPECT().
+					CancelRequests(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+					Return(nil, fmt.Errorf("%w: %s", solver.ErrUnknownRequest, "unknown ID"))
+			},
+			400,
+		},
+		{
+			"when solution changed",
+			func(t *testing.T, s *solverMock.MockService) {
+				s.EXPECT().
+					CancelRequests(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+					Return(nil, fmt.Errorf("%w: version 2 already exists", solver.ErrVersionConflict))
+			},
+			409,
+		},
+		{
+			"ok",
+			func(t *testing.T, s *solverMock.MockService) {
+				s.EXPECT().
+					CancelRequests(
+						gomock.Any(),
+						problem.ID{UUID: uuid.MustParse("83437db4-3e3b-4167-bb7b-74178b6586fd")},
+						[]problem.RequestID{"requester ID"},
+						true,
+					).
+					Return(&problem.Solution{
+						ID:      problem.ID{UUID: uuid.MustParse("83437db4-3e3b-4167-bb7b-74178b6586fd")},
+						Version: 3,
+						Solution: model.Solution{
+							Metrics: model.SolutionMetrics{
+								SolvedTime: 161939,
+							},
+							Routes:     []model.SolutionRoute{},
+							Unassigned: []model.UnassignedRequest{},
+						},
+					}, nil)
+			},
+			200,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			httpServerWrapper := httpwrapper.NewHTTPServerWrapper(httpwrapper.Config{
+				Mode: "debug",
+				Port: "9092",
+			})
+			defer httpServerWrapper.Stop(context.Background())
+			log := logger.NewNopLogger()
+
+			s := solverMock.NewMockService(ctrl)
+			tt.prepareSolver(t, s)
+			httpServerWrapper.AddController(NewSolverController(log, s, IDGenerator))
+
+			w := httptest.NewRecorder()
+			path := "/api/v1/problem/83437db4-3e3b-4167-bb7b-74178b6586fd/cancellations"
+			reqPath := filepath.Join("./testdata", t.Name()+".req.json")
+			r := readRequestJSON(t, reqPath)
+			req, _ := http.NewRequest("POST", path, bytes.NewReader(r))
+			httpServerWrapper.GetGin().ServeHTTP(w, req)
+
+			var resData interface{}
+			_ = json.NewDecoder(w.Body).Decode(&resData)
+			goldenPath := filepath.Join("./testdata", t.Name()+".golden.json")
+
+			goldenJSON := readGoldenJSON(t, goldenPath)
+			differences := deep.Equal(goldenJSON, resData)
+			if differences != nil {
+				t.Errorf("response not matching golden file: %v", differences)
+			}
+			assert.Equal(t, tt.statusCode, w.Code)
+		})
+	}
+}
+
 func readRequestJSON(t *testing.T, path string) []byte {
 	t.Helper()
 
@@ -239,3 +695,41 @@ func readRequestJSON(t *testing.T, path string) []byte {
 
 	return req
 }
+
+func TestSolverController_algorithms(t *testing.T) {
+	t.Run("ok", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		httpServerWrapper := httpwrapper.NewHTTPServerWrapper(httpwrapper.Config{
+			Mode: "debug",
+			Port: "9092",
+		})
+		defer httpServerWrapper.Stop(context.Background())
+
+		s := solverMock.NewMockService(ctrl)
+		s.EXPECT().Algorithms().Return(solver.NewAlgorithmRegistry(solver.Config{
+			Algorithm:         "alns",
+			LocalSearchBudget: 2 * time.Second,
+			ALNSTimeLimit:     30 * time.Second,
+			ALNSIterations:    5000,
+			MultiStartStarts:  32,
+		}))
+		httpServerWrapper.AddController(NewSolverController(logger.NewNopLogger(), s, IDGenerator))
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/v1/algorithms", nil)
+		httpServerWrapper.GetGin().ServeHTTP(w, req)
+
+		var resData interface{}
+		_ = json.NewDecoder(w.Body).Decode(&resData)
+		goldenPath := filepath.Join("./testdata", t.Name()+".golden.json")
+
+		goldenJSON := readGoldenJSON(t, goldenPath)
+		differences := deep.Equal(goldenJSON, resData)
+		if differences != nil {
+			t.Errorf("response not matching golden file: %v", differences)
+		}
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+}
@@ -1,8 +1,12 @@
 package roteiro
 
 import (
+	"encoding/json"
+	"fmt"
+	"math"
 	"time"
 
+	"github.com/edusalguero/roteiro.git/internal/algorithms"
 	"github.com/edusalguero/roteiro.git/internal/model"
 	"github.com/edusalguero/roteiro.git/internal/point"
 	"github.com/edusalguero/roteiro.git/internal/problem"
@@ -10,26 +14,553 @@ import (
 )
 
 type problemRequest struct {
-	Assets      []asset     `json:"assets" binding:"required"`
-	Requests    []request   `json:"requests" binding:"required"`
-	Constraints constraints `json:"constraints"`
+	Assets          []asset          `json:"assets" binding:"required"`
+	Requests        []request        `json:"requests" binding:"required"`
+	Constraints     constraints      `json:"constraints"`
+	PlanningHorizon *planningHorizon `json:"planning_horizon"`
+	Options         *options         `json:"options,omitempty"`
+	Objective       *objective       `json:"objective,omitempty"` // Costs of the algorithm when missing
+}
+
+type options struct {
+	Algorithm    string             `json:"algorithm,omitempty"`      // Default algorithm of the solver when missing
+	Parameters   map[string]float64 `json:"parameters,omitempty"`     // Tunable parameters of the algorithm. Durations in nanoseconds
+	MaxSolveTime time.Duration      `json:"max_solve_time,omitempty"` // The best solution so far is returned after it. No limit when missing
+	Seed         int64              `json:"seed,omitempty"`           // Seed of the randomized parts of the algorithms. A random one when missing
+}
+
+// The algorithm must be known and the parameters must be its own
+func (o options) validate(registry *algorithms.Registry) error {
+	if o.MaxSolveTime < 0 {
+		return fmt.Errorf("max solve time: %w", errNegativeDuration)
+	}
+	definition, err := registry.Get(o.Algorithm)
+	if err != nil {
+		return fmt.Errorf("algorithm %s: %w", o.Algorithm, err)
+	}
+	return definition.Validate(o.Parameters)
+}
+
+// objective are the costs the solution is optimized for
+type objective struct {
+	VehicleCost    float64 `json:"vehicle_cost,omitempty"`    // Fixed cost of every used asset
+	DistanceCost   float64 `json:"distance_cost,omitempty"`   // Cost per kilometre driven
+	DurationCost   float64 `json:"duration_cost,omitempty"`   // Cost per hour of route
+	RideTimeCost   float64 `json:"ride_time_cost,omitempty"`  // Cost per minute of every rider in the vehicle
+	WaitingCost    float64 `json:"waiting_cost,omitempty"`    // Cost per minute the assets wait for the time windows
+	UnassignedCost float64 `json:"unassigned_cost,omitempty"` // Cost of every unassigned request besides its unassigned penalty
+}
+
+func (o *objective) isValid() bool {
+	if o == nil {
+		return true
+	}
+	return o.VehicleCost >= 0 && o.DistanceCost >= 0 && o.DurationCost >= 0 &&
+		o.RideTimeCost >= 0 && o.WaitingCost >= 0 && o.UnassignedCost >= 0
+}
+
+func (o *objective) toProblemObjective() model.Objective {
+	if o == nil {
+		return model.Objective{}
+	}
+	return model.Objective{
+		VehicleCost:    o.VehicleCost,
+		DistanceCost:   o.DistanceCost,
+		DurationCost:   o.DurationCost,
+		RideTimeCost:   o.RideTimeCost,
+		WaitingCost:    o.WaitingCost,
+		UnassignedCost: o.UnassignedCost,
+	}
+}
+
+type planningHorizon struct {
+	Start *time.Time `json:"start"` // Departure of the assets. Now by default
+	End   *time.Time `json:"end"`
 }
 
 type asset struct {
-	AssetID  string `json:"asset_id"`
-	Location Point  `json:"location"`
-	Capacity int    `json:"capacity"`
+	AssetID         string        `json:"asset_id"`
+	Location        Point         `json:"location"`
+	EndLocation     *Point        `json:"end_location,omitempty"` // Open route when missing
+	Capacity        quantities    `json:"capacity"`
+	SetupDuration   time.Duration `json:"setup_duration,omitempty"`
+	Shift           *timeWindow   `json:"shift,omitempty"`
+	MaxDuration     time.Duration `json:"max_duration,omitempty"` // Max duration of the route. No limit when missing
+	MaxDistance     float64       `json:"max_distance,omitempty"` // Max driving distance of the route in meters. No limit when missing
+	MaxRequests     int           `json:"max_requests,omitempty"` // Max number of requests of the route. No limit when missing
+	Breaks          []breakRule   `json:"breaks,omitempty"`
+	Skills          []string      `json:"skills,omitempty"`
+	LockedStops     []lockedStop  `json:"locked_stops,omitempty"`     // Stops already committed to, served first and in order
+	InitialLoad     quantities    `json:"initial_load,omitempty"`     // Load on board besides the onboard requests. It is never dropped off
+	OnboardRequests []string      `json:"onboard_requests,omitempty"` // Requests already picked up. Only their drop offs are pending
+	FixedCost       float64       `json:"fixed_cost,omitempty"`       // Cost of using the asset
+	DistanceCost    float64       `json:"distance_cost,omitempty"`    // Cost per kilometre driven
+	DurationCost    float64       `json:"duration_cost,omitempty"`    // Cost per hour of route
+}
+
+type lockedStop struct {
+	RequesterID  string `json:"requester_id"`
+	ActivityType string `json:"activity_type"` // PickUp or DropOff
+}
+
+type breakRule struct {
+	BreakID      string        `json:"break_id"`
+	Duration     time.Duration `json:"duration"`
+	Window       *timeWindow   `json:"window,omitempty"`        // Instants in which the break can start
+	AfterDriving time.Duration `json:"after_driving,omitempty"` // Max driving time before and after the break
 }
 
 type request struct {
-	RequesterID string `json:"requester_id"`
-	PickUp      Point  `json:"pick_up"`
-	DropOff     Point  `json:"drop_off"`
-	Load        uint8  `json:"load"`
+	RequesterID       string      `json:"requester_id"`
+	PickUp            Point       `json:"pick_up"`
+	DropOff           Point       `json:"drop_off"`
+	Load              quantities  `json:"load"`
+	PickUpTimeWindow  *timeWindow `json:"pick_up_time_window,omitempty"`
+	DropOffTimeWindow *timeWindow `json:"drop_off_time_window,omitempty"`
+
+	PickUpServiceDuration  *serviceDuration `json:"pick_up_service_duration,omitempty"`
+	DropOffServiceDuration *serviceDuration `json:"drop_off_service_duration,omitempty"`
+	MaxRideTime            time.Duration    `json:"max_ride_time,omitempty"`     // Max in-vehicle time
+	MaxDetourFactor        float64          `json:"max_detour_factor,omitempty"` // Max multiplier on the direct time from the pick up to the drop off
+	RequiredSkills         []string         `json:"required_skills,omitempty"`
+	AllowedAssets          []string         `json:"allowed_assets,omitempty"` // Only these assets can serve the request
+	ForbiddenAssets        []string         `json:"forbidden_assets,omitempty"`
+	AssetID                string           `json:"asset_id,omitempty"`           // The request can only be served by this asset
+	Priority               int              `json:"priority,omitempty"`           // Higher priorities are inserted first
+	UnassignedPenalty      float64          `json:"unassigned_penalty,omitempty"` // Cost of leaving the request unassigned
+	MustServe              bool             `json:"must_serve,omitempty"`         // The solve fails when the request can not be assigned
+}
+
+// quantities are the units of every capacity dimension.
+// A plain number is the amount of units of the default dimension, and it is rendered back as such
+type quantities map[string]int
+
+const maxQuantity = math.MaxInt32
+
+func (q quantities) MarshalJSON() ([]byte, error) {
+	if len(q) == 0 {
+		return json.Marshal(0)
+	}
+	if units, ok := q[string(model.DefaultDimension)]; ok && len(q) == 1 {
+		return json.Marshal(units)
+	}
+	return json.Marshal(map[string]int(q))
+}
+
+func (q *quantities) UnmarshalJSON(data []byte) error {
+	var units int
+	if err := json.Unmarshal(data, &units); err == nil {
+		*q = quantities{string(model.DefaultDimension): units}
+		return nil
+	}
+
+	var dimensions map[string]int
+	if err := json.Unmarshal(data, &dimensions); err != nil {
+		return err
+	}
+	*q = dimensions
+	return nil
+}
+
+func (q quantities) isValid() bool {
+	for d, units := range q {
+		if d == "" || units < 0 || units > maxQuantity {
+			return false
+		}
+	}
+	return true
+}
+
+func (q quantities) toDimensions() map[model.Dimension]int {
+	dimensions := make(map[model.Dimension]int, len(q))
+	for d, units := range q {
+		dimensions[model.Dimension(d)] = units
+	}
+	return dimensions
+}
+
+func newQuantities(dimensions map[model.Dimension]int) quantities {
+	q := make(quantities, len(dimensions))
+	for d, units := range dimensions {
+		q[string(d)] = units
+	}
+	return q
+}
+
+type serviceDuration struct {
+	Base        time.Duration `json:"base"`
+	PerLoadUnit time.Duration `json:"per_load_unit"`
+}
+
+type timeWindow struct {
+	Earliest *time.Time `json:"earliest,omitempty"`
+	Latest   *time.Time `json:"latest,omitempty"`
 }
 
 type constraints struct {
-	MaxJourneyTimeFactor float64 `json:"max_journey_time_factor"` // Max multiplier on the direct route. Used to calculate the dropoff time offset
+	MaxJourneyTimeFactor float64    `json:"max_journey_time_factor"`         // Max multiplier on the direct route. Used to calculate the dropoff time offset
+	IncompatibleRequests [][]string `json:"incompatible_requests,omitempty"` // Pairs of requests that can not share a route
+	SameVehicleGroups    [][]string `json:"same_vehicle_groups,omitempty"`   // Requests that must share a route
+}
+
+var errInvalidTimeWindow = fmt.Errorf("invalid time window: latest is before earliest")
+var errInvalidPlanningHorizon = fmt.Errorf("invalid planning horizon: end is before start")
+var errNegativeDuration = fmt.Errorf("invalid duration: it can not be negative")
+var errNegativeLimit = fmt.Errorf("invalid limit: it can not be negative")
+var errInvalidDetourFactor = fmt.Errorf("invalid detour factor: it must be at least 1")
+var errInvalidBreak = fmt.Errorf("invalid break: it needs an id, a positive duration and a valid window")
+var errInvalidIncompatibility = fmt.Errorf("invalid incompatible requests: they must be pairs of different known requests")
+var errInvalidGroup = fmt.Errorf("invalid same vehicle group: requests must be known, compatible and in one group at most")
+var errNegativePenalty = fmt.Errorf("invalid unassigned penalty: it can not be negative")
+var errNegativeCost = fmt.Errorf("invalid objective: costs can not be negative")
+var errNegativeAssetCost = fmt.Errorf("invalid asset cost: it can not be negative")
+var errInvalidLockedStop = fmt.Errorf("invalid locked stop: it must be a pick up or drop off of a known request, locked by one asset and after its pick up")
+var errInvalidOnboardRequest = fmt.Errorf("invalid onboard request: it must be a known request on board of one asset at most and without pick up")
+var errUnknownAsset = fmt.Errorf("invalid asset: it is not in the fleet")
+var errDuplicatedRequest = fmt.Errorf("duplicated request")
+var errInvalidQuantity = fmt.Errorf("invalid quantity: dimensions must be named and units must be between 0 and %d", maxQuantity)
+
+func (r problemRequest) validate() error {
+	if h := r.PlanningHorizon; h != nil && h.Start != nil && h.End != nil && h.End.Before(*h.Start) {
+		return errInvalidPlanningHorizon
+	}
+	if !r.Objective.isValid() {
+		return errNegativeCost
+	}
+	for _, a := range r.Assets {
+		if a.SetupDuration < 0 || a.MaxDuration < 0 {
+			return fmt.Errorf("asset %s: %w", a.AssetID, errNegativeDuration)
+		}
+		if a.MaxDistance < 0 || a.MaxRequests < 0 {
+			return fmt.Errorf("asset %s: %w", a.AssetID, errNegativeLimit)
+		}
+		if a.FixedCost < 0 || a.DistanceCost < 0 || a.DurationCost < 0 {
+			return fmt.Errorf("asset %s: %w", a.AssetID, errNegativeAssetCost)
+		}
+		if !a.Shift.isValid() {
+			return fmt.Errorf("asset %s: %w", a.AssetID, errInvalidTimeWindow)
+		}
+		for _, b := range a.Breaks {
+			if !b.isValid() {
+				return fmt.Errorf("asset %s: %w", a.AssetID, errInvalidBreak)
+			}
+		}
+		if !a.Capacity.isValid() || !a.InitialLoad.isValid() {
+			return fmt.Errorf("asset %s: %w", a.AssetID, errInvalidQuantity)
+		}
+	}
+	for _, req := range r.Requests {
+		if err := req.validate(); err != nil {
+			return err
+		}
+	}
+	if err := r.validateAssignments(); err != nil {
+		return err
+	}
+	return r.Constraints.validate(r.Requests)
+}
+
+func (req request) validate() error {
+	if !req.PickUpTimeWindow.isValid() || !req.DropOffTimeWindow.isValid() {
+		return fmt.Errorf("request %s: %w", req.RequesterID, errInvalidTimeWindow)
+	}
+	if !req.PickUpServiceDuration.isValid() || !req.DropOffServiceDuration.isValid() || req.MaxRideTime < 0 {
+		return fmt.Errorf("request %s: %w", req.RequesterID, errNegativeDuration)
+	}
+	if req.UnassignedPenalty < 0 {
+		return fmt.Errorf("request %s: %w", req.RequesterID, errNegativePenalty)
+	}
+	if req.MaxDetourFactor != 0 && req.MaxDetourFactor < 1 {
+		return fmt.Errorf("request %s: %w", req.RequesterID, errInvalidDetourFactor)
+	}
+	if !req.Load.isValid() {
+		return fmt.Errorf("request %s: %w", req.RequesterID, errInvalidQuantity)
+	}
+	return nil
+}
+
+// insertionRequest are new requests for a problem already solved
+type insertionRequest struct {
+	Requests []request `json:"requests" binding:"required"`
+}
+
+// cancellationRequest are requests to remove from a problem already solved
+type cancellationRequest struct {
+	RequesterIDs       []string `json:"requester_ids" binding:"required"`
+	ReinsertUnassigned bool     `json:"reinsert_unassigned"` // Try to insert the unassigned requests into the freed capacity
+}
+
+func (r cancellationRequest) validate() error {
+	seen := make(map[string]bool, len(r.RequesterIDs))
+	for _, id := range r.RequesterIDs {
+		if seen[id] {
+			return fmt.Errorf("request %s: %w", id, errDuplicatedRequest)
+		}
+		seen[id] = true
+	}
+	return nil
+}
+
+func (r insertionRequest) validate() error {
+	seen := make(map[string]bool, len(r.Requests))
+	for _, req := range r.Requests {
+		if seen[req.RequesterID] {
+			return fmt.Errorf("request %s: %w", req.RequesterID, errDuplicatedRequest)
+		}
+		seen[req.RequesterID] = true
+		if err := req.validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// The requests can only be pinned to known assets, and the locked and onboard requests must be pinned to the asset
+// that locks or carries them
+func (r problemRequest) validateAssignments() error {
+	assets := make(map[string]bool, len(r.Assets))
+	for _, a := range r.Assets {
+		assets[a.AssetID] = true
+	}
+	pinned := make(map[string]string, len(r.Requests))
+	for _, req := range r.Requests {
+		if req.AssetID != "" && !assets[req.AssetID] {
+			return fmt.Errorf("request %s: %w", req.RequesterID, errUnknownAsset)
+		}
+		pinned[req.RequesterID] = req.AssetID
+	}
+
+	lockedBy := make(map[string]string)
+	for _, a := range r.Assets {
+		for _, id := range a.OnboardRequests {
+			assetID, known := pinned[id]
+			if !known || (assetID != "" && assetID != a.AssetID) {
+				return fmt.Errorf("asset %s: %w", a.AssetID, errInvalidOnboardRequest)
+			}
+			if _, ok := lockedBy[id]; ok {
+				return fmt.Errorf("asset %s: %w", a.AssetID, errInvalidOnboardRequest)
+			}
+			lockedBy[id] = a.AssetID
+		}
+	}
+	for _, a := range r.Assets {
+		onboard := make(map[string]bool, len(a.OnboardRequests))
+		for _, id := range a.OnboardRequests {
+			onboard[id] = true
+		}
+		locked := make(map[string]bool)
+		for _, s := range a.LockedStops {
+			assetID, known := pinned[s.RequesterID]
+			if !known || (assetID != "" && assetID != a.AssetID) {
+				return fmt.Errorf("asset %s: %w", a.AssetID, errInvalidLockedStop)
+			}
+			if other, ok := lockedBy[s.RequesterID]; ok && other != a.AssetID {
+				return fmt.Errorf("asset %s: %w", a.AssetID, errInvalidLockedStop)
+			}
+			lockedBy[s.RequesterID] = a.AssetID
+
+			key := s.RequesterID + "/" + s.ActivityType
+			switch {
+			case locked[key]:
+				return fmt.Errorf("asset %s: %w", a.AssetID, errInvalidLockedStop)
+			case s.ActivityType == string(model.ActivityTypePickUp):
+				if onboard[s.RequesterID] {
+					return fmt.Errorf("asset %s: %w", a.AssetID, errInvalidOnboardRequest)
+				}
+			case s.ActivityType == string(model.ActivityTypeDropOff):
+				if !onboard[s.RequesterID] && !locked[s.RequesterID+"/"+string(model.ActivityTypePickUp)] {
+					return fmt.Errorf("asset %s: %w", a.AssetID, errInvalidLockedStop)
+				}
+			default:
+				return fmt.Errorf("asset %s: %w", a.AssetID, errInvalidLockedStop)
+			}
+			locked[key] = true
+		}
+	}
+	return nil
+}
+
+func toProblemRequestIDs(ids []string) []problem.RequestID {
+	var requestIDs []problem.RequestID
+	for _, id := range ids {
+		requestIDs = append(requestIDs, problem.RequestID(id))
+	}
+	return requestIDs
+}
+
+func newResponseRefs(refs []model.Ref) []string {
+	var ids []string
+	for _, ref := range refs {
+		ids = append(ids, string(ref))
+	}
+	return ids
+}
+
+// The initial load is omitted when there is nothing on board
+func newResponseInitialLoad(l model.Load) quantities {
+	if len(l) == 0 {
+		return nil
+	}
+	return newQuantities(l)
+}
+
+func toProblemLockedStops(stops []lockedStop) []problem.LockedStop {
+	var lockedStops []problem.LockedStop
+	for _, s := range stops {
+		lockedStops = append(lockedStops, problem.LockedStop{
+			RequestID: problem.RequestID(s.RequesterID),
+			Activity:  model.ActivityType(s.ActivityType),
+		})
+	}
+	return lockedStops
+}
+
+func newResponseLockedStops(stops []model.LockedStop) []lockedStop {
+	var lockedStops []lockedStop
+	for _, s := range stops {
+		lockedStops = append(lockedStops, lockedStop{
+			RequesterID:  string(s.RequestID),
+			ActivityType: string(s.Activity),
+		})
+	}
+	return lockedStops
+}
+
+func (c constraints) validate(requests []request) error {
+	known := make(map[string]bool, len(requests))
+	for _, req := range requests {
+		known[req.RequesterID] = true
+	}
+
+	incompatible := make(map[[2]string]bool, len(c.IncompatibleRequests))
+	for i, pair := range c.IncompatibleRequests {
+		if len(pair) != 2 || pair[0] == pair[1] || !known[pair[0]] || !known[pair[1]] {
+			return fmt.Errorf("incompatible requests %d: %w", i, errInvalidIncompatibility)
+		}
+		incompatible[[2]string{pair[0], pair[1]}] = true
+		incompatible[[2]string{pair[1], pair[0]}] = true
+	}
+
+	grouped := make(map[string]bool)
+	for i, group := range c.SameVehicleGroups {
+		for j, id := range group {
+			if !known[id] || grouped[id] {
+				return fmt.Errorf("same vehicle group %d: %w", i, errInvalidGroup)
+			}
+			grouped[id] = true
+			for _, other := range group[:j] {
+				if incompatible[[2]string{id, other}] {
+					return fmt.Errorf("same vehicle group %d: %w", i, errInvalidGroup)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (c constraints) toProblemIncompatibleRequests() []problem.RequestPair {
+	var pairs []problem.RequestPair
+	for _, pair := range c.IncompatibleRequests {
+		pairs = append(pairs, problem.RequestPair{problem.RequestID(pair[0]), problem.RequestID(pair[1])})
+	}
+	return pairs
+}
+
+func (c constraints) toProblemSameVehicleGroups() []problem.RequestGroup {
+	var groups []problem.RequestGroup
+	for _, group := range c.SameVehicleGroups {
+		var g problem.RequestGroup
+		for _, id := range group {
+			g = append(g, problem.RequestID(id))
+		}
+		groups = append(groups, g)
+	}
+	return groups
+}
+
+func (b breakRule) isValid() bool {
+	return b.BreakID != "" && b.Duration > 0 && b.AfterDriving >= 0 && b.Window.isValid()
+}
+
+func toProblemBreakRules(rules []breakRule) []problem.BreakRule {
+	var breaks []problem.BreakRule
+	for _, b := range rules {
+		breaks = append(breaks, problem.BreakRule{
+			ID:           b.BreakID,
+			Duration:     b.Duration,
+			Window:       b.Window.toProblemTimeWindow(),
+			AfterDriving: b.AfterDriving,
+		})
+	}
+	return breaks
+}
+
+func newResponseBreakRules(rules []model.BreakRule) []breakRule {
+	var breaks []breakRule
+	for _, b := range rules {
+		breaks = append(breaks, breakRule{
+			BreakID:      string(b.ID),
+			Duration:     b.Duration,
+			Window:       newResponseTimeWindow(b.Window),
+			AfterDriving: b.AfterDriving,
+		})
+	}
+	return breaks
+}
+
+func (d *serviceDuration) isValid() bool {
+	return d == nil || (d.Base >= 0 && d.PerLoadUnit >= 0)
+}
+
+func (d *serviceDuration) toProblemServiceDuration() problem.ServiceDuration {
+	if d == nil {
+		return problem.ServiceDuration{}
+	}
+	return problem.ServiceDuration{Base: d.Base, PerLoadUnit: d.PerLoadUnit}
+}
+
+func newResponseServiceDuration(d model.ServiceDuration) *serviceDuration {
+	if d == (model.ServiceDuration{}) {
+		return nil
+	}
+	return &serviceDuration{Base: d.Base, PerLoadUnit: d.PerLoadUnit}
+}
+
+func (w *timeWindow) isValid() bool {
+	if w == nil || w.Earliest == nil || w.Latest == nil {
+		return true
+	}
+	return !w.Latest.Before(*w.Earliest)
+}
+
+func (w *timeWindow) toProblemTimeWindow() problem.TimeWindow {
+	var tw problem.TimeWindow
+	if w == nil {
+		return tw
+	}
+	if w.Earliest != nil {
+		tw.Earliest = *w.Earliest
+	}
+	if w.Latest != nil {
+		tw.Latest = *w.Latest
+	}
+	return tw
+}
+
+func newResponseTimeWindow(w model.TimeWindow) *timeWindow {
+	if w.IsZero() {
+		return nil
+	}
+	tw := &timeWindow{}
+	if w.HasEarliest() {
+		earliest := w.Earliest
+		tw.Earliest = &earliest
+	}
+	if w.HasLatest() {
+		latest := w.Latest
+		tw.Latest = &latest
+	}
+	return tw
 }
 
 type Point struct {
@@ -38,19 +569,67 @@ type Point struct {
 }
 
 type problemResponse struct {
-	ProblemID  string    `json:"problem_id"`
-	Metrics    metrics   `json:"metrics"`
-	Routes     []route   `json:"routes"`
-	Unassigned []request `json:"unassigned"`
+	ProblemID  string              `json:"problem_id"`
+	Version    int                 `json:"version,omitempty"` // Every change of the solution is a new version
+	Metrics    metrics             `json:"metrics"`
+	Routes     []route             `json:"routes"`
+	Unassigned []unassignedRequest `json:"unassigned"`
+}
+
+type unassignedRequest struct {
+	request
+	Reasons []string `json:"reasons,omitempty"` // Constraints violated when trying to insert the request
 }
 
 type metrics struct {
-	NumAssets     int           `json:"num_assets"`
-	NumRequests   int           `json:"num_requests"`
-	NumUnassigned int           `json:"num_unassigned"`
-	Duration      time.Duration `json:"duration"`
-	Distance      float64       `json:"distance"`
-	SolvedTime    time.Duration `json:"solved_time"`
+	NumAssets         int                 `json:"num_assets"`
+	NumRequests       int                 `json:"num_requests"`
+	NumUnassigned     int                 `json:"num_unassigned"`
+	Duration          time.Duration       `json:"duration"`
+	Distance          float64             `json:"distance"`
+	SolvedTime        time.Duration       `json:"solved_time"`
+	UnassignedPenalty float64             `json:"unassigned_penalty"`
+	Objective         *objectiveBreakdown `json:"objective,omitempty"`      // Only when the problem has an objective
+	Cost              float64             `json:"cost,omitempty"`           // Only when the assets have costs
+	Value             float64             `json:"value,omitempty"`          // Cost the algorithm minimizes
+	LowerBound        *float64            `json:"lower_bound,omitempty"`    // Only when the algorithm knows a bound
+	OptimalityGap     *float64            `json:"optimality_gap,omitempty"` // Relative distance between the value and the lower bound
+	Partial           bool                `json:"partial,omitempty"`        // The solving was stopped before its end
+	Seed              int64               `json:"seed,omitempty"`           // The same seed and problem give the same solution
+}
+
+// objectiveBreakdown is the cost of the solution by part of the objective
+type objectiveBreakdown struct {
+	Vehicles   float64 `json:"vehicles"`
+	Distance   float64 `json:"distance"`
+	Duration   float64 `json:"duration"`
+	RideTime   float64 `json:"ride_time"`
+	Waiting    float64 `json:"waiting"`
+	Unassigned float64 `json:"unassigned"`
+	Total      float64 `json:"total"`
+}
+
+func newOptimalityGap(m model.SolutionMetrics) *float64 {
+	gap, ok := m.OptimalityGap()
+	if !ok {
+		return nil
+	}
+	return &gap
+}
+
+func newObjectiveBreakdown(b model.ObjectiveBreakdown) *objectiveBreakdown {
+	if b == (model.ObjectiveBreakdown{}) {
+		return nil
+	}
+	return &objectiveBreakdown{
+		Vehicles:   b.Vehicles,
+		Distance:   b.Distance,
+		Duration:   b.Duration,
+		RideTime:   b.RideTime,
+		Waiting:    b.Waiting,
+		Unassigned: b.Unassigned,
+		Total:      b.Total,
+	}
 }
 
 type route struct {
@@ -66,15 +645,21 @@ type activity struct {
 }
 
 type waypoint struct {
-	Location   Point      `json:"location"`
-	Load       int        `json:"load"`
-	Activities []activity `json:"activities"`
+	Location         Point      `json:"location"`
+	Load             quantities `json:"load"`
+	Activities       []activity `json:"activities"`
+	ArrivalTime      time.Time  `json:"arrival_time"`
+	ServiceStartTime time.Time  `json:"service_start_time"`
+	DepartureTime    time.Time  `json:"departure_time"`
 }
 
 type routeMetrics struct {
-	Requests int           `json:"requests"`
-	Duration time.Duration `json:"duration"`
-	Distance float64       `json:"distance"`
+	Requests  int           `json:"requests"`
+	Duration  time.Duration `json:"duration"`
+	Distance  float64       `json:"distance"`
+	StartTime time.Time     `json:"start_time"`
+	EndTime   time.Time     `json:"end_time"`
+	Cost      float64       `json:"cost,omitempty"` // Only when the asset has costs
 }
 
 func newSolutionResponseFromSol(solution *problem.Solution) problemResponse {
@@ -100,16 +685,22 @@ func newSolutionResponseFromSol(solution *problem.Solution) problemResponse {
 					Lat: w.Location.Lat(),
 					Lon: w.Location.Lon(),
 				},
-				Load:       int(w.Load),
-				Activities: activities,
+				Load:             newQuantities(w.Load),
+				Activities:       activities,
+				ArrivalTime:      w.Arrival,
+				ServiceStartTime: w.ServiceStart,
+				DepartureTime:    w.Departure,
 			}
 		}
 		ro := route{
 			Asset: newResponseAssetFromSolutionRoute(r.Asset),
 			Metrics: routeMetrics{
-				Requests: len(reqs),
-				Duration: r.Metrics.Duration,
-				Distance: r.Metrics.Distance,
+				Requests:  len(reqs),
+				Duration:  r.Metrics.Duration,
+				Distance:  r.Metrics.Distance,
+				StartTime: r.Metrics.Start,
+				EndTime:   r.Metrics.End,
+				Cost:      r.Metrics.Cost,
 			},
 			Requests:  reqs,
 			Waypoints: waypoints,
@@ -118,20 +709,36 @@ func newSolutionResponseFromSol(solution *problem.Solution) problemResponse {
 		routes[i] = ro
 	}
 
-	unassignedReqs := make([]request, len(solution.Unassigned))
+	unassignedReqs := make([]unassignedRequest, len(solution.Unassigned))
 	for i, req := range solution.Unassigned {
-		unassignedReqs[i] = newResponseRequestFromModelRequest(req)
+		reasons := make([]string, len(req.Reasons))
+		for iR, reason := range req.Reasons {
+			reasons[iR] = string(reason)
+		}
+		unassignedReqs[i] = unassignedRequest{
+			request: newResponseRequestFromModelRequest(req.Request),
+			Reasons: reasons,
+		}
 	}
 
 	return problemResponse{
 		ProblemID: solution.ID.String(),
+		Version:   solution.Version,
 		Metrics: metrics{
-			NumAssets:     solution.Metrics.NumAssets,
-			NumRequests:   solution.Metrics.NumRequests,
-			NumUnassigned: solution.Metrics.NumUnassigned,
-			Duration:      solution.Metrics.Duration,
-			Distance:      solution.Metrics.Distance,
-			SolvedTime:    solution.Metrics.SolvedTime,
+			NumAssets:         solution.Metrics.NumAssets,
+			NumRequests:       solution.Metrics.NumRequests,
+			NumUnassigned:     solution.Metrics.NumUnassigned,
+			Duration:          solution.Metrics.Duration,
+			Distance:          solution.Metrics.Distance,
+			SolvedTime:        solution.Metrics.SolvedTime,
+			UnassignedPenalty: solution.Metrics.UnassignedPenalty,
+			Objective:         newObjectiveBreakdown(solution.Metrics.Objective),
+			Cost:              solution.Metrics.Cost,
+			Value:             solution.Metrics.Value,
+			LowerBound:        solution.Metrics.LowerBound,
+			OptimalityGap:     newOptimalityGap(solution.Metrics),
+			Partial:           solution.Metrics.Partial,
+			Seed:              solution.Metrics.Seed,
 		},
 		Routes:     routes,
 		Unassigned: unassignedReqs,
@@ -145,8 +752,72 @@ func newResponseAssetFromSolutionRoute(a model.Asset) asset {
 			Lat: a.Location.Lat(),
 			Lon: a.Location.Lon(),
 		},
-		Capacity: int(a.Capacity),
+		EndLocation:     newResponseEndLocation(a.EndLocation),
+		Capacity:        newQuantities(a.Capacity),
+		SetupDuration:   a.SetupDuration,
+		Shift:           newResponseTimeWindow(a.Shift),
+		MaxDuration:     a.MaxDuration,
+		MaxDistance:     a.MaxDistance,
+		MaxRequests:     a.MaxRequests,
+		Breaks:          newResponseBreakRules(a.Breaks),
+		Skills:          newResponseSkills(a.Skills),
+		LockedStops:     newResponseLockedStops(a.LockedStops),
+		InitialLoad:     newResponseInitialLoad(a.InitialLoad),
+		OnboardRequests: newResponseRefs(a.OnboardRequests),
+		FixedCost:       a.FixedCost,
+		DistanceCost:    a.DistanceCost,
+		DurationCost:    a.DurationCost,
+	}
+}
+
+func newResponseEndLocation(p *point.Point) *Point {
+	if p == nil {
+		return nil
+	}
+	return &Point{
+		Lat: p.Lat(),
+		Lon: p.Lon(),
+	}
+}
+
+func (p *Point) toEndLocation() *point.Point {
+	if p == nil {
+		return nil
+	}
+	l := point.NewPoint(p.Lat, p.Lon)
+	return &l
+}
+
+func toSkills(skills []string) []model.Skill {
+	var s []model.Skill
+	for _, skill := range skills {
+		s = append(s, model.Skill(skill))
+	}
+	return s
+}
+
+func newResponseSkills(skills []model.Skill) []string {
+	var s []string
+	for _, skill := range skills {
+		s = append(s, string(skill))
+	}
+	return s
+}
+
+func toProblemAssetIDs(ids []string) []problem.AssetID {
+	var assetIDs []problem.AssetID
+	for _, id := range ids {
+		assetIDs = append(assetIDs, problem.AssetID(id))
+	}
+	return assetIDs
+}
+
+func newResponseAssetIDs(ids []model.AssetID) []string {
+	var assetIDs []string
+	for _, id := range ids {
+		assetIDs = append(assetIDs, string(id))
 	}
+	return assetIDs
 }
 
 func newResponseRequestFromModelRequest(req model.Request) request {
@@ -160,7 +831,20 @@ func newResponseRequestFromModelRequest(req model.Request) request {
 			Lat: req.DropOff.Lat(),
 			Lon: req.DropOff.Lon(),
 		},
-		Load: uint8(req.Load),
+		Load:                   newQuantities(req.Load),
+		PickUpTimeWindow:       newResponseTimeWindow(req.PickUpTimeWindow),
+		DropOffTimeWindow:      newResponseTimeWindow(req.DropOffTimeWindow),
+		PickUpServiceDuration:  newResponseServiceDuration(req.PickUpDuration),
+		DropOffServiceDuration: newResponseServiceDuration(req.DropOffDuration),
+		MaxRideTime:            req.MaxRideTime,
+		MaxDetourFactor:        req.MaxDetourFactor,
+		RequiredSkills:         newResponseSkills(req.RequiredSkills),
+		AllowedAssets:          newResponseAssetIDs(req.AllowedAssets),
+		ForbiddenAssets:        newResponseAssetIDs(req.ForbiddenAssets),
+		AssetID:                string(req.AssetID),
+		Priority:               req.Priority,
+		UnassignedPenalty:      req.UnassignedPenalty,
+		MustServe:              req.MustServe,
 	}
 }
 
@@ -168,27 +852,118 @@ func newProblemFromRequest(req problemRequest, id uuid.UUID) problem.Problem {
 	var fleet []problem.Asset
 	for _, a := range req.Assets {
 		fleet = append(fleet, problem.Asset{
-			AssetID:  problem.AssetID(a.AssetID),
-			Location: point.NewPoint(a.Location.Lat, a.Location.Lon),
-			Capacity: problem.Capacity(a.Capacity),
+			AssetID:         problem.AssetID(a.AssetID),
+			Location:        point.NewPoint(a.Location.Lat, a.Location.Lon),
+			EndLocation:     a.EndLocation.toEndLocation(),
+			Capacity:        a.Capacity.toDimensions(),
+			SetupDuration:   a.SetupDuration,
+			Shift:           a.Shift.toProblemTimeWindow(),
+			MaxDuration:     a.MaxDuration,
+			MaxDistance:     a.MaxDistance,
+			MaxRequests:     a.MaxRequests,
+			Breaks:          toProblemBreakRules(a.Breaks),
+			Skills:          toSkills(a.Skills),
+			LockedStops:     toProblemLockedStops(a.LockedStops),
+			InitialLoad:     a.InitialLoad.toDimensions(),
+			OnboardRequests: toProblemRequestIDs(a.OnboardRequests),
+			FixedCost:       a.FixedCost,
+			DistanceCost:    a.DistanceCost,
+			DurationCost:    a.DurationCost,
 		})
 	}
 
-	var reqs []problem.Request
-	for _, r := range req.Requests {
-		reqs = append(reqs, problem.Request{
-			RequestID: problem.RequestID(r.RequesterID),
-			PickUp:    point.NewPoint(r.PickUp.Lat, r.PickUp.Lon),
-			DropOff:   point.NewPoint(r.DropOff.Lat, r.DropOff.Lon),
-			Load:      problem.Load(r.Load),
-		})
-	}
-	return problem.Problem{
+	reqs := toProblemRequests(req.Requests)
+	p := problem.Problem{
 		ID:       problem.ID{UUID: id},
 		Fleet:    fleet,
 		Requests: reqs,
 		Constraints: problem.Constraints{
 			MaxJourneyTimeFactor: req.Constraints.MaxJourneyTimeFactor,
+			IncompatibleRequests: req.Constraints.toProblemIncompatibleRequests(),
+			SameVehicleGroups:    req.Constraints.toProblemSameVehicleGroups(),
 		},
+		Objective: req.Objective.toProblemObjective(),
+	}
+	if h := req.PlanningHorizon; h != nil {
+		if h.Start != nil {
+			p.Departure = *h.Start
+		}
+		if h.End != nil {
+			p.HorizonEnd = *h.End
+		}
+	}
+	if req.Options != nil {
+		p.Algorithm = req.Options.Algorithm
+		p.Parameters = req.Options.Parameters
+		p.MaxSolveTime = req.Options.MaxSolveTime
+		p.Seed = req.Options.Seed
+	}
+	return p
+}
+
+func toProblemRequests(requests []request) []problem.Request {
+	var reqs []problem.Request
+	for _, r := range requests {
+		reqs = append(reqs, problem.Request{
+			RequestID:         problem.RequestID(r.RequesterID),
+			PickUp:            point.NewPoint(r.PickUp.Lat, r.PickUp.Lon),
+			DropOff:           point.NewPoint(r.DropOff.Lat, r.DropOff.Lon),
+			Load:              r.Load.toDimensions(),
+			PickUpTimeWindow:  r.PickUpTimeWindow.toProblemTimeWindow(),
+			DropOffTimeWindow: r.DropOffTimeWindow.toProblemTimeWindow(),
+			PickUpDuration:    r.PickUpServiceDuration.toProblemServiceDuration(),
+			DropOffDuration:   r.DropOffServiceDuration.toProblemServiceDuration(),
+			MaxRideTime:       r.MaxRideTime,
+			MaxDetourFactor:   r.MaxDetourFactor,
+			RequiredSkills:    toSkills(r.RequiredSkills),
+			AllowedAssets:     toProblemAssetIDs(r.AllowedAssets),
+			ForbiddenAssets:   toProblemAssetIDs(r.ForbiddenAssets),
+			AssetID:           problem.AssetID(r.AssetID),
+			Priority:          r.Priority,
+			UnassignedPenalty: r.UnassignedPenalty,
+			MustServe:         r.MustServe,
+		})
+	}
+	return reqs
+}
+
+// algorithmsResponse lists the algorithms a problem can be solved with
+type algorithmsResponse struct {
+	Algorithms []algorithmResponse `json:"algorithms"`
+}
+
+type algorithmResponse struct {
+	Name        string              `json:"name"`
+	Description string              `json:"description"`
+	Default     bool                `json:"default"` // Used when the problem has no algorithm
+	Parameters  []parameterResponse `json:"parameters"`
+}
+
+type parameterResponse struct {
+	Name        string  `json:"name"`
+	Type        string  `json:"type"` // Durations are in nanoseconds
+	Description string  `json:"description"`
+	Default     float64 `json:"default"`
+}
+
+func newAlgorithmsResponse(registry *algorithms.Registry) algorithmsResponse {
+	res := algorithmsResponse{Algorithms: []algorithmResponse{}}
+	for _, d := range registry.Definitions() {
+		parameters := make([]parameterResponse, len(d.Parameters))
+		for i, p := range d.Parameters {
+			parameters[i] = parameterResponse{
+				Name:        p.Name,
+				Type:        string(p.Type),
+				Description: p.Description,
+				Default:     p.Default,
+			}
+		}
+		res.Algorithms = append(res.Algorithms, algorithmResponse{
+			Name:        d.Name,
+			Description: d.Description,
+			Default:     d.Name == registry.DefaultName(),
+			Parameters:  parameters,
+		})
 	}
+	return res
 }
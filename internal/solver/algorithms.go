@@ -0,0 +1,22 @@
+package solver
+
+import (
+	"github.com/edusalguero/roteiro.git/internal/algorithms"
+)
+
+// NewAlgorithmRegistry registers the algorithms with the defaults of the configuration.
+// The sequential construction is the default algorithm when the configuration has none
+func NewAlgorithmRegistry(cnf Config) *algorithms.Registry {
+	return algorithms.NewRegistry(
+		cnf.Algorithm,
+		algorithms.SequentialConstructionDefinition(),
+		algorithms.LocalSearchDefinition(cnf.LocalSearchBudget),
+		algorithms.ALNSDefinition(cnf.ALNSTimeLimit, cnf.ALNSIterations),
+		algorithms.ExactDefinition(cnf.ExactTimeLimit),
+		algorithms.MultiStartDefinition(cnf.MultiStartStarts, cnf.MultiStartWorkers),
+	)
+}
+
+func (s *Solver) Algorithms() *algorithms.Registry {
+	return s.registry
+}
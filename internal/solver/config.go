@@ -1,4 +1,18 @@
 package solver
 
+import "time"
+
 type Config struct {
+	// Algorithm of the problems without one. The sequential construction when it is unknown
+	Algorithm string `default:"sequential_construction"`
+	// Default time_budget of the local_search algorithm, the max duration of its improvement of the construction
+	LocalSearchBudget time.Duration `default:"2s"`
+	// Limits of the ALNS search, it stops at the first one reached. Zero means no limit
+	ALNSTimeLimit  time.Duration `default:"30s"`
+	ALNSIterations int           `default:"5000"`
+	// Time limit of the exact search. The best solution found and its lower bound are returned when it is reached
+	ExactTimeLimit time.Duration `default:"10s"`
+	// Constructions of the multi-start, and how many of them run at the same time. Zero workers means one per CPU
+	MultiStartStarts  int `default:"32"`
+	MultiStartWorkers int `default:"0"`
 }
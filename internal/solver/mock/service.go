@@ -8,6 +8,7 @@ import (
 	context "context"
 	reflect "reflect"
 
+	algorithms "github.com/edusalguero/roteiro.git/internal/algorithms"
 	problem "github.com/edusalguero/roteiro.git/internal/problem"
 	gomock "github.com/golang/mock/gomock"
 )
@@ -49,3 +50,47 @@ func (mr *MockServiceMockRecorder) SolveProblem(ctx, p interface{}) *gomock.Call
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SolveProblem", reflect.TypeOf((*MockService)(nil).SolveProblem), ctx, p)
 }
+
+// InsertRequests mocks base method
+func (m *MockService) InsertRequests(ctx context.Context, id problem.ID, requests []problem.Request) (*problem.Solution, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "InsertRequests", ctx, id, requests)
+	ret0, _ := ret[0].(*problem.Solution)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// InsertRequests indicates an expected call of InsertRequests
+func (mr *MockServiceMockRecorder) InsertRequests(ctx, id, requests interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InsertRequests", reflect.TypeOf((*MockService)(nil).InsertRequests), ctx, id, requests)
+}
+
+// CancelRequests mocks base method
+func (m *MockService) CancelRequests(ctx context.Context, id problem.ID, requests []problem.RequestID, reinsert bool) (*problem.Solution, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CancelRequests", ctx, id, requests, reinsert)
+	ret0, _ := ret[0].(*problem.Solution)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CancelRequests indicates an expected call of CancelRequests
+func (mr *MockServiceMockRecorder) CancelRequests(ctx, id, requests, reinsert interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CancelRequests", reflect.TypeOf((*MockService)(nil).CancelRequests), ctx, id, requests, reinsert)
+}
+
+// Algorithms mocks base method
+func (m *MockService) Algorithms() *algorithms.Registry {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Algorithms")
+	ret0, _ := ret[0].(*algorithms.Registry)
+	return ret0
+}
+
+// Algorithms indicates an expected call of Algorithms
+func (mr *MockServiceMockRecorder) Algorithms() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Algorithms", reflect.TypeOf((*MockService)(nil).Algorithms))
+}
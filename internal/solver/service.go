@@ -2,6 +2,7 @@ package solver
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
@@ -19,10 +20,19 @@ var ErrSavingProblem = fmt.Errorf("error saving problem")
 var ErrSavingSolution = fmt.Errorf("error saving solution")
 var ErrBuildingDistanceMatrix = fmt.Errorf("error building distance matrix")
 var ErrInAlgo = fmt.Errorf("error processing solve algorithm")
+var ErrInfeasible = fmt.Errorf("infeasible problem")
+var ErrGettingSolution = fmt.Errorf("error getting solution")
+var ErrDuplicatedRequest = fmt.Errorf("duplicated request")
+var ErrUnknownRequest = fmt.Errorf("unknown request")
+var ErrInvalidOptions = fmt.Errorf("invalid options")
+var ErrVersionConflict = fmt.Errorf("solution changed by another request")
 
 //go:generate mockgen -source=./service.go -destination=./mock/service.go
 type Service interface {
 	SolveProblem(ctx context.Context, p problem.Problem) (*problem.Solution, error)
+	InsertRequests(ctx context.Context, id problem.ID, requests []problem.Request) (*problem.Solution, error)
+	CancelRequests(ctx context.Context, id problem.ID, requests []problem.RequestID, reinsert bool) (*problem.Solution, error)
+	Algorithms() *algorithms.Registry
 }
 
 type Solver struct {
@@ -30,16 +40,32 @@ type Solver struct {
 	cnf               Config
 	distanceEstimator distanceestimator.Service
 	repository        store.Repository
+	registry          *algorithms.Registry
 }
 
 func NewSolver(log logger.Logger, conf Config, r store.Repository, d distanceestimator.Service) *Solver {
-	return &Solver{distanceEstimator: d, logger: log, repository: r, cnf: conf}
+	return &Solver{distanceEstimator: d, logger: log, repository: r, cnf: conf, registry: NewAlgorithmRegistry(conf)}
 }
 
 func (s *Solver) SolveProblem(ctx context.Context, p problem.Problem) (*problem.Solution, error) {
 	log := s.logger.WithField("problem_id", p.ID)
 
-	err := s.repository.AddProblem(ctx, &p)
+	definition, err := s.registry.Get(p.Algorithm)
+	if err != nil {
+		return nil, fmt.Errorf("%w: algorithm %s: %s", ErrInvalidOptions, p.Algorithm, err)
+	}
+	if err := definition.Validate(p.Parameters); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidOptions, err)
+	}
+	if p.Departure.IsZero() {
+		// Assets leave right away
+		p.Departure = time.Now()
+	}
+	if p.Seed == 0 {
+		// The seed is kept with the problem, its solution can be found again
+		p.Seed = time.Now().UnixNano()
+	}
+	err = s.repository.AddProblem(ctx, &p)
 	if err != nil {
 		log.Errorf("Adding problem to the repository %s", err)
 		return nil, ErrSavingProblem
@@ -62,12 +88,15 @@ func (s *Solver) SolveProblem(ctx context.Context, p problem.Problem) (*problem.
 	log.WithField("duration", duration).Infof("Cost Matrix done [%s]", duration)
 
 	routeE := routeestimator.NewEstimator(matrix)
-	algo := algorithms.NewSequentialConstruction(s.logger, routeE, matrix)
+	algo, err := s.registry.New(p.Algorithm, p.Parameters, s.logger, routeE, matrix)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidOptions, err)
+	}
 
 	algoProblem := NewAlgoProblemFromSolverProblem(p)
 	log.Infof("Solving problem...")
 	start = time.Now()
-	sol, err := algo.Solve(ctx, algoProblem)
+	sol, err := s.solve(ctx, algo, algoProblem, p.MaxSolveTime)
 	duration = time.Since(start)
 	if err != nil {
 		if err := s.repository.SetError(ctx, p.ID, err); err != nil {
@@ -75,12 +104,20 @@ func (s *Solver) SolveProblem(ctx context.Context, p problem.Problem) (*problem.
 			return nil, ErrInAlgo
 		}
 		log.Errorf("Solving algorithm", err)
+		if errors.Is(err, algorithms.ErrMustServeUnassigned) {
+			return nil, fmt.Errorf("%w: %s", ErrInfeasible, err)
+		}
 		return nil, ErrInAlgo
 	}
 
-	log.WithField("duration", duration).Infof("Problem solved [%s]", duration)
+	if sol.Metrics.Partial {
+		log.WithField("duration", duration).Infof("Problem solving stopped, partial solution [%s]", duration)
+	} else {
+		log.WithField("duration", duration).Infof("Problem solved [%s]", duration)
+	}
 	solution := &problem.Solution{
 		ID:       p.ID,
+		Version:  1,
 		Solution: *sol,
 	}
 	if err := s.repository.SetSolution(ctx, p.ID, solution); err != nil {
@@ -91,23 +128,306 @@ func (s *Solver) SolveProblem(ctx context.Context, p problem.Problem) (*problem.
 	return solution, nil
 }
 
+// The algorithm is stopped after the max solve time, returning the best solution found so far. Zero means no limit
+func (s *Solver) solve(
+	ctx context.Context,
+	algo algorithms.Algorithm,
+	p model.Problem,
+	maxSolveTime time.Duration,
+) (*model.Solution, error) {
+	if maxSolveTime > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, maxSolveTime)
+		defer cancel()
+	}
+	return algo.Solve(ctx, p)
+}
+
+// InsertRequests adds the requests to the current solution of the problem without solving it again.
+// The algorithm of the problem inserts them when it is an inserter, the sequential construction otherwise.
+// The result is saved as a new version of the solution
+func (s *Solver) InsertRequests(ctx context.Context, id problem.ID, requests []problem.Request) (*problem.Solution, error) {
+	log := s.logger.WithField("problem_id", id)
+
+	current, err := s.repository.GetSolutionByProblemID(ctx, id)
+	if err != nil {
+		log.Errorf("Getting solution from the repository %s", err)
+		if errors.Is(err, store.ErrNotFound) || errors.Is(err, store.ErrInProcess) {
+			return nil, err
+		}
+		return nil, ErrGettingSolution
+	}
+	stored, err := s.repository.GetProblem(ctx, id)
+	if err != nil {
+		log.Errorf("Getting problem from the repository %s", err)
+		return nil, ErrGettingSolution
+	}
+
+	p := *stored
+	p.Requests = append(append([]problem.Request{}, stored.Requests...), requests...)
+	var refs []model.Ref
+	known := make(map[problem.RequestID]bool, len(p.Requests))
+	for _, req := range stored.Requests {
+		known[req.RequestID] = true
+	}
+	for _, req := range requests {
+		if known[req.RequestID] {
+			return nil, fmt.Errorf("%w: %s", ErrDuplicatedRequest, req.RequestID)
+		}
+		known[req.RequestID] = true
+		refs = append(refs, model.Ref(req.RequestID))
+	}
+
+	start := time.Now()
+	log.Infof("Building Cost Matrix...")
+	matrix, err := costmatrix.NewDistanceMatrixBuilder(s.distanceEstimator, s.logger).
+		WithAssets(p.Fleet).
+		WithRequests(p.Requests).
+		Build(ctx)
+	if err != nil {
+		log.Errorf("Building Cost Matrix done %s", err)
+		return nil, ErrBuildingDistanceMatrix
+	}
+	duration := time.Since(start)
+	log.WithField("duration", duration).Infof("Cost Matrix done [%s]", duration)
+
+	routeE := routeestimator.NewEstimator(matrix)
+	algo, err := s.registry.New(p.Algorithm, p.Parameters, s.logger, routeE, matrix)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidOptions, err)
+	}
+	inserter, ok := algo.(algorithms.Inserter)
+	if !ok {
+		inserter = algorithms.NewSequentialConstruction(s.logger, routeE, matrix)
+	}
+
+	log.Infof("Inserting requests...")
+	start = time.Now()
+	sol, err := inserter.Insert(ctx, NewAlgoProblemFromSolverProblem(p), current.Solution, refs)
+	duration = time.Since(start)
+	if err != nil {
+		log.Errorf("Inserting requests: %s", err)
+		if errors.Is(err, algorithms.ErrMustServeUnassigned) {
+			return nil, fmt.Errorf("%w: %s", ErrInfeasible, err)
+		}
+		return nil, ErrInAlgo
+	}
+
+	log.WithField("duration", duration).Infof("Requests inserted [%s]", duration)
+	solution := &problem.Solution{
+		ID:       id,
+		Version:  current.Version + 1,
+		Solution: *sol,
+	}
+	if err := s.updateSolution(ctx, &p, solution); err != nil {
+		log.Errorf("updating solution: %s", err)
+		return nil, err
+	}
+
+	return solution, nil
+}
+
+// The solution is saved unless another request saved a new version of it in the meantime
+func (s *Solver) updateSolution(ctx context.Context, p *problem.Problem, solution *problem.Solution) error {
+	err := s.repository.UpdateSolution(ctx, p, solution)
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, store.ErrVersionConflict):
+		return fmt.Errorf("%w: version %d already exists", ErrVersionConflict, solution.Version)
+	case errors.Is(err, store.ErrNotFound), errors.Is(err, store.ErrInProcess):
+		return err
+	default:
+		return ErrSavingSolution
+	}
+}
+
+// CancelRequests removes the requests from the problem and its current solution without solving it again.
+// When reinsert is set, the unassigned requests are inserted into the freed capacity.
+// The algorithm of the problem removes them when it is a remover, the sequential construction otherwise.
+// The result is saved as a new version of the solution
+func (s *Solver) CancelRequests(
+	ctx context.Context,
+	id problem.ID,
+	requests []problem.RequestID,
+	reinsert bool,
+) (*problem.Solution, error) {
+	log := s.logger.WithField("problem_id", id)
+
+	current, err := s.repository.GetSolutionByProblemID(ctx, id)
+	if err != nil {
+		log.Errorf("Getting solution from the repository %s", err)
+		if errors.Is(err, store.ErrNotFound) || errors.Is(err, store.ErrInProcess) {
+			return nil, err
+		}
+		return nil, ErrGettingSolution
+	}
+	stored, err := s.repository.GetProblem(ctx, id)
+	if err != nil {
+		log.Errorf("Getting problem from the repository %s", err)
+		return nil, ErrGettingSolution
+	}
+
+	known := make(map[problem.RequestID]bool, len(stored.Requests))
+	for _, req := range stored.Requests {
+		known[req.RequestID] = true
+	}
+	cancelled := make(map[problem.RequestID]bool, len(requests))
+	var refs []model.Ref
+	for _, r := range requests {
+		if !known[r] {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownRequest, r)
+		}
+		cancelled[r] = true
+		refs = append(refs, model.Ref(r))
+	}
+	p := withoutRequests(*stored, cancelled)
+
+	start := time.Now()
+	log.Infof("Building Cost Matrix...")
+	matrix, err := costmatrix.NewDistanceMatrixBuilder(s.distanceEstimator, s.logger).
+		WithAssets(p.Fleet).
+		WithRequests(p.Requests).
+		Build(ctx)
+	if err != nil {
+		log.Errorf("Building Cost Matrix done %s", err)
+		return nil, ErrBuildingDistanceMatrix
+	}
+	duration := time.Since(start)
+	log.WithField("duration", duration).Infof("Cost Matrix done [%s]", duration)
+
+	routeE := routeestimator.NewEstimator(matrix)
+	algo, err := s.registry.New(p.Algorithm, p.Parameters, s.logger, routeE, matrix)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidOptions, err)
+	}
+	remover, ok := algo.(algorithms.Remover)
+	if !ok {
+		remover = algorithms.NewSequentialConstruction(s.logger, routeE, matrix)
+	}
+
+	log.Infof("Cancelling requests...")
+	start = time.Now()
+	sol, err := remover.Remove(ctx, NewAlgoProblemFromSolverProblem(p), current.Solution, refs, reinsert)
+	duration = time.Since(start)
+	if err != nil {
+		log.Errorf("Cancelling requests: %s", err)
+		if errors.Is(err, algorithms.ErrMustServeUnassigned) {
+			return nil, fmt.Errorf("%w: %s", ErrInfeasible, err)
+		}
+		return nil, ErrInAlgo
+	}
+
+	log.WithField("duration", duration).Infof("Requests cancelled [%s]", duration)
+	solution := &problem.Solution{
+		ID:       id,
+		Version:  current.Version + 1,
+		Solution: *sol,
+	}
+	if err := s.updateSolution(ctx, &p, solution); err != nil {
+		log.Errorf("updating solution: %s", err)
+		return nil, err
+	}
+
+	return solution, nil
+}
+
+// The cancelled requests are removed from the requests, the assets and the constraints of the problem
+func withoutRequests(p problem.Problem, cancelled map[problem.RequestID]bool) problem.Problem {
+	var requests []problem.Request
+	for _, req := range p.Requests {
+		if !cancelled[req.RequestID] {
+			requests = append(requests, req)
+		}
+	}
+	p.Requests = requests
+
+	var fleet []problem.Asset
+	for _, asset := range p.Fleet {
+		var lockedStops []problem.LockedStop
+		for _, ls := range asset.LockedStops {
+			if !cancelled[ls.RequestID] {
+				lockedStops = append(lockedStops, ls)
+			}
+		}
+		asset.LockedStops = lockedStops
+		asset.OnboardRequests = withoutRequestIDs(asset.OnboardRequests, cancelled)
+		fleet = append(fleet, asset)
+	}
+	p.Fleet = fleet
+
+	var pairs []problem.RequestPair
+	for _, pair := range p.Constraints.IncompatibleRequests {
+		if !cancelled[pair[0]] && !cancelled[pair[1]] {
+			pairs = append(pairs, pair)
+		}
+	}
+	p.Constraints.IncompatibleRequests = pairs
+
+	var groups []problem.RequestGroup
+	for _, group := range p.Constraints.SameVehicleGroups {
+		if g := withoutRequestIDs(group, cancelled); len(g) > 0 {
+			groups = append(groups, g)
+		}
+	}
+	p.Constraints.SameVehicleGroups = groups
+	return p
+}
+
+func withoutRequestIDs(ids []problem.RequestID, cancelled map[problem.RequestID]bool) []problem.RequestID {
+	var kept []problem.RequestID
+	for _, id := range ids {
+		if !cancelled[id] {
+			kept = append(kept, id)
+		}
+	}
+	return kept
+}
+
 func NewAlgoProblemFromSolverProblem(p problem.Problem) model.Problem {
 	var reqs []model.Request
 	for _, req := range p.Requests {
 		reqs = append(reqs, model.Request{
-			RequestID: model.Ref(req.RequestID),
-			PickUp:    req.PickUp,
-			DropOff:   req.DropOff,
-			Load:      model.Load(req.Load),
+			RequestID:         model.Ref(req.RequestID),
+			PickUp:            req.PickUp,
+			DropOff:           req.DropOff,
+			Load:              model.Load(req.Load),
+			PickUpTimeWindow:  model.TimeWindow(req.PickUpTimeWindow),
+			DropOffTimeWindow: model.TimeWindow(req.DropOffTimeWindow),
+			PickUpDuration:    model.ServiceDuration(req.PickUpDuration),
+			DropOffDuration:   model.ServiceDuration(req.DropOffDuration),
+			MaxRideTime:       req.MaxRideTime,
+			MaxDetourFactor:   req.MaxDetourFactor,
+			RequiredSkills:    req.RequiredSkills,
+			AllowedAssets:     newAlgoAssetIDs(req.AllowedAssets),
+			ForbiddenAssets:   newAlgoAssetIDs(req.ForbiddenAssets),
+			AssetID:           model.AssetID(req.AssetID),
+			Priority:          req.Priority,
+			UnassignedPenalty: req.UnassignedPenalty,
+			MustServe:         req.MustServe,
 		})
 	}
 
 	var assets []model.Asset
 	for _, asset := range p.Fleet {
 		assets = append(assets, model.Asset{
-			AssetID:  model.AssetID(asset.AssetID),
-			Location: asset.Location,
-			Capacity: model.Capacity(asset.Capacity),
+			AssetID:         model.AssetID(asset.AssetID),
+			Location:        asset.Location,
+			EndLocation:     asset.EndLocation,
+			Capacity:        model.Capacity(asset.Capacity),
+			SetupDuration:   asset.SetupDuration,
+			Shift:           model.TimeWindow(asset.Shift),
+			MaxDuration:     asset.MaxDuration,
+			MaxDistance:     asset.MaxDistance,
+			MaxRequests:     asset.MaxRequests,
+			Breaks:          newAlgoBreakRules(asset.Breaks),
+			Skills:          asset.Skills,
+			LockedStops:     newAlgoLockedStops(asset.LockedStops),
+			InitialLoad:     model.Load(asset.InitialLoad),
+			OnboardRequests: newAlgoRefs(asset.OnboardRequests),
+			FixedCost:       asset.FixedCost,
+			DistanceCost:    asset.DistanceCost,
+			DurationCost:    asset.DurationCost,
 		})
 	}
 	return model.Problem{
@@ -115,6 +435,72 @@ func NewAlgoProblemFromSolverProblem(p problem.Problem) model.Problem {
 		Requests: reqs,
 		Constraints: model.Constraints{
 			MaxJourneyTimeFactor: p.Constraints.MaxJourneyTimeFactor,
+			IncompatibleRequests: newAlgoRequestPairs(p.Constraints.IncompatibleRequests),
+			SameVehicleGroups:    newAlgoRequestGroups(p.Constraints.SameVehicleGroups),
 		},
+		Departure:  p.Departure,
+		HorizonEnd: p.HorizonEnd,
+		Objective:  p.Objective,
+		Seed:       p.Seed,
+	}
+}
+
+func newAlgoRequestPairs(pairs []problem.RequestPair) []model.RequestPair {
+	var requestPairs []model.RequestPair
+	for _, pair := range pairs {
+		requestPairs = append(requestPairs, model.RequestPair{model.Ref(pair[0]), model.Ref(pair[1])})
+	}
+	return requestPairs
+}
+
+func newAlgoRequestGroups(groups []problem.RequestGroup) []model.RequestGroup {
+	var requestGroups []model.RequestGroup
+	for _, group := range groups {
+		var requestGroup model.RequestGroup
+		for _, id := range group {
+			requestGroup = append(requestGroup, model.Ref(id))
+		}
+		requestGroups = append(requestGroups, requestGroup)
+	}
+	return requestGroups
+}
+
+func newAlgoAssetIDs(ids []problem.AssetID) []model.AssetID {
+	var assetIDs []model.AssetID
+	for _, id := range ids {
+		assetIDs = append(assetIDs, model.AssetID(id))
+	}
+	return assetIDs
+}
+
+func newAlgoRefs(ids []problem.RequestID) []model.Ref {
+	var refs []model.Ref
+	for _, id := range ids {
+		refs = append(refs, model.Ref(id))
+	}
+	return refs
+}
+
+func newAlgoLockedStops(stops []problem.LockedStop) []model.LockedStop {
+	var lockedStops []model.LockedStop
+	for _, stop := range stops {
+		lockedStops = append(lockedStops, model.LockedStop{
+			RequestID: model.Ref(stop.RequestID),
+			Activity:  stop.Activity,
+		})
+	}
+	return lockedStops
+}
+
+func newAlgoBreakRules(rules []problem.BreakRule) []model.BreakRule {
+	var breaks []model.BreakRule
+	for _, rule := range rules {
+		breaks = append(breaks, model.BreakRule{
+			ID:           model.Ref(rule.ID),
+			Duration:     rule.Duration,
+			Window:       model.TimeWindow(rule.Window),
+			AfterDriving: rule.AfterDriving,
+		})
 	}
+	return breaks
 }
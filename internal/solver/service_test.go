@@ -2,8 +2,11 @@ package solver
 
 import (
 	"context"
+	"errors"
 	"testing"
+	"time"
 
+	"github.com/edusalguero/roteiro.git/internal/algorithms"
 	"github.com/edusalguero/roteiro.git/internal/distanceestimator"
 	mock_distanceestimator "github.com/edusalguero/roteiro.git/internal/distanceestimator/mock"
 	"github.com/edusalguero/roteiro.git/internal/logger"
@@ -24,36 +27,36 @@ func Test_service_SolveProblem(t *testing.T) {
 	minoAsset := problem.Asset{
 		AssetID:  "Miño Asset",
 		Location: minoLoc,
-		Capacity: 2,
+		Capacity: problem.Capacity{model.DefaultDimension: 2},
 	}
 	aspontesAsset := problem.Asset{
 		AssetID:  "As Pontes Asset",
 		Location: aspontesLoc,
-		Capacity: 2,
+		Capacity: problem.Capacity{model.DefaultDimension: 2},
 	}
 	req1 := problem.Request{
 		RequestID: "As Pontes 1",
 		PickUp:    aspontesLoc,
 		DropOff:   sadaLoc,
-		Load:      1,
+		Load:      problem.Load{model.DefaultDimension: 1},
 	}
 	req2 := problem.Request{
 		RequestID: "As Pontes 2",
 		PickUp:    aspontesLoc,
 		DropOff:   sadaLoc,
-		Load:      1,
+		Load:      problem.Load{model.DefaultDimension: 1},
 	}
 	req3 := problem.Request{
 		RequestID: "As Pontes 3",
 		PickUp:    aspontesLoc,
 		DropOff:   sadaLoc,
-		Load:      1,
+		Load:      problem.Load{model.DefaultDimension: 1},
 	}
 	req4 := problem.Request{
 		RequestID: "As Pontes 4",
 		PickUp:    aspontesLoc,
 		DropOff:   sadaLoc,
-		Load:      1,
+		Load:      problem.Load{model.DefaultDimension: 1},
 	}
 
 	p := problem.NewProblem(
@@ -71,10 +74,14 @@ func Test_service_SolveProblem(t *testing.T) {
 		problem.Constraints{
 			MaxJourneyTimeFactor: 1.5,
 		})
+	departure := time.Date(2020, 12, 1, 8, 0, 0, 0, time.UTC)
+	p.Departure = departure
+	p.Seed = 42
 
 	const SolvedTime = 1182235
 	solution := problem.Solution{
-		ID: p.ID,
+		ID:      p.ID,
+		Version: 1,
 		Solution: model.Solution{
 			Metrics: model.SolutionMetrics{
 				NumAssets:   2,
@@ -82,6 +89,8 @@ func Test_service_SolveProblem(t *testing.T) {
 				Duration:    4632548169904,
 				Distance:    102945,
 				SolvedTime:  SolvedTime,
+				Value:       time.Duration(4632548169904).Seconds(),
+				Seed:        42,
 			},
 			Routes: []model.SolutionRoute{
 				{
@@ -95,43 +104,49 @@ func Test_service_SolveProblem(t *testing.T) {
 							RequestID: model.Ref(req1.RequestID),
 							PickUp:    req1.PickUp,
 							DropOff:   req1.DropOff,
-							Load:      1,
+							Load:      model.NewLoad(1),
 						},
 						{
 							RequestID: model.Ref(req2.RequestID),
 							PickUp:    req2.PickUp,
 							DropOff:   req2.DropOff,
-							Load:      1,
+							Load:      model.NewLoad(1),
 						},
 					},
 					Waypoints: []model.Waypoint{
 						{
 							Location: minoLoc,
-							Load:     0,
+							Load:     model.NewLoad(0),
 							Activities: []model.Activity{
 								{
 									ActivityType: model.ActivityTypeStart,
 									Ref:          model.Ref(minoAsset.AssetID),
 								},
 							},
+							Arrival:      departure,
+							ServiceStart: departure,
+							Departure:    departure,
 						},
 						{
 							Location: aspontesLoc,
-							Load:     2,
+							Load:     model.NewLoad(2),
 							Activities: []model.Activity{
 								{
 									ActivityType: model.ActivityTypePickUp,
-									Ref:          model.Ref(req2.RequestID),
+									Ref:          model.Ref(req1.RequestID),
 								},
 								{
 									ActivityType: model.ActivityTypePickUp,
-									Ref:          model.Ref(req1.RequestID),
+									Ref:          model.Ref(req2.RequestID),
 								},
 							},
+							Arrival:      departure.Add(1383433251498),
+							ServiceStart: departure.Add(1383433251498),
+							Departure:    departure.Add(1383433251498),
 						},
 						{
 							Location: sadaLoc,
-							Load:     0,
+							Load:     model.NewLoad(0),
 							Activities: []model.Activity{
 								{
 									ActivityType: model.ActivityTypeDropOff,
@@ -142,11 +157,16 @@ func Test_service_SolveProblem(t *testing.T) {
 									Ref:          model.Ref(req2.RequestID),
 								},
 							},
+							Arrival:      departure.Add(3007990710701),
+							ServiceStart: departure.Add(3007990710701),
+							Departure:    departure.Add(3007990710701),
 						},
 					},
 					Metrics: model.RouteMetrics{
 						Duration: 3007990710701,
 						Distance: 66844,
+						Start:    departure,
+						End:      departure.Add(3007990710701),
 					},
 				},
 				{
@@ -160,19 +180,19 @@ func Test_service_SolveProblem(t *testing.T) {
 							RequestID: model.Ref(req3.RequestID),
 							PickUp:    req1.PickUp,
 							DropOff:   req1.DropOff,
-							Load:      1,
+							Load:      model.NewLoad(1),
 						},
 						{
 							RequestID: model.Ref(req4.RequestID),
 							PickUp:    req2.PickUp,
 							DropOff:   req2.DropOff,
-							Load:      1,
+							Load:      model.NewLoad(1),
 						},
 					},
 					Waypoints: []model.Waypoint{
 						{
 							Location: aspontesLoc,
-							Load:     2,
+							Load:     model.NewLoad(2),
 							Activities: []model.Activity{
 								{
 									ActivityType: model.ActivityTypeStart,
@@ -180,17 +200,20 @@ func Test_service_SolveProblem(t *testing.T) {
 								},
 								{
 									ActivityType: model.ActivityTypePickUp,
-									Ref:          model.Ref(req4.RequestID),
+									Ref:          model.Ref(req3.RequestID),
 								},
 								{
 									ActivityType: model.ActivityTypePickUp,
-									Ref:          model.Ref(req3.RequestID),
+									Ref:          model.Ref(req4.RequestID),
 								},
 							},
+							Arrival:      departure,
+							ServiceStart: departure,
+							Departure:    departure,
 						},
 						{
 							Location: sadaLoc,
-							Load:     0,
+							Load:     model.NewLoad(0),
 							Activities: []model.Activity{
 								{
 									ActivityType: model.ActivityTypeDropOff,
@@ -201,15 +224,20 @@ func Test_service_SolveProblem(t *testing.T) {
 									Ref:          model.Ref(req4.RequestID),
 								},
 							},
+							Arrival:      departure.Add(1624557459203),
+							ServiceStart: departure.Add(1624557459203),
+							Departure:    departure.Add(1624557459203),
 						},
 					},
 					Metrics: model.RouteMetrics{
 						Duration: 1624557459203,
 						Distance: 36101,
+						Start:    departure,
+						End:      departure.Add(1624557459203),
 					},
 				},
 			},
-			Unassigned: []model.Request{},
+			Unassigned: []model.UnassignedRequest{},
 		},
 	}
 	e := distanceestimator.NewHaversineDistanceEstimator(80)
@@ -231,7 +259,7 @@ func Test_service_SolveProblem_WithErrorBuildingMatrix(t *testing.T) {
 	aspontesAsset := problem.Asset{
 		AssetID:  "As Pontes Asset",
 		Location: aspontesLoc,
-		Capacity: 2,
+		Capacity: problem.Capacity{model.DefaultDimension: 2},
 	}
 	req1 := problem.Request{
 		RequestID: "As Pontes 1",
@@ -268,3 +296,313 @@ func Test_service_SolveProblem_WithErrorBuildingMatrix(t *testing.T) {
 		assert.Nil(t, got)
 	})
 }
+
+func Test_service_SolveProblem_WithMustServeUnassigned(t *testing.T) {
+	var aspontesLoc = point.NewPoint(43.450218, -7.853109)
+	var sadaLoc = point.NewPoint(43.347306, -8.276904)
+
+	p := problem.NewProblem(
+		problem.ID{UUID: uuid.New()},
+		[]problem.Asset{
+			{
+				AssetID:  "As Pontes Asset",
+				Location: aspontesLoc,
+				Capacity: problem.Capacity{model.DefaultDimension: 1},
+			},
+		},
+		[]problem.Request{
+			{
+				RequestID: "As Pontes 1",
+				PickUp:    aspontesLoc,
+				DropOff:   sadaLoc,
+				Load:      problem.Load{model.DefaultDimension: 2},
+				MustServe: true,
+			},
+		},
+		problem.Constraints{
+			MaxJourneyTimeFactor: 1.5,
+		})
+
+	e := distanceestimator.NewHaversineDistanceEstimator(80)
+	s := NewSolver(logger.NewNopLogger(), Config{}, store.NewInMemoryRepository(), e)
+
+	got, err := s.SolveProblem(context.Background(), *p)
+	assert.True(t, errors.Is(err, ErrInfeasible))
+	assert.Nil(t, got)
+
+	t.Run("Stopped before trying it", func(t *testing.T) {
+		p.ID = problem.ID{UUID: uuid.New()}
+		p.Requests[0].Load = problem.Load{model.DefaultDimension: 1}
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		got, err := s.SolveProblem(ctx, *p)
+		assert.NoError(t, err)
+		assert.True(t, got.Metrics.Partial)
+		assert.Len(t, got.Unassigned, 1)
+	})
+}
+
+func Test_service_SolveProblem_WithAlgorithm(t *testing.T) {
+	var minoLoc = point.NewPoint(43.3475, -8.206389)
+	var aspontesLoc = point.NewPoint(43.450218, -7.853109)
+	var sadaLoc = point.NewPoint(43.347306, -8.276904)
+	departure := time.Date(2020, 12, 1, 8, 0, 0, 0, time.UTC)
+
+	newProblem := func(algorithm string) problem.Problem {
+		p := problem.NewProblem(
+			problem.ID{UUID: uuid.New()},
+			[]problem.Asset{
+				{AssetID: "Miño Asset", Location: minoLoc, Capacity: problem.Capacity{model.DefaultDimension: 1}},
+				{AssetID: "As Pontes Asset", Location: aspontesLoc, Capacity: problem.Capacity{model.DefaultDimension: 1}},
+			},
+			[]problem.Request{
+				{
+					RequestID:        "As Pontes - Sada",
+					PickUp:           aspontesLoc,
+					DropOff:          sadaLoc,
+					Load:             problem.Load{model.DefaultDimension: 1},
+					PickUpTimeWindow: problem.TimeWindow{Latest: departure.Add(25 * time.Minute)},
+				},
+				{
+					RequestID:        "Miño - Sada",
+					PickUp:           minoLoc,
+					DropOff:          sadaLoc,
+					Load:             problem.Load{model.DefaultDimension: 1},
+					PickUpTimeWindow: problem.TimeWindow{Latest: departure.Add(5 * time.Minute)},
+				},
+			},
+			problem.Constraints{
+				MaxJourneyTimeFactor: 1.5,
+			})
+		p.Departure = departure
+		p.Algorithm = algorithm
+		return *p
+	}
+
+	e := distanceestimator.NewHaversineDistanceEstimator(80)
+	s := NewSolver(logger.NewNopLogger(), Config{ALNSIterations: 100}, store.NewInMemoryRepository(), e)
+
+	t.Run("Default algorithm", func(t *testing.T) {
+		got, err := s.SolveProblem(context.Background(), newProblem(""))
+		assert.NoError(t, err)
+		assert.Len(t, got.Unassigned, 1)
+	})
+
+	t.Run("ALNS", func(t *testing.T) {
+		got, err := s.SolveProblem(context.Background(), newProblem(algorithms.ALNSName))
+		assert.NoError(t, err)
+		assert.Empty(t, got.Unassigned)
+		assert.Equal(t, 2, got.Metrics.NumRequests)
+	})
+
+	t.Run("ALNS with parameters", func(t *testing.T) {
+		p := newProblem(algorithms.ALNSName)
+		p.Parameters = map[string]float64{"iterations": 10}
+		got, err := s.SolveProblem(context.Background(), p)
+		assert.NoError(t, err)
+		assert.Empty(t, got.Unassigned)
+	})
+
+	t.Run("ALNS with seed", func(t *testing.T) {
+		p := newProblem(algorithms.ALNSName)
+		p.Seed = 42
+		got, err := s.SolveProblem(context.Background(), p)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(42), got.Metrics.Seed)
+	})
+
+	t.Run("ALNS without seed", func(t *testing.T) {
+		got, err := s.SolveProblem(context.Background(), newProblem(algorithms.ALNSName))
+		assert.NoError(t, err)
+		// A random seed is used, and returned to solve the problem again
+		assert.NotZero(t, got.Metrics.Seed)
+	})
+
+	t.Run("ALNS with max solve time", func(t *testing.T) {
+		p := newProblem(algorithms.ALNSName)
+		p.Parameters = map[string]float64{"iterations": 1e9}
+		p.MaxSolveTime = 50 * time.Millisecond
+		got, err := s.SolveProblem(context.Background(), p)
+		assert.NoError(t, err)
+		assert.True(t, got.Metrics.Partial)
+		assert.Less(t, int64(got.Metrics.SolvedTime), int64(time.Second))
+	})
+
+	t.Run("Exact", func(t *testing.T) {
+		got, err := s.SolveProblem(context.Background(), newProblem(algorithms.ExactName))
+		assert.NoError(t, err)
+		assert.Empty(t, got.Unassigned)
+		gap, ok := got.Metrics.OptimalityGap()
+		assert.True(t, ok)
+		assert.Zero(t, gap)
+	})
+
+	t.Run("Unknown algorithm", func(t *testing.T) {
+		got, err := s.SolveProblem(context.Background(), newProblem("simplex"))
+		assert.True(t, errors.Is(err, ErrInvalidOptions))
+		assert.Nil(t, got)
+	})
+
+	t.Run("Unknown parameter", func(t *testing.T) {
+		p := newProblem(algorithms.ALNSName)
+		p.Parameters = map[string]float64{"temperature": 10}
+		got, err := s.SolveProblem(context.Background(), p)
+		assert.True(t, errors.Is(err, ErrInvalidOptions))
+		assert.Nil(t, got)
+	})
+}
+
+func Test_service_InsertRequests(t *testing.T) {
+	var aspontesLoc = point.NewPoint(43.450218, -7.853109)
+	var sadaLoc = point.NewPoint(43.347306, -8.276904)
+
+	request := func(id problem.RequestID) problem.Request {
+		return problem.Request{
+			RequestID: id,
+			PickUp:    aspontesLoc,
+			DropOff:   sadaLoc,
+			Load:      problem.Load{model.DefaultDimension: 1},
+		}
+	}
+	p := problem.NewProblem(
+		problem.ID{UUID: uuid.New()},
+		[]problem.Asset{
+			{
+				AssetID:  "As Pontes Asset",
+				Location: aspontesLoc,
+				Capacity: problem.Capacity{model.DefaultDimension: 2},
+			},
+		},
+		[]problem.Request{request("As Pontes 1")},
+		problem.Constraints{
+			MaxJourneyTimeFactor: 1.5,
+		})
+
+	e := distanceestimator.NewHaversineDistanceEstimator(80)
+	repository := store.NewInMemoryRepository()
+	s := NewSolver(logger.NewNopLogger(), Config{}, repository, e)
+	_, err := s.SolveProblem(context.Background(), *p)
+	assert.NoError(t, err)
+
+	t.Run("New version of the solution", func(t *testing.T) {
+		got, err := s.InsertRequests(context.Background(), p.ID, []problem.Request{request("As Pontes 2")})
+		assert.NoError(t, err)
+		assert.Equal(t, 2, got.Version)
+		assert.Equal(t, 2, got.Metrics.NumRequests)
+		assert.Empty(t, got.Unassigned)
+
+		stored, err := repository.GetSolutionByProblemID(context.Background(), p.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, got, stored)
+		storedProblem, err := repository.GetProblem(context.Background(), p.ID)
+		assert.NoError(t, err)
+		assert.Len(t, storedProblem.Requests, 2)
+	})
+
+	t.Run("Duplicated request", func(t *testing.T) {
+		got, err := s.InsertRequests(context.Background(), p.ID, []problem.Request{request("As Pontes 1")})
+		assert.True(t, errors.Is(err, ErrDuplicatedRequest))
+		assert.Nil(t, got)
+	})
+
+	t.Run("Unknown problem", func(t *testing.T) {
+		got, err := s.InsertRequests(context.Background(), problem.ID{UUID: uuid.New()}, []problem.Request{request("As Pontes 3")})
+		assert.True(t, errors.Is(err, store.ErrNotFound))
+		assert.Nil(t, got)
+	})
+
+	t.Run("Solution changed by another request", func(t *testing.T) {
+		racing := racingRepository{store.NewInMemoryRepository()}
+		s := NewSolver(logger.NewNopLogger(), Config{}, racing, e)
+		_, err := s.SolveProblem(context.Background(), *p)
+		assert.NoError(t, err)
+
+		got, err := s.InsertRequests(context.Background(), p.ID, []problem.Request{request("As Pontes 2")})
+		assert.True(t, errors.Is(err, ErrVersionConflict))
+		assert.Nil(t, got)
+	})
+}
+
+// racingRepository saves a new version of the solution right before every update, as a concurrent request would
+type racingRepository struct {
+	*store.InMemoryRepository
+}
+
+func (r racingRepository) UpdateSolution(ctx context.Context, p *problem.Problem, solution *problem.Solution) error {
+	current, err := r.GetSolutionByProblemID(ctx, p.ID)
+	if err != nil {
+		return err
+	}
+	concurrent := *current
+	concurrent.Version++
+	if err := r.InMemoryRepository.UpdateSolution(ctx, p, &concurrent); err != nil {
+		return err
+	}
+	return r.InMemoryRepository.UpdateSolution(ctx, p, solution)
+}
+
+func Test_service_CancelRequests(t *testing.T) {
+	var aspontesLoc = point.NewPoint(43.450218, -7.853109)
+	var sadaLoc = point.NewPoint(43.347306, -8.276904)
+
+	request := func(id problem.RequestID) problem.Request {
+		return problem.Request{
+			RequestID: id,
+			PickUp:    aspontesLoc,
+			DropOff:   sadaLoc,
+			Load:      problem.Load{model.DefaultDimension: 1},
+		}
+	}
+	p := problem.NewProblem(
+		problem.ID{UUID: uuid.New()},
+		[]problem.Asset{
+			{
+				AssetID:  "As Pontes Asset",
+				Location: aspontesLoc,
+				Capacity: problem.Capacity{model.DefaultDimension: 1},
+			},
+		},
+		[]problem.Request{request("As Pontes 1"), request("As Pontes 2")},
+		problem.Constraints{
+			MaxJourneyTimeFactor: 1,
+		})
+
+	e := distanceestimator.NewHaversineDistanceEstimator(80)
+	repository := store.NewInMemoryRepository()
+	s := NewSolver(logger.NewNopLogger(), Config{}, repository, e)
+	solved, err := s.SolveProblem(context.Background(), *p)
+	assert.NoError(t, err)
+	assert.Len(t, solved.Unassigned, 1)
+
+	t.Run("Unknown request", func(t *testing.T) {
+		got, err := s.CancelRequests(context.Background(), p.ID, []problem.RequestID{"unknown"}, true)
+		assert.True(t, errors.Is(err, ErrUnknownRequest))
+		assert.Nil(t, got)
+	})
+
+	t.Run("New version of the solution", func(t *testing.T) {
+		assigned := problem.RequestID(solved.Routes[0].Requests[0].RequestID)
+		got, err := s.CancelRequests(context.Background(), p.ID, []problem.RequestID{assigned}, true)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, got.Version)
+		assert.Equal(t, 1, got.Metrics.NumRequests)
+		assert.NotEqual(t, model.Ref(assigned), got.Routes[0].Requests[0].RequestID)
+		assert.Empty(t, got.Unassigned)
+
+		storedProblem, err := repository.GetProblem(context.Background(), p.ID)
+		assert.NoError(t, err)
+		assert.Len(t, storedProblem.Requests, 1)
+	})
+
+	t.Run("Solution changed by another request", func(t *testing.T) {
+		racing := racingRepository{store.NewInMemoryRepository()}
+		s := NewSolver(logger.NewNopLogger(), Config{}, racing, e)
+		solved, err := s.SolveProblem(context.Background(), *p)
+		assert.NoError(t, err)
+
+		assigned := problem.RequestID(solved.Routes[0].Requests[0].RequestID)
+		got, err := s.CancelRequests(context.Background(), p.ID, []problem.RequestID{assigned}, true)
+		assert.True(t, errors.Is(err, ErrVersionConflict))
+		assert.Nil(t, got)
+	})
+}
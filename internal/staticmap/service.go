@@ -4,7 +4,6 @@ import (
 	"image"
 	"image/color"
 	"math/rand"
-	"time"
 
 	"github.com/edusalguero/roteiro.git/internal/point"
 	maps "github.com/flopp/go-staticmaps"
@@ -27,10 +26,11 @@ func NewService() *StaticMap {
 func (s StaticMap) Render(solution *problem.Solution) (image.Image, error) {
 	mapCtx := maps.NewContext()
 	mapCtx.SetSize(2000, 2000)
+	colors := newPalette(solution.Metrics.Seed)
 	for _, r := range solution.Routes {
-		mapCtx.AddMarker(createMarker(r.Asset.Location, string(r.Asset.AssetID), randomColor(), 16))
+		mapCtx.AddMarker(createMarker(r.Asset.Location, string(r.Asset.AssetID), colors.next(), 16))
 		for _, req := range r.Requests {
-			c := randomColor()
+			c := colors.next()
 			mapCtx.AddMarker(createMarker(req.PickUp, string(req.RequestID), c, 16))
 			mapCtx.AddMarker(createMarker(req.DropOff, string(req.RequestID), c, 16))
 		}
@@ -38,11 +38,11 @@ func (s StaticMap) Render(solution *problem.Solution) (image.Image, error) {
 		for _, w := range r.Waypoints {
 			positions = append(positions, s2PointFromPoint(w.Location))
 		}
-		mapCtx.AddPath(maps.NewPath(positions, randomColor(), 2))
+		mapCtx.AddPath(maps.NewPath(positions, colors.next(), 2))
 	}
 
 	for _, req := range solution.Unassigned {
-		c := randomColor()
+		c := colors.next()
 		mapCtx.AddMarker(createMarker(req.PickUp, string(req.RequestID), c, 10))
 		mapCtx.AddMarker(createMarker(req.DropOff, string(req.RequestID), c, 10))
 	}
@@ -63,7 +63,15 @@ func s2PointFromPoint(p point.Point) s2.LatLng {
 	return s2.LatLngFromDegrees(p.Lat(), p.Lon())
 }
 
-func randomColor() color.RGBA {
-	r := rand.New(rand.NewSource(time.Now().UnixNano()))
-	return color.RGBA{R: uint8(r.Intn(255)), G: uint8(r.Intn(255)), B: uint8(r.Intn(255)), A: 255}
+// palette gives random colors. The colors of the same seed are always the same
+type palette struct {
+	rnd *rand.Rand
+}
+
+func newPalette(seed int64) *palette {
+	return &palette{rnd: rand.New(rand.NewSource(seed))}
+}
+
+func (p *palette) next() color.RGBA {
+	return color.RGBA{R: uint8(p.rnd.Intn(255)), G: uint8(p.rnd.Intn(255)), B: uint8(p.rnd.Intn(255)), A: 255}
 }
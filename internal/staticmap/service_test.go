@@ -1,6 +1,7 @@
 package staticmap
 
 import (
+	"image/color"
 	"testing"
 
 	"github.com/edusalguero/roteiro.git/internal/model"
@@ -18,12 +19,12 @@ func TestService_Render(t *testing.T) {
 	minoAsset := problem.Asset{
 		AssetID:  "Miño Asset",
 		Location: minoLoc,
-		Capacity: 2,
+		Capacity: problem.Capacity{model.DefaultDimension: 2},
 	}
 	aspontesAsset := problem.Asset{
 		AssetID:  "As Pontes Asset",
 		Location: aspontesLoc,
-		Capacity: 2,
+		Capacity: problem.Capacity{model.DefaultDimension: 2},
 	}
 	req1 := problem.Request{
 		RequestID: "As Pontes 1",
@@ -77,7 +78,7 @@ func TestService_Render(t *testing.T) {
 					Waypoints: []model.Waypoint{
 						{
 							Location: minoLoc,
-							Load:     0,
+							Load:     model.NewLoad(0),
 							Activities: []model.Activity{
 								{
 									ActivityType: model.ActivityTypeStart,
@@ -87,7 +88,7 @@ func TestService_Render(t *testing.T) {
 						},
 						{
 							Location: aspontesLoc,
-							Load:     2,
+							Load:     model.NewLoad(2),
 							Activities: []model.Activity{
 								{
 									ActivityType: model.ActivityTypePickUp,
@@ -101,7 +102,7 @@ func TestService_Render(t *testing.T) {
 						},
 						{
 							Location: sadaLoc,
-							Load:     0,
+							Load:     model.NewLoad(0),
 							Activities: []model.Activity{
 								{
 									ActivityType: model.ActivityTypeDropOff,
@@ -140,7 +141,7 @@ func TestService_Render(t *testing.T) {
 					Waypoints: []model.Waypoint{
 						{
 							Location: aspontesLoc,
-							Load:     2,
+							Load:     model.NewLoad(2),
 							Activities: []model.Activity{
 								{
 									ActivityType: model.ActivityTypeStart,
@@ -158,7 +159,7 @@ func TestService_Render(t *testing.T) {
 						},
 						{
 							Location: sadaLoc,
-							Load:     0,
+							Load:     model.NewLoad(0),
 							Activities: []model.Activity{
 								{
 									ActivityType: model.ActivityTypeDropOff,
@@ -177,7 +178,7 @@ func TestService_Render(t *testing.T) {
 					},
 				},
 			},
-			Unassigned: []model.Request{},
+			Unassigned: []model.UnassignedRequest{},
 		},
 	}
 
@@ -204,3 +205,15 @@ func TestService_Render(t *testing.T) {
 		})
 	}
 }
+
+func Test_palette(t *testing.T) {
+	p1, p2, other := newPalette(42), newPalette(42), newPalette(7)
+	var colors1, colors2, otherColors []color.RGBA
+	for i := 0; i < 10; i++ {
+		colors1 = append(colors1, p1.next())
+		colors2 = append(colors2, p2.next())
+		otherColors = append(otherColors, other.next())
+	}
+	assert.Equal(t, colors1, colors2)
+	assert.NotEqual(t, colors1, otherColors)
+}
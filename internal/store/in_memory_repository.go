@@ -3,6 +3,7 @@ package store
 import (
 	"context"
 	"errors"
+	"sync"
 
 	"github.com/edusalguero/roteiro.git/internal/problem"
 )
@@ -10,8 +11,11 @@ import (
 var ErrInProcess = errors.New("solution in process")
 var ErrNotFound = errors.New("problem not found")
 var ErrAlreadyExist = errors.New("problem already exist")
+var ErrVersionConflict = errors.New("solution version conflict")
 
+// InMemoryRepository is safe for concurrent use, the solutions of the problems are changed by concurrent requests
 type InMemoryRepository struct {
+	mu       sync.RWMutex
 	problems map[problem.ID]*Record
 }
 
@@ -20,6 +24,9 @@ func NewInMemoryRepository() *InMemoryRepository {
 }
 
 func (r *InMemoryRepository) AddProblem(_ context.Context, p *problem.Problem) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
 	_, ok := r.problems[p.ID]
 	if ok {
 		return ErrAlreadyExist
@@ -34,6 +41,9 @@ func (r *InMemoryRepository) AddProblem(_ context.Context, p *problem.Problem) e
 }
 
 func (r *InMemoryRepository) SetError(_ context.Context, id problem.ID, err error) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
 	record, ok := r.problems[id]
 	if !ok {
 		return ErrNotFound
@@ -45,6 +55,9 @@ func (r *InMemoryRepository) SetError(_ context.Context, id problem.ID, err erro
 }
 
 func (r *InMemoryRepository) SetSolution(_ context.Context, id problem.ID, solution *problem.Solution) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
 	record, ok := r.problems[id]
 	if !ok {
 		return ErrNotFound
@@ -56,6 +69,9 @@ func (r *InMemoryRepository) SetSolution(_ context.Context, id problem.ID, solut
 }
 
 func (r *InMemoryRepository) GetSolutionByProblemID(_ context.Context, id problem.ID) (*problem.Solution, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
 	record, ok := r.problems[id]
 	if !ok {
 		return nil, ErrNotFound
@@ -71,3 +87,40 @@ func (r *InMemoryRepository) GetSolutionByProblemID(_ context.Context, id proble
 
 	return nil, record.Error
 }
+
+func (r *InMemoryRepository) GetProblem(_ context.Context, id problem.ID) (*problem.Problem, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	record, ok := r.problems[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return record.Problem, nil
+}
+
+// The new version of the solution replaces the current one, which is kept with the previous versions.
+// The problem is replaced too, as the solution may serve new requests
+func (r *InMemoryRepository) UpdateSolution(_ context.Context, p *problem.Problem, solution *problem.Solution) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	record, ok := r.problems[p.ID]
+	if !ok {
+		return ErrNotFound
+	}
+
+	if record.SolutionStatus != StatusDone {
+		return ErrInProcess
+	}
+
+	if solution.Version != record.Solution.Version+1 {
+		return ErrVersionConflict
+	}
+	record.Versions = append(record.Versions, record.Solution)
+	record.Problem = p
+	record.Solution = solution
+
+	return nil
+}
@@ -90,3 +90,32 @@ func (mr *MockRepositoryMockRecorder) GetSolutionByProblemID(ctx, id interface{}
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSolutionByProblemID", reflect.TypeOf((*MockRepository)(nil).GetSolutionByProblemID), ctx, id)
 }
+
+// GetProblem mocks base method
+func (m *MockRepository) GetProblem(ctx context.Context, id problem.ID) (*problem.Problem, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetProblem", ctx, id)
+	ret0, _ := ret[0].(*problem.Problem)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetProblem indicates an expected call of GetProblem
+func (mr *MockRepositoryMockRecorder) GetProblem(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetProblem", reflect.TypeOf((*MockRepository)(nil).GetProblem), ctx, id)
+}
+
+// UpdateSolution mocks base method
+func (m *MockRepository) UpdateSolution(ctx context.Context, problem *problem.Problem, solution *problem.Solution) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateSolution", ctx, problem, solution)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateSolution indicates an expected call of UpdateSolution
+func (mr *MockRepositoryMockRecorder) UpdateSolution(ctx, problem, solution interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateSolution", reflect.TypeOf((*MockRepository)(nil).UpdateSolution), ctx, problem, solution)
+}
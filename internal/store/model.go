@@ -18,6 +18,7 @@ type Record struct {
 	Problem        *problem.Problem
 	SolutionStatus StatusType
 	Solution       *problem.Solution
+	Versions       []*problem.Solution // Previous solutions, oldest first
 	Error          error
 	Time           time.Duration
 }
@@ -12,4 +12,6 @@ type Repository interface {
 	SetSolution(ctx context.Context, id problem.ID, solution *problem.Solution) error
 	SetError(ctx context.Context, id problem.ID, err error) error
 	GetSolutionByProblemID(ctx context.Context, id problem.ID) (*problem.Solution, error)
+	GetProblem(ctx context.Context, id problem.ID) (*problem.Problem, error)
+	UpdateSolution(ctx context.Context, problem *problem.Problem, solution *problem.Solution) error
 }
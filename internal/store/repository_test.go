@@ -2,7 +2,9 @@ package store
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"sync"
 	"testing"
 
 	"github.com/edusalguero/roteiro.git/internal/model"
@@ -176,3 +178,102 @@ func TestInMemoryRepository_SetSolution(t *testing.T) {
 		assert.Equal(t, r.problems[problemID].Solution, s)
 	})
 }
+
+func TestInMemoryRepository_GetProblem(t *testing.T) {
+	t.Run("Err if not exist", func(t *testing.T) {
+		r := NewInMemoryRepository()
+		_, err := r.GetProblem(context.Background(), problem.ID{UUID: uuid.New()})
+		assert.True(t, errors.Is(err, ErrNotFound))
+	})
+
+	t.Run("Return problem if exist", func(t *testing.T) {
+		problemID := problem.ID{UUID: uuid.New()}
+		p := &problem.Problem{ID: problemID}
+		r := NewInMemoryRepository()
+		assert.NoError(t, r.AddProblem(context.Background(), p))
+
+		got, err := r.GetProblem(context.Background(), problemID)
+		assert.NoError(t, err)
+		assert.Equal(t, p, got)
+	})
+}
+
+func TestInMemoryRepository_UpdateSolution(t *testing.T) {
+	problemID := problem.ID{UUID: uuid.New()}
+	newRepository := func(status StatusType) *InMemoryRepository {
+		return &InMemoryRepository{problems: map[problem.ID]*Record{
+			problemID: {
+				Problem:        &problem.Problem{ID: problemID},
+				SolutionStatus: status,
+				Solution:       &problem.Solution{ID: problemID, Version: 1},
+			},
+		}}
+	}
+
+	t.Run("Err if not exist", func(t *testing.T) {
+		r := NewInMemoryRepository()
+		err := r.UpdateSolution(context.Background(), &problem.Problem{ID: problemID}, &problem.Solution{ID: problemID})
+		assert.True(t, errors.Is(err, ErrNotFound))
+	})
+
+	t.Run("Err if not solved", func(t *testing.T) {
+		r := newRepository(StatusProcessing)
+		err := r.UpdateSolution(context.Background(), &problem.Problem{ID: problemID}, &problem.Solution{ID: problemID, Version: 2})
+		assert.True(t, errors.Is(err, ErrInProcess))
+	})
+
+	t.Run("Err if not the next version", func(t *testing.T) {
+		r := newRepository(StatusDone)
+		err := r.UpdateSolution(context.Background(), &problem.Problem{ID: problemID}, &problem.Solution{ID: problemID, Version: 1})
+		assert.True(t, errors.Is(err, ErrVersionConflict))
+	})
+
+	t.Run("Keep the previous versions", func(t *testing.T) {
+		r := newRepository(StatusDone)
+		p := &problem.Problem{ID: problemID, Requests: []problem.Request{{RequestID: "new"}}}
+		s := &problem.Solution{ID: problemID, Version: 2}
+		err := r.UpdateSolution(context.Background(), p, s)
+		assert.NoError(t, err)
+		assert.Equal(t, p, r.problems[problemID].Problem)
+		assert.Equal(t, s, r.problems[problemID].Solution)
+		assert.Equal(t, []*problem.Solution{{ID: problemID, Version: 1}}, r.problems[problemID].Versions)
+	})
+}
+
+func TestInMemoryRepository_Concurrency(t *testing.T) {
+	problemID := problem.ID{UUID: uuid.New()}
+	r := NewInMemoryRepository()
+	assert.NoError(t, r.AddProblem(context.Background(), &problem.Problem{ID: problemID}))
+	assert.NoError(t, r.SetSolution(context.Background(), problemID, &problem.Solution{ID: problemID, Version: 1}))
+
+	const writers = 10
+	errs := make(chan error, writers)
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			s := &problem.Solution{ID: problemID, Version: 2}
+			errs <- r.UpdateSolution(context.Background(), &problem.Problem{ID: problemID}, s)
+		}()
+		go func() {
+			defer wg.Done()
+			_, _ = r.GetProblem(context.Background(), problemID)
+			_, _ = r.GetSolutionByProblemID(context.Background(), problemID)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	// Only one of the writers updates the solution, the others find a newer version
+	var updated int
+	for err := range errs {
+		if err == nil {
+			updated++
+			continue
+		}
+		assert.True(t, errors.Is(err, ErrVersionConflict))
+	}
+	assert.Equal(t, 1, updated)
+	assert.Len(t, r.problems[problemID].Versions, 1)
+}